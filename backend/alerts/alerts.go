@@ -0,0 +1,60 @@
+package alerts
+
+import (
+	"log"
+	"myAPI/models"
+	"sync"
+)
+
+// Alert - уведомление подписчику о поступлении товара или снижении цены
+type Alert struct {
+	Kind        string // models.SubscriptionBackInStock или models.SubscriptionPriceDrop
+	Email       string
+	Name        string
+	Language    string
+	ProductID   int
+	ProductName string
+	Price       models.Money // текущая цена со скидкой
+	OldPrice    models.Money // цена, с которой сравнивалось снижение
+	URL         string
+}
+
+// Channel - способ доставки уведомлений (журнал, письма и т.п.)
+type Channel interface {
+	Name() string
+	Send(alert Alert) error
+}
+
+// LogChannel пишет уведомления в журнал сервера - канал по умолчанию
+type LogChannel struct{}
+
+func (LogChannel) Name() string { return "log" }
+
+func (LogChannel) Send(a Alert) error {
+	switch a.Kind {
+	case models.SubscriptionPriceDrop:
+		log.Printf("Alert to %s: %q (product %d) price dropped %s -> %s", a.Email, a.ProductName, a.ProductID, a.OldPrice, a.Price)
+	default:
+		log.Printf("Alert to %s: %q (product %d) is back in stock", a.Email, a.ProductName, a.ProductID)
+	}
+	return nil
+}
+
+var (
+	mu      sync.RWMutex
+	current Channel = LogChannel{}
+)
+
+// Configure задаёт канал доставки уведомлений
+func Configure(ch Channel) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = ch
+}
+
+// Current возвращает настроенный канал
+func Current() Channel {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
@@ -0,0 +1,76 @@
+package carriers
+
+import (
+	"sync"
+	"time"
+)
+
+// Статусы отслеживания отправления, по возрастанию
+const (
+	StatusCreated        = "created"
+	StatusInTransit      = "in_transit"
+	StatusOutForDelivery = "out_for_delivery"
+	StatusDelivered      = "delivered"
+)
+
+// StatusRank - порядок статуса отправления; неизвестные статусы не продвигают отправление
+func StatusRank(status string) int {
+	switch status {
+	case StatusCreated:
+		return 1
+	case StatusInTransit:
+		return 2
+	case StatusOutForDelivery:
+		return 3
+	case StatusDelivered:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// ShipmentRequest - данные для регистрации отправления у перевозчика
+type ShipmentRequest struct {
+	OrderID   int
+	Recipient string
+	City      string
+	Address   string
+	Weight    int // граммы
+}
+
+// TrackingEvent - событие в истории отслеживания
+type TrackingEvent struct {
+	Status      string
+	Description string
+	Location    string
+	OccurredAt  time.Time
+}
+
+// Carrier - служба доставки.
+// CreateShipment регистрирует отправление и возвращает трек-номер,
+// Track возвращает всю известную историю событий по трек-номеру.
+type Carrier interface {
+	Name() string
+	CreateShipment(req ShipmentRequest) (string, error)
+	Track(trackingNumber string) ([]TrackingEvent, error)
+}
+
+var (
+	mu       sync.RWMutex
+	carriers = map[string]Carrier{}
+)
+
+// Register добавляет перевозчика
+func Register(c Carrier) {
+	mu.Lock()
+	defer mu.Unlock()
+	carriers[c.Name()] = c
+}
+
+// Get возвращает перевозчика по имени
+func Get(name string) (Carrier, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := carriers[name]
+	return c, ok
+}
@@ -0,0 +1,84 @@
+package carriers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeCarrier - перевозчик для разработки и тестов без сети.
+// События по трек-номеру добавляются вызовом Push (из тестов или через админский API),
+// а Track отдаёт их так же, как это делал бы настоящий перевозчик.
+type FakeCarrier struct {
+	mu     sync.Mutex
+	events map[string][]TrackingEvent
+	now    func() time.Time
+}
+
+func NewFakeCarrier() *FakeCarrier {
+	return &FakeCarrier{
+		events: map[string][]TrackingEvent{},
+		now:    time.Now,
+	}
+}
+
+func (f *FakeCarrier) Name() string {
+	return "fake"
+}
+
+func (f *FakeCarrier) CreateShipment(req ShipmentRequest) (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	number := "FAKE" + strings.ToUpper(hex.EncodeToString(buf))
+
+	f.Push(number, TrackingEvent{Status: StatusCreated, Description: "Отправление зарегистрировано"})
+	return number, nil
+}
+
+func (f *FakeCarrier) Track(trackingNumber string) ([]TrackingEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// События хранятся в памяти, после перезапуска история по старым трек-номерам пуста
+	return append([]TrackingEvent(nil), f.events[trackingNumber]...), nil
+}
+
+// Push добавляет событие отслеживания; пустое время события заменяется текущим
+func (f *FakeCarrier) Push(trackingNumber string, event TrackingEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = f.now()
+	}
+	f.events[trackingNumber] = append(f.events[trackingNumber], event)
+}
+
+// Advance добавляет следующее по порядку событие (created -> in_transit -> out_for_delivery -> delivered)
+// и возвращает его статус; для доставленного отправления ничего не делает.
+func (f *FakeCarrier) Advance(trackingNumber string) string {
+	f.mu.Lock()
+	last := ""
+	if events := f.events[trackingNumber]; len(events) > 0 {
+		last = events[len(events)-1].Status
+	}
+	f.mu.Unlock()
+
+	next := map[string]TrackingEvent{
+		"":                   {Status: StatusCreated, Description: "Отправление зарегистрировано"},
+		StatusCreated:        {Status: StatusInTransit, Description: "Отправление в пути", Location: "Сортировочный центр"},
+		StatusInTransit:      {Status: StatusOutForDelivery, Description: "Передано курьеру"},
+		StatusOutForDelivery: {Status: StatusDelivered, Description: "Вручено получателю"},
+	}
+	event, ok := next[last]
+	if !ok {
+		return last
+	}
+
+	f.Push(trackingNumber, event)
+	return event.Status
+}
@@ -0,0 +1,91 @@
+package carriers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusRank(t *testing.T) {
+	order := []string{StatusCreated, StatusInTransit, StatusOutForDelivery, StatusDelivered}
+	for i := 1; i < len(order); i++ {
+		if StatusRank(order[i-1]) >= StatusRank(order[i]) {
+			t.Errorf("StatusRank(%q) >= StatusRank(%q)", order[i-1], order[i])
+		}
+	}
+	for _, status := range []string{"", "lost", "DELIVERED"} {
+		if rank := StatusRank(status); rank != 0 {
+			t.Errorf("StatusRank(%q) = %d, want 0", status, rank)
+		}
+	}
+}
+
+func TestFakeCreateShipment(t *testing.T) {
+	f := NewFakeCarrier()
+
+	number, err := f.CreateShipment(ShipmentRequest{OrderID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(number, "FAKE") {
+		t.Errorf("tracking number %q, want FAKE prefix", number)
+	}
+
+	events, err := f.Track(number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Status != StatusCreated || events[0].OccurredAt.IsZero() {
+		t.Errorf("events = %+v, want one created event", events)
+	}
+}
+
+func TestFakePushAndTrack(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := NewFakeCarrier()
+	f.now = func() time.Time { return now }
+
+	at := now.Add(-time.Hour)
+	f.Push("T1", TrackingEvent{Status: StatusInTransit, OccurredAt: at})
+	f.Push("T1", TrackingEvent{Status: StatusDelivered})
+
+	events, err := f.Track("T1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if !events[0].OccurredAt.Equal(at) {
+		t.Errorf("explicit time replaced: %v", events[0].OccurredAt)
+	}
+	if !events[1].OccurredAt.Equal(now) {
+		t.Errorf("empty time = %v, want %v", events[1].OccurredAt, now)
+	}
+
+	// Track отдаёт копию: изменения результата не портят историю
+	events[0].Status = "changed"
+	if again, _ := f.Track("T1"); again[0].Status != StatusInTransit {
+		t.Error("Track returned the internal slice")
+	}
+
+	if events, _ := f.Track("unknown"); len(events) != 0 {
+		t.Errorf("unknown tracking number has events: %+v", events)
+	}
+}
+
+func TestFakeAdvance(t *testing.T) {
+	f := NewFakeCarrier()
+
+	want := []string{StatusCreated, StatusInTransit, StatusOutForDelivery, StatusDelivered, StatusDelivered}
+	for i, status := range want {
+		if got := f.Advance("T1"); got != status {
+			t.Errorf("step %d: Advance = %q, want %q", i, got, status)
+		}
+	}
+
+	events, _ := f.Track("T1")
+	if len(events) != 4 {
+		t.Errorf("got %d events, want 4: delivered shipment must not advance", len(events))
+	}
+}
@@ -0,0 +1,127 @@
+package currency
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"myAPI/models"
+	"strconv"
+	"strings"
+)
+
+// Base - валюта, в которой хранятся все цены и принимаются платежи
+const Base = "RUB"
+
+// MaxDecimals - суммы хранятся в сотых долях единицы, поэтому точнее двух знаков округлять нельзя
+const MaxDecimals = 2
+
+// NormalizeCode приводит код валюты к виду ISO 4217 ("usd " -> "USD")
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidCode - трёхбуквенный код ISO 4217
+func ValidCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate проверяет курс перед сохранением
+func Validate(c models.Currency) error {
+	if !ValidCode(c.Code) {
+		return fmt.Errorf("code must be a 3-letter ISO 4217 code")
+	}
+	if c.Code == Base {
+		return fmt.Errorf("%s is the base currency and has no rate", Base)
+	}
+	if c.Rate <= 0 || math.IsInf(c.Rate, 0) || math.IsNaN(c.Rate) {
+		return fmt.Errorf("rate must be positive")
+	}
+	if c.Decimals < 0 || c.Decimals > MaxDecimals {
+		return fmt.Errorf("decimals must be between 0 and %d", MaxDecimals)
+	}
+	return nil
+}
+
+// Convert переводит сумму в рублях в валюту по курсу rate (рублей за единицу валюты)
+// и округляет half-up до decimals знаков: для валют без дробной части - до целых.
+// Результат по-прежнему в сотых долях, чтобы формат сумм в JSON не зависел от валюты.
+func Convert(m models.Money, rate float64, decimals int) models.Money {
+	if rate <= 0 {
+		return m
+	}
+	step := math.Pow10(MaxDecimals - min(max(decimals, 0), MaxDecimals))
+	return models.Money(math.Round(float64(m)/rate/step) * step)
+}
+
+// ToBase переводит сумму в валюте обратно в рубли - для фильтров по цене, заданных в валюте
+func ToBase(amount float64, rate float64) models.Money {
+	return models.MoneyFromFloat(amount * rate)
+}
+
+// ParseRates читает курсы из CSV: code,rate[,decimals][,name].
+// Строка заголовка пропускается. Файлы из Excel с разделителем ";" тоже принимаются,
+// в них десятичный разделитель курса может быть запятой.
+func ParseRates(r io.Reader) ([]models.Currency, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if firstLine, _, _ := strings.Cut(string(data), "\n"); strings.Contains(firstLine, ";") {
+		reader.Comma = ';'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	var rates []models.Currency
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "code") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected code and rate", i+1)
+		}
+
+		c := models.Currency{
+			Code:     NormalizeCode(record[0]),
+			Decimals: MaxDecimals,
+		}
+		c.Rate, err = strconv.ParseFloat(strings.Replace(strings.TrimSpace(record[1]), ",", ".", 1), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate %q", i+1, record[1])
+		}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			c.Decimals, err = strconv.Atoi(strings.TrimSpace(record[2]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid decimals %q", i+1, record[2])
+			}
+		}
+		if len(record) > 3 {
+			c.Name = strings.TrimSpace(record[3])
+		}
+		if err := Validate(c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rates = append(rates, c)
+	}
+
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no rates in file")
+	}
+	return rates, nil
+}
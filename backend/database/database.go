@@ -1,8 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 
 	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
@@ -50,7 +53,7 @@ func createTables() {
 	CREATE TABLE IF NOT EXISTS products (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
-		price REAL NOT NULL,
+		price INTEGER NOT NULL,
 		short_description TEXT,
 		long_description TEXT,
 		sku TEXT UNIQUE NOT NULL,
@@ -86,10 +89,10 @@ func createTables() {
 	orderTable := `
 	CREATE TABLE IF NOT EXISTS orders (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
+		user_id INTEGER,
 		product_ids TEXT NOT NULL,
 		status TEXT DEFAULT 'новый',
-		price REAL DEFAULT 0,
+		price INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);`
@@ -110,7 +113,7 @@ func createTables() {
 		user_id INTEGER NOT NULL,
 		product_id INTEGER NOT NULL,
 		quantity INTEGER NOT NULL DEFAULT 1,
-		price REAL DEFAULT 0,
+		price INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(user_id, product_id),
@@ -118,15 +121,436 @@ func createTables() {
 		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
 	);`
 
-	favoritesTable := `
-	CREATE TABLE IF NOT EXISTS favorites (
-		user_id INTEGER PRIMARY KEY,
-		product_ids TEXT,
+	// Избранное: по строке на товар; удалённые товары и пользователи убираются каскадно
+	favoriteProductsTable := `
+	CREATE TABLE IF NOT EXISTS favorite_products (
+		user_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, product_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	// Просмотры товаров: user_id для авторизованных, visitor_id для анонимных посетителей
+	productViewsTable := `
+	CREATE TABLE IF NOT EXISTS product_views (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		user_id INTEGER,
+		visitor_id TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// Промокоды: category_ids и product_ids - JSON массивы ограничений (пустые - без ограничений)
+	couponTable := `
+	CREATE TABLE IF NOT EXISTS coupons (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT UNIQUE NOT NULL,
+		type TEXT NOT NULL DEFAULT 'percent' CHECK (type IN ('percent', 'fixed')),
+		value INTEGER NOT NULL DEFAULT 0,
+		min_order_total INTEGER DEFAULT 0,
+		category_ids TEXT DEFAULT '[]',
+		product_ids TEXT DEFAULT '[]',
+		starts_at DATETIME,
+		ends_at DATETIME,
+		usage_limit INTEGER DEFAULT 0,
+		per_user_limit INTEGER DEFAULT 0,
+		stackable INTEGER DEFAULT 0,
+		active INTEGER DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	couponUsageTable := `
+	CREATE TABLE IF NOT EXISTS coupon_usages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		coupon_id INTEGER NOT NULL,
+		user_id INTEGER,
+		order_id INTEGER NOT NULL,
+		discount INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (coupon_id) REFERENCES coupons(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+	);`
+
+	// Запланированные изменения цены/скидки (NULL - значение не меняется)
+	priceScheduleTable := `
+	CREATE TABLE IF NOT EXISTS price_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		price INTEGER,
+		discount INTEGER,
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME,
+		status TEXT NOT NULL DEFAULT 'pending',
+		prev_price INTEGER,
+		prev_discount INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	priceHistoryTable := `
+	CREATE TABLE IF NOT EXISTS price_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		price INTEGER NOT NULL,
+		discount INTEGER DEFAULT 0,
+		final_price INTEGER NOT NULL,
+		source TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	paymentTable := `
+	CREATE TABLE IF NOT EXISTS payments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		external_id TEXT UNIQUE NOT NULL,
+		amount INTEGER NOT NULL,
+		refunded_amount INTEGER DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'pending',
+		confirmation_url TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+	);`
+
+	// Ключи идемпотентности: status_code IS NULL, пока первый запрос ещё выполняется
+	idempotencyTable := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scope TEXT UNIQUE NOT NULL,
+		request_hash TEXT NOT NULL,
+		status_code INTEGER,
+		content_type TEXT,
+		response_body BLOB,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Позиции заказа с ценой за единицу на момент покупки
+	orderItemsTable := `
+	CREATE TABLE IF NOT EXISTS order_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		price INTEGER NOT NULL,
+		list_price INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+	);`
+
+	// Заявки на возврат: requested -> approved|rejected, approved -> received -> refunded
+	returnRequestsTable := `
+	CREATE TABLE IF NOT EXISTS return_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		photos TEXT DEFAULT '[]',
+		status TEXT NOT NULL DEFAULT 'requested',
+		refund_amount INTEGER DEFAULT 0,
+		admin_comment TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	returnItemsTable := `
+	CREATE TABLE IF NOT EXISTS return_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		return_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		price INTEGER NOT NULL,
+		FOREIGN KEY (return_id) REFERENCES return_requests(id) ON DELETE CASCADE
+	);`
+
+	// Способы доставки; regions - JSON-массив регионов, пустой - доставка во все регионы
+	shippingMethodsTable := `
+	CREATE TABLE IF NOT EXISTS shipping_methods (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		base_cost INTEGER DEFAULT 0,
+		cost_per_kg INTEGER DEFAULT 0,
+		free_from INTEGER DEFAULT 0,
+		min_order_total INTEGER DEFAULT 0,
+		max_weight INTEGER DEFAULT 0,
+		regions TEXT DEFAULT '[]',
+		active BOOLEAN DEFAULT 1,
+		sort_order INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Адресная книга пользователей
+	addressesTable := `
+	CREATE TABLE IF NOT EXISTS addresses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		recipient TEXT NOT NULL,
+		phone TEXT NOT NULL,
+		city TEXT NOT NULL,
+		street TEXT NOT NULL,
+		building TEXT NOT NULL,
+		apartment TEXT,
+		postcode TEXT,
+		comment TEXT,
+		is_default BOOLEAN DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// Отправления заказов и история их отслеживания
+	shipmentsTable := `
+	CREATE TABLE IF NOT EXISTS shipments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		carrier TEXT NOT NULL,
+		tracking_number TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'created',
+		shipped_at DATETIME,
+		delivered_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+	);`
+
+	trackingEventsTable := `
+	CREATE TABLE IF NOT EXISTS tracking_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		shipment_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		description TEXT,
+		location TEXT,
+		occurred_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(shipment_id, status, occurred_at),
+		FOREIGN KEY (shipment_id) REFERENCES shipments(id) ON DELETE CASCADE
+	);`
+
+	// Очередь писем: pending -> sent | failed, неудачные попытки повторяются с растущей задержкой
+	emailQueueTable := `
+	CREATE TABLE IF NOT EXISTS email_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		template TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at DATETIME NOT NULL,
+		sent_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Токены сброса пароля хранятся в виде SHA-256 хеша
+	passwordResetsTable := `
+	CREATE TABLE IF NOT EXISTS password_resets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// Ссылки для подтверждения email; после подтверждения к аккаунту привязываются гостевые заказы
+	emailVerificationsTable := `
+	CREATE TABLE IF NOT EXISTS email_verifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// Сообщения сотрудникам в Telegram, отправляются в фоне так же, как письма
+	telegramMessagesTable := `
+	CREATE TABLE IF NOT EXISTS telegram_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id TEXT NOT NULL,
+		text TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at DATETIME NOT NULL,
+		sent_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Журнал баллов лояльности. Положительные записи - партии баллов со сроком сгорания:
+	// remaining уменьшается при списаниях (сначала сгорающие раньше), остаток сгорает по expires_at.
+	// admin_id и reason фиксируют ручные корректировки.
+	loyaltyTransactionsTable := `
+	CREATE TABLE IF NOT EXISTS loyalty_transactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		order_id INTEGER,
+		type TEXT NOT NULL,
+		points INTEGER NOT NULL,
+		remaining INTEGER NOT NULL DEFAULT 0,
+		balance_after INTEGER NOT NULL,
+		expires_at DATETIME,
+		reason TEXT,
+		admin_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// Из каких партий ушли баллы при списании: по этим записям возврат баллов за отменённый
+	// заказ восстанавливает исходные партии с их сроком сгорания, а не выпускает новую
+	loyaltyLotUsagesTable := `
+	CREATE TABLE IF NOT EXISTS loyalty_lot_usages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		transaction_id INTEGER NOT NULL,
+		lot_id INTEGER NOT NULL,
+		points INTEGER NOT NULL,
+		FOREIGN KEY (transaction_id) REFERENCES loyalty_transactions(id) ON DELETE CASCADE,
+		FOREIGN KEY (lot_id) REFERENCES loyalty_transactions(id) ON DELETE CASCADE
+	);`
+
+	// Подарочные карты: выпускаются при оплате заказа с товаром-сертификатом или администратором.
+	// balance уменьшается при оплате заказов картой; все изменения баланса - в gift_card_transactions
+	giftCardsTable := `
+	CREATE TABLE IF NOT EXISTS gift_cards (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT UNIQUE NOT NULL,
+		initial_balance INTEGER NOT NULL,
+		balance INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'active',
+		expires_at DATETIME NOT NULL,
+		order_id INTEGER,
+		product_id INTEGER,
+		recipient_email TEXT,
+		note TEXT,
+		issued_by INTEGER,
+		voided_at DATETIME,
+		void_reason TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	);`
+
+	giftCardTransactionsTable := `
+	CREATE TABLE IF NOT EXISTS gift_card_transactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		gift_card_id INTEGER NOT NULL,
+		order_id INTEGER,
+		type TEXT NOT NULL,
+		amount INTEGER NOT NULL,
+		balance_after INTEGER NOT NULL,
+		reason TEXT,
+		admin_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (gift_card_id) REFERENCES gift_cards(id)
+	);`
+
+	// Состав наборов: bundle_id - товар-набор, product_id - входящий в него товар
+	bundleItemsTable := `
+	CREATE TABLE IF NOT EXISTS bundle_items (
+		bundle_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (bundle_id, product_id),
+		FOREIGN KEY (bundle_id) REFERENCES products(id) ON DELETE CASCADE,
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	);`
+
+	// Курсы валют для отображения цен: rate - сколько рублей стоит единица валюты,
+	// decimals - до скольких знаков округлять суммы в этой валюте
+	currencyRatesTable := `
+	CREATE TABLE IF NOT EXISTS currency_rates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT UNIQUE NOT NULL,
+		name TEXT,
+		rate REAL NOT NULL,
+		decimals INTEGER NOT NULL DEFAULT 2,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Подписки покупателей на поступление товара и снижение цены. price - цена на момент
+	// подписки или последнего уведомления о снижении, notified_at - когда ушло уведомление
+	productSubscriptionsTable := `
+	CREATE TABLE IF NOT EXISTS product_subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		price INTEGER NOT NULL DEFAULT 0,
+		notified_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, product_id, kind),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	// Именованные списки желаний; share_token задан, если список опубликован по ссылке
+	wishlistsTable := `
+	CREATE TABLE IF NOT EXISTS wishlists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		share_token TEXT UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);`
 
-	tables := []string{userTable, categoryTable, productTable, reviewTable, newsTable, orderTable, bannerTable, cartItemsTable, favoritesTable}
+	// Товары в списках желаний; удалённые товары пропадают из списков каскадно
+	wishlistItemsTable := `
+	CREATE TABLE IF NOT EXISTS wishlist_items (
+		wishlist_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		note TEXT,
+		added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (wishlist_id, product_id),
+		FOREIGN KEY (wishlist_id) REFERENCES wishlists(id) ON DELETE CASCADE,
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+	);`
+
+	// Подписки на исходящие вебхуки; events - JSON-массив событий
+	webhooksTable := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '[]',
+		description TEXT,
+		active BOOLEAN DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Журнал доставок вебхуков с ответами получателей
+	webhookDeliveriesTable := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER,
+		response_body TEXT,
+		last_error TEXT,
+		next_attempt_at DATETIME NOT NULL,
+		delivered_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+	);`
+
+	tables := []string{userTable, categoryTable, productTable, reviewTable, newsTable, orderTable, bannerTable, cartItemsTable, favoriteProductsTable, productViewsTable, couponTable, couponUsageTable, priceScheduleTable, priceHistoryTable, paymentTable, idempotencyTable, orderItemsTable, returnRequestsTable, returnItemsTable, shippingMethodsTable, addressesTable, shipmentsTable, trackingEventsTable, emailQueueTable, passwordResetsTable, emailVerificationsTable, telegramMessagesTable, webhooksTable, webhookDeliveriesTable, loyaltyTransactionsTable, loyaltyLotUsagesTable, giftCardsTable, giftCardTransactionsTable, currencyRatesTable, bundleItemsTable, productSubscriptionsTable, wishlistsTable, wishlistItemsTable}
 
 	for _, table := range tables {
 		_, err := DB.Exec(table)
@@ -141,15 +565,67 @@ func createTables() {
 		"ALTER TABLE users ADD COLUMN phone TEXT",
 		"ALTER TABLE users ADD COLUMN delivery_address TEXT",
 		"ALTER TABLE users ADD COLUMN role TEXT",
+		"ALTER TABLE users ADD COLUMN language TEXT", // язык писем: ru или en
+		"ALTER TABLE users ADD COLUMN email_verified_at DATETIME",
 	}
 
 	// Попытаться добавить новые колонки в таблицы orders и cart_items (игнорируем ошибки)
 	alterOrderTable := []string{
-		"ALTER TABLE orders ADD COLUMN price REAL DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN price INTEGER DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN coupon_code TEXT",
+		"ALTER TABLE orders ADD COLUMN coupon_discount INTEGER DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN refunded_amount INTEGER DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN shipping_method TEXT",
+		"ALTER TABLE orders ADD COLUMN shipping_cost INTEGER DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN shipping_region TEXT",
+		"ALTER TABLE orders ADD COLUMN delivery_address TEXT", // JSON-снимок адреса на момент заказа
+		// Сквозной номер счёта присваивается при оплате заказа
+		"ALTER TABLE orders ADD COLUMN invoice_number INTEGER",
+		"ALTER TABLE orders ADD COLUMN invoiced_at DATETIME",
+		// Цена позиции без скидки товара - для отображения скидки в счёте
+		"ALTER TABLE order_items ADD COLUMN list_price INTEGER DEFAULT 0",
+		// Гостевой заказ: контакты покупателя хранятся в заказе, доступ - по секретному токену
+		"ALTER TABLE orders ADD COLUMN guest_email TEXT",
+		"ALTER TABLE orders ADD COLUMN guest_name TEXT",
+		"ALTER TABLE orders ADD COLUMN guest_phone TEXT",
+		"ALTER TABLE orders ADD COLUMN guest_language TEXT",
+		"ALTER TABLE orders ADD COLUMN lookup_token_hash TEXT",
+		// Часть заказа, оплаченная баллами лояльности
+		"ALTER TABLE orders ADD COLUMN loyalty_points INTEGER DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN loyalty_discount INTEGER DEFAULT 0",
+		// Часть заказа, оплаченная подарочной картой
+		"ALTER TABLE orders ADD COLUMN gift_card_id INTEGER",
+		"ALTER TABLE orders ADD COLUMN gift_card_amount INTEGER DEFAULT 0",
+		// Налог: режим цен на момент заказа, сумма налога по заказу, по доставке и по каждой позиции
+		"ALTER TABLE orders ADD COLUMN tax_mode TEXT",
+		"ALTER TABLE orders ADD COLUMN tax_amount INTEGER DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN shipping_tax_rate INTEGER DEFAULT 0",
+		"ALTER TABLE orders ADD COLUMN shipping_tax INTEGER DEFAULT 0",
+		"ALTER TABLE order_items ADD COLUMN tax_rate INTEGER DEFAULT 0",
+		"ALTER TABLE order_items ADD COLUMN tax_amount INTEGER DEFAULT 0",
+		// Ставка налога категории в процентах; NULL - ставка магазина по умолчанию
+		"ALTER TABLE categories ADD COLUMN tax_rate INTEGER",
+		// Валюта, выбранная покупателем при оформлении, и курс на тот момент; оплата всегда в рублях
+		"ALTER TABLE orders ADD COLUMN currency TEXT",
+		"ALTER TABLE orders ADD COLUMN exchange_rate REAL",
+		// Компоненты проданного набора - отдельные строки позиций со ссылкой на строку набора
+		"ALTER TABLE order_items ADD COLUMN parent_id INTEGER REFERENCES order_items(id)",
+		// Email покупателя в нижнем регистре: лимит промокода на покупателя действует и для гостей
+		"ALTER TABLE coupon_usages ADD COLUMN email TEXT",
 	}
 
 	alterCartItems := []string{
-		"ALTER TABLE cart_items ADD COLUMN price REAL DEFAULT 0",
+		"ALTER TABLE cart_items ADD COLUMN price INTEGER DEFAULT 0",
+	}
+
+	// Счётчик просмотров для сортировки по популярности, остаток на складе (NULL - не учитывается) и вес в граммах
+	alterProductTable := []string{
+		"ALTER TABLE products ADD COLUMN view_count INTEGER DEFAULT 0",
+		"ALTER TABLE products ADD COLUMN stock INTEGER",
+		"ALTER TABLE products ADD COLUMN weight INTEGER DEFAULT 0",
+		// Товар-сертификат: при оплате заказа выпускается подарочная карта на его цену
+		"ALTER TABLE products ADD COLUMN gift_card BOOLEAN DEFAULT 0",
+		"ALTER TABLE products ADD COLUMN bundle_discount INTEGER", // скидка набора в % от суммы компонентов; NULL - своя цена
 	}
 
 	for _, alter := range alterUserTable {
@@ -163,4 +639,292 @@ func createTables() {
 	for _, alter := range alterCartItems {
 		DB.Exec(alter)
 	}
+
+	for _, alter := range alterProductTable {
+		DB.Exec(alter)
+	}
+
+	migrateMoneyColumns()
+
+	if err := migrateFavorites(); err != nil {
+		log.Fatal("Failed to migrate favorites:", err)
+	}
+
+	// Гостевой заказ и использование промокода в нём хранятся без пользователя (user_id IS NULL)
+	for _, tc := range []struct{ table, column string }{{"orders", "user_id"}, {"coupon_usages", "user_id"}} {
+		if err := dropNotNull(tc.table, tc.column); err != nil {
+			log.Fatalf("Failed to make %s.%s nullable: %v", tc.table, tc.column, err)
+		}
+	}
+
+	if _, err := DB.Exec(`
+		UPDATE coupon_usages SET email = (
+			SELECT LOWER(TRIM(COALESCE(o.guest_email, u.email))) FROM orders o LEFT JOIN users u ON u.id = o.user_id WHERE o.id = coupon_usages.order_id
+		) WHERE email IS NULL
+	`); err != nil {
+		log.Fatal("Failed to fill coupon_usages.email:", err)
+	}
+
+	// У заказа не больше одного незавершённого платежа: более старые дубли считаются неуспешными
+	if _, err := DB.Exec(`
+		UPDATE payments SET status = 'failed'
+		WHERE status = 'pending' AND id NOT IN (SELECT MAX(id) FROM payments WHERE status = 'pending' GROUP BY order_id)
+	`); err != nil {
+		log.Fatal("Failed to clean up pending payments:", err)
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_product_views_user_id ON product_views(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_product_views_visitor_id ON product_views(visitor_id)",
+		"CREATE INDEX IF NOT EXISTS idx_coupon_usages_coupon_id ON coupon_usages(coupon_id)",
+		"CREATE INDEX IF NOT EXISTS idx_price_history_product_id ON price_history(product_id)",
+		"CREATE INDEX IF NOT EXISTS idx_payments_order_id ON payments(order_id)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_order_pending ON payments(order_id) WHERE status = 'pending'",
+		"CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id)",
+		"CREATE INDEX IF NOT EXISTS idx_bundle_items_product ON bundle_items(product_id)",
+		"CREATE INDEX IF NOT EXISTS idx_product_subscriptions_product ON product_subscriptions(product_id)",
+		"CREATE INDEX IF NOT EXISTS idx_wishlists_user_id ON wishlists(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_wishlist_items_product ON wishlist_items(product_id)",
+		"CREATE INDEX IF NOT EXISTS idx_favorite_products_product ON favorite_products(product_id)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_invoice_number ON orders(invoice_number)",
+		"CREATE INDEX IF NOT EXISTS idx_return_requests_order_id ON return_requests(order_id)",
+		"CREATE INDEX IF NOT EXISTS idx_return_items_return_id ON return_items(return_id)",
+		"CREATE INDEX IF NOT EXISTS idx_addresses_user_id ON addresses(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_shipments_order_id ON shipments(order_id)",
+		"CREATE INDEX IF NOT EXISTS idx_tracking_events_shipment_id ON tracking_events(shipment_id)",
+		"CREATE INDEX IF NOT EXISTS idx_email_queue_status ON email_queue(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_telegram_messages_status ON telegram_messages(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_loyalty_transactions_user ON loyalty_transactions(user_id, expires_at)",
+		"CREATE INDEX IF NOT EXISTS idx_loyalty_transactions_order ON loyalty_transactions(order_id)",
+		"CREATE INDEX IF NOT EXISTS idx_loyalty_lot_usages_transaction ON loyalty_lot_usages(transaction_id)",
+		"CREATE INDEX IF NOT EXISTS idx_gift_cards_order ON gift_cards(order_id)",
+		"CREATE INDEX IF NOT EXISTS idx_gift_card_transactions_card ON gift_card_transactions(gift_card_id)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_lookup_token ON orders(lookup_token_hash)",
+		"CREATE INDEX IF NOT EXISTS idx_orders_guest_email ON orders(guest_email)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id)",
+	}
+
+	for _, index := range indexes {
+		if _, err := DB.Exec(index); err != nil {
+			log.Fatal("Failed to create index:", err)
+		}
+	}
+}
+
+// moneyColumns - денежные колонки, которые хранятся в копейках (INTEGER)
+var moneyColumns = []struct {
+	table  string
+	column string
+}{
+	{"products", "price"},
+	{"orders", "price"},
+	{"orders", "coupon_discount"},
+	{"cart_items", "price"},
+	{"coupons", "min_order_total"},
+	{"coupon_usages", "discount"},
+	{"price_schedules", "price"},
+	{"price_schedules", "prev_price"},
+	{"price_history", "price"},
+	{"price_history", "final_price"},
+}
+
+// migrateMoneyColumns переводит денежные колонки из REAL (рубли) в INTEGER (копейки).
+// Колонки, уже имеющие тип INTEGER, пропускаются, поэтому миграция безопасна при каждом запуске.
+func migrateMoneyColumns() {
+	for _, mc := range moneyColumns {
+		colType, err := columnType(mc.table, mc.column)
+		if err != nil {
+			log.Fatal("Failed to inspect column:", err)
+		}
+		if colType != "REAL" {
+			continue
+		}
+
+		if err := convertMoneyColumn(mc.table, mc.column); err != nil {
+			log.Fatalf("Failed to migrate %s.%s to minor units: %v", mc.table, mc.column, err)
+		}
+		log.Printf("Migrated %s.%s to minor units", mc.table, mc.column)
+	}
+
+	// Фиксированные купоны хранили сумму в рублях в колонке value
+	if colType, err := columnType("coupons", "value"); err == nil && colType == "REAL" {
+		if err := convertMoneyColumn("coupons", "value"); err != nil {
+			log.Fatal("Failed to migrate coupons.value:", err)
+		}
+		// Для процентных купонов значение - это проценты, а не рубли
+		if _, err := DB.Exec("UPDATE coupons SET value = value / 100 WHERE type = 'percent'"); err != nil {
+			log.Fatal("Failed to migrate coupons.value:", err)
+		}
+	}
+}
+
+// migrateFavorites переносит избранное из старой таблицы favorites (JSON-массив product_ids на пользователя)
+// в favorite_products с сохранением порядка. ID удалённых товаров отбрасываются, старая таблица удаляется.
+func migrateFavorites() error {
+	var exists int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'favorites'").Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO favorite_products (user_id, product_id, created_at)
+		SELECT f.user_id, CAST(j.value AS INTEGER), COALESCE(f.updated_at, CURRENT_TIMESTAMP)
+		FROM favorites f, json_each(f.product_ids) j
+		WHERE json_valid(f.product_ids)
+		  AND f.user_id IN (SELECT id FROM users)
+		  AND CAST(j.value AS INTEGER) IN (SELECT id FROM products)
+		ORDER BY f.user_id, j.key
+	`)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DROP TABLE favorites"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	migrated, _ := result.RowsAffected()
+	log.Printf("Migrated %d favorite products to favorite_products", migrated)
+	return nil
+}
+
+// convertMoneyColumn пересоздаёт колонку с типом INTEGER, округляя рубли до копеек (half-up)
+func convertMoneyColumn(table, column string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old := column + "_real"
+	stmts := []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, column, old),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER DEFAULT 0", table, column),
+		fmt.Sprintf("UPDATE %s SET %s = CASE WHEN %s IS NULL THEN NULL ELSE CAST(ROUND(%s * 100) AS INTEGER) END", table, column, old, old),
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, old),
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func columnType(table, column string) (string, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return "", err
+		}
+		if name == column {
+			return strings.ToUpper(colType), nil
+		}
+	}
+
+	return "", rows.Err()
+}
+
+// dropNotNull снимает NOT NULL с INTEGER-колонки. SQLite не умеет менять ограничения колонок,
+// поэтому таблица пересоздаётся по сохранённой схеме с исправленным определением колонки.
+// Индексы таблицы при этом удаляются и создаются заново в createTables.
+func dropNotNull(table, column string) error {
+	var schema string
+	if err := DB.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&schema); err != nil {
+		return err
+	}
+	definition := column + " INTEGER NOT NULL"
+	if !strings.Contains(schema, definition) {
+		return nil
+	}
+
+	columns, err := columnNames(table)
+	if err != nil {
+		return err
+	}
+
+	// PRAGMA foreign_keys действует на соединение и не меняется внутри транзакции,
+	// поэтому вся миграция идёт через одно выделенное соединение
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tmp := table + "_new"
+	newSchema := strings.Replace(schema, definition, column+" INTEGER", 1)
+	newSchema = strings.Replace(newSchema, "CREATE TABLE "+table, "CREATE TABLE "+tmp, 1)
+	list := strings.Join(columns, ", ")
+	stmts := []string{
+		newSchema,
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", tmp, list, list, table),
+		"DROP TABLE " + table,
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tmp, table),
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Made %s.%s nullable", table, column)
+	return nil
+}
+
+func columnNames(table string) ([]string, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
 }
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"log"
+	"myAPI/models"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -127,7 +128,7 @@ func SeedData() {
 			INSERT OR IGNORE INTO products 
 			(name, price, short_description, long_description, sku, discount, images, category_id) 
 			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			prod.name, prod.price, prod.shortDescription, prod.longDescription,
+			prod.name, models.MoneyFromFloat(prod.price), prod.shortDescription, prod.longDescription,
 			prod.sku, prod.discount, string(imagesJSON), prod.categoryID)
 		if err != nil {
 			log.Printf("Failed to insert product %s: %v", prod.name, err)
@@ -213,6 +214,39 @@ func SeedData() {
 		}
 	}
 
+	// Способы доставки по умолчанию (стоимость в рублях, вес в граммах)
+	shippingMethods := []struct {
+		code      string
+		name      string
+		kind      string
+		baseCost  float64
+		costPerKg float64
+		freeFrom  float64
+		maxWeight int
+		regions   []string
+		sortOrder int
+	}{
+		{"courier", "Курьер", "courier", 500, 0, 10000, 0, []string{"Москва", "Санкт-Петербург"}, 1},
+		{"pickup", "Самовывоз из пункта выдачи", "pickup", 0, 0, 0, 5000, nil, 2},
+		{"post", "Почта России", "post", 350, 100, 30000, 20000, nil, 3},
+	}
+
+	for _, m := range shippingMethods {
+		regions := m.regions
+		if regions == nil {
+			regions = []string{}
+		}
+		regionsJSON, _ := json.Marshal(regions)
+		_, err := DB.Exec(`
+			INSERT OR IGNORE INTO shipping_methods (code, name, type, base_cost, cost_per_kg, free_from, max_weight, regions, sort_order)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.code, m.name, m.kind, models.MoneyFromFloat(m.baseCost), models.MoneyFromFloat(m.costPerKg),
+			models.MoneyFromFloat(m.freeFrom), m.maxWeight, string(regionsJSON), m.sortOrder)
+		if err != nil {
+			log.Printf("Failed to insert shipping method %s: %v", m.code, err)
+		}
+	}
+
 	
 	log.Println("Jewelry store data seeded successfully")
 
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAddresses - адресная книга текущего пользователя (адрес по умолчанию первым)
+func GetAddresses(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	rows, err := database.DB.Query("SELECT "+addressColumns+" FROM addresses WHERE user_id = ? ORDER BY is_default DESC, id DESC", userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	addresses := []models.Address{}
+	for rows.Next() {
+		var a models.Address
+		if err := scanAddress(rows, &a); err != nil {
+			continue
+		}
+		addresses = append(addresses, a)
+	}
+
+	return c.JSON(addresses)
+}
+
+// CreateAddress - добавление адреса; первый адрес пользователя становится адресом по умолчанию
+func CreateAddress(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var req models.AddressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	fields, err := normalizeAddress(req.AddressFields)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	id, err := saveAddress(userID, fields, req.IsDefault)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save address"})
+	}
+
+	address, err := getUserAddress(userID, int(id))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch address"})
+	}
+
+	return c.Status(201).JSON(address)
+}
+
+// UpdateAddress - изменение адреса. Заказы хранят свой снимок адреса и не меняются.
+func UpdateAddress(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid address ID"})
+	}
+
+	var req models.AddressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	fields, err := normalizeAddress(req.AddressFields)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if _, err := getUserAddress(userID, id); err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Address not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE addresses
+		SET recipient = ?, phone = ?, city = ?, street = ?, building = ?, apartment = ?, postcode = ?, comment = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`, fields.Recipient, fields.Phone, fields.City, fields.Street, fields.Building, fields.Apartment, fields.Postcode, fields.Comment,
+		time.Now(), id, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update address"})
+	}
+
+	if req.IsDefault {
+		if err := setDefaultAddress(userID, id); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update address"})
+		}
+	}
+
+	address, err := getUserAddress(userID, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch address"})
+	}
+
+	return c.JSON(address)
+}
+
+// MakeDefaultAddress - сделать адрес адресом по умолчанию
+func MakeDefaultAddress(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid address ID"})
+	}
+
+	if _, err := getUserAddress(userID, id); err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Address not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := setDefaultAddress(userID, id); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update address"})
+	}
+
+	address, err := getUserAddress(userID, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch address"})
+	}
+
+	return c.JSON(address)
+}
+
+// DeleteAddress - удаление адреса; если удалён адрес по умолчанию, им становится самый новый из оставшихся
+func DeleteAddress(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid address ID"})
+	}
+
+	address, err := getUserAddress(userID, id)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Address not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM addresses WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete address"})
+	}
+
+	if address.IsDefault {
+		var nextID int
+		err := database.DB.QueryRow("SELECT id FROM addresses WHERE user_id = ? ORDER BY id DESC LIMIT 1", userID).Scan(&nextID)
+		if err == nil {
+			setDefaultAddress(userID, nextID)
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// orderAddress определяет снимок адреса для заказа: адрес из книги по address_id,
+// переданный объект address или (для старых клиентов) строка delivery_address.
+// Ошибки валидации возвращаются как *fiber.Error.
+func orderAddress(userID, addressID int, inline *models.AddressFields, name, phone, legacy string) (*models.AddressFields, error) {
+	if addressID > 0 {
+		address, err := getUserAddress(userID, addressID)
+		if err == sql.ErrNoRows {
+			return nil, fiber.NewError(400, "Address not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshot := address.AddressFields
+		return &snapshot, nil
+	}
+
+	if inline != nil {
+		fields, err := normalizeAddress(*inline)
+		if err != nil {
+			return nil, err
+		}
+		return &fields, nil
+	}
+
+	if strings.TrimSpace(legacy) != "" {
+		return &models.AddressFields{
+			Recipient: strings.TrimSpace(name),
+			Phone:     strings.TrimSpace(phone),
+			Street:    strings.TrimSpace(legacy),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// rememberOrderAddress сохраняет новый адрес из заказа в адресную книгу, если такого ещё нет
+func rememberOrderAddress(userID int, fields models.AddressFields) {
+	var exists int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM addresses
+		WHERE user_id = ? AND recipient = ? AND phone = ? AND city = ? AND street = ? AND building = ? AND apartment = ?
+	`, userID, fields.Recipient, fields.Phone, fields.City, fields.Street, fields.Building, fields.Apartment).Scan(&exists)
+	if err != nil || exists > 0 {
+		return
+	}
+
+	if _, err := saveAddress(userID, fields, false); err != nil {
+		log.Printf("Failed to save address for user %d: %v", userID, err)
+	}
+}
+
+// normalizeAddress обрезает пробелы и проверяет обязательные поля
+func normalizeAddress(a models.AddressFields) (models.AddressFields, error) {
+	a.Recipient = strings.TrimSpace(a.Recipient)
+	a.Phone = strings.TrimSpace(a.Phone)
+	a.City = strings.TrimSpace(a.City)
+	a.Street = strings.TrimSpace(a.Street)
+	a.Building = strings.TrimSpace(a.Building)
+	a.Apartment = strings.TrimSpace(a.Apartment)
+	a.Postcode = strings.TrimSpace(a.Postcode)
+	a.Comment = strings.TrimSpace(a.Comment)
+
+	if a.Recipient == "" || a.Phone == "" || a.City == "" || a.Street == "" || a.Building == "" {
+		return a, fiber.NewError(400, "Recipient, phone, city, street and building are required")
+	}
+
+	return a, nil
+}
+
+// saveAddress добавляет адрес; первый адрес пользователя всегда становится адресом по умолчанию
+func saveAddress(userID int, fields models.AddressFields, isDefault bool) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM addresses WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		isDefault = true
+	}
+	if isDefault {
+		if _, err := tx.Exec("UPDATE addresses SET is_default = 0 WHERE user_id = ?", userID); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO addresses (user_id, recipient, phone, city, street, building, apartment, postcode, comment, is_default, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, fields.Recipient, fields.Phone, fields.City, fields.Street, fields.Building, fields.Apartment, fields.Postcode,
+		fields.Comment, isDefault, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func setDefaultAddress(userID, id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE addresses SET is_default = 0 WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE addresses SET is_default = 1, updated_at = ? WHERE id = ? AND user_id = ?", time.Now(), id, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const addressColumns = `id, user_id, recipient, phone, city, street, building, COALESCE(apartment, ''), COALESCE(postcode, ''),
+	       COALESCE(comment, ''), is_default, created_at, updated_at`
+
+func scanAddress(row interface{ Scan(...interface{}) error }, a *models.Address) error {
+	return row.Scan(&a.ID, &a.UserID, &a.Recipient, &a.Phone, &a.City, &a.Street, &a.Building, &a.Apartment, &a.Postcode,
+		&a.Comment, &a.IsDefault, &a.CreatedAt, &a.UpdatedAt)
+}
+
+func getUserAddress(userID, id int) (*models.Address, error) {
+	var a models.Address
+	row := database.DB.QueryRow("SELECT "+addressColumns+" FROM addresses WHERE id = ? AND user_id = ?", id, userID)
+	if err := scanAddress(row, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"myAPI/database"
+	"myAPI/models"
+	"myAPI/payments"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -47,7 +51,7 @@ func AdminBackup(c *fiber.Ctx) error {
 // AdminListBackups - получить список доступных бэкапов
 func AdminListBackups(c *fiber.Ctx) error {
 	backupDir := "backups"
-	
+
 	// Если папка не существует, создадим её
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to create backup dir"})
@@ -153,7 +157,6 @@ func AdminRestoreBackup(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"success": true, "message": "backup restored successfully"})
 }
 
-
 func AdminCreateProduct(c *fiber.Ctx) error {
 	// Parse incoming body as generic map to be tolerant to different client payload shapes
 	var body map[string]interface{}
@@ -163,33 +166,74 @@ func AdminCreateProduct(c *fiber.Ctx) error {
 
 	id, err := createProduct(body)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to create product"})
+		if e, ok := err.(*fiber.Error); ok {
+			return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+		}
+		log.Printf("Failed to create product: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create product"})
 	}
 
 	body["id"] = id
 	return c.Status(201).JSON(body)
 }
 
-// AdminGetResource - получить все записи ресурса
+// AdminGetResource - записи ресурса с фильтрами, сортировкой и постраничным выводом
+// (параметры - в parseAdminListQuery); total - число записей под фильтрами
 func AdminGetResource(c *fiber.Ctx) error {
 	resource := c.Params("resource")
 
+	list, ok := adminLists[resource]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Unknown resource"})
+	}
+	q, err := parseAdminListQuery(c, list)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
 	var items []map[string]interface{}
-	var err error
 
 	switch resource {
 	case "products":
-		items, err = getProductsForAdmin()
+		items, err = getProductsForAdmin(q)
 	case "categories":
-		items, err = getCategoriesForAdmin()
+		items, err = getCategoriesForAdmin(q)
 	case "orders":
-		items, err = getOrdersForAdmin()
+		items, err = getOrdersForAdmin(q)
 	case "news":
-		items, err = getNewsForAdmin()
+		items, err = getNewsForAdmin(q)
 	case "banners":
-		items, err = getBannersForAdmin()
+		items, err = getBannersForAdmin(q)
 	case "users":
-		items, err = getUsersForAdmin()
+		items, err = getUsersForAdmin(q)
+	case "coupons":
+		items, err = getCouponsForAdmin(q)
+	case "price_schedules":
+		items, err = getPriceSchedulesForAdmin(q)
+	case "payments":
+		items, err = getPaymentsForAdmin(q)
+	case "returns":
+		items, err = getReturnsForAdmin(q)
+	case "shipping_methods":
+		items, err = getShippingMethodsForAdmin(q)
+	case "shipments":
+		items, err = getShipmentsForAdmin(q)
+	case "emails":
+		items, err = getEmailsForAdmin(q)
+	case "telegram_messages":
+		items, err = getTelegramMessagesForAdmin(q)
+	case "webhooks":
+		items, err = getWebhooksForAdmin(q)
+	case "webhook_deliveries":
+		items, err = getWebhookDeliveriesForAdmin(q)
+	case "loyalty_transactions":
+		items, err = getLoyaltyTransactionsForAdmin(q)
+	case "gift_cards":
+		items, err = getGiftCardsForAdmin(q)
+	case "currencies":
+		items, err = getCurrenciesForAdmin(q)
+	case "product_subscriptions":
+		items, err = getProductSubscriptionsForAdmin(q)
 	default:
 		return c.Status(400).JSON(fiber.Map{"error": "Unknown resource"})
 	}
@@ -202,7 +246,12 @@ func AdminGetResource(c *fiber.Ctx) error {
 		items = []map[string]interface{}{}
 	}
 
-	return c.JSON(fiber.Map{"data": items})
+	total, err := q.count()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"data": items, "total": total, "page": q.page, "page_size": q.pageSize})
 }
 
 // AdminCreateResource - создать новую запись ресурса
@@ -230,12 +279,27 @@ func AdminCreateResource(c *fiber.Ctx) error {
 		id, err = createBanner(body)
 	case "users":
 		id, err = createUser(body)
+	case "coupons":
+		id, err = createCoupon(body)
+	case "price_schedules":
+		id, err = createPriceSchedule(body)
+	case "shipping_methods":
+		id, err = createShippingMethod(body)
+	case "shipments":
+		id, err = createShipment(body)
+	case "webhooks":
+		id, err = createWebhook(body)
+	case "currencies":
+		id, err = createCurrency(body)
 	default:
 		return c.Status(400).JSON(fiber.Map{"error": "Unknown resource"})
 	}
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		if _, ok := err.(*fiber.Error); !ok {
+			log.Printf("Failed to create %s: %v", resource, err)
+		}
+		return errorResponse(c, err)
 	}
 
 	body["id"] = id
@@ -269,10 +333,27 @@ func AdminUpdateResource(c *fiber.Ctx) error {
 		err = updateBanner(id, body)
 	case "users":
 		err = updateUser(id, body)
+	case "coupons":
+		err = updateCoupon(id, body)
+	case "price_schedules":
+		err = updatePriceSchedule(id, body)
+	case "returns":
+		err = updateReturn(id, body)
+	case "shipping_methods":
+		err = updateShippingMethod(id, body)
+	case "shipments":
+		err = updateShipment(id, body)
+	case "webhooks":
+		err = updateWebhook(id, body)
+	case "currencies":
+		err = updateCurrency(id, body)
 	default:
 		return c.Status(400).JSON(fiber.Map{"error": "Unknown resource"})
 	}
 
+	if e, ok := err.(*fiber.Error); ok {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -302,10 +383,35 @@ func AdminDeleteResource(c *fiber.Ctx) error {
 		err = deleteBanner(id)
 	case "users":
 		err = deleteUser(id)
+	case "coupons":
+		err = deleteCoupon(id)
+	case "price_schedules":
+		err = deletePriceSchedule(id)
+	case "returns":
+		err = deleteReturn(id)
+	case "shipping_methods":
+		err = deleteShippingMethod(id)
+	case "shipments":
+		err = deleteShipment(id)
+	case "emails":
+		err = deleteEmail(id)
+	case "telegram_messages":
+		err = deleteTelegramMessage(id)
+	case "webhooks":
+		err = deleteWebhook(id)
+	case "webhook_deliveries":
+		err = deleteWebhookDelivery(id)
+	case "currencies":
+		err = deleteCurrency(id)
+	case "product_subscriptions":
+		err = deleteProductSubscription(id)
 	default:
 		return c.Status(400).JSON(fiber.Map{"error": "Unknown resource"})
 	}
 
+	if e, ok := err.(*fiber.Error); ok {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -355,39 +461,68 @@ func AdminUploadFile(c *fiber.Ctx) error {
 }
 
 // Helper functions for Products
-func getProductsForAdmin() ([]map[string]interface{}, error) {
-	rows, err := database.DB.Query(`
-		SELECT id, name, price, short_description, long_description, sku, discount, images, category_id, created_at, updated_at 
-		FROM products
-	`)
+var productsAdminList = &adminList{
+	from: "products",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"name":            {"name", fieldText},
+		"price":           {"price", fieldMoney},
+		"sku":             {"sku", fieldText},
+		"discount":        {"discount", fieldInt},
+		"stock":           {"stock", fieldInt},
+		"weight":          {"weight", fieldInt},
+		"gift_card":       {"gift_card", fieldBool},
+		"bundle_discount": {"bundle_discount", fieldInt},
+		"category_id":     {"category_id", fieldInt},
+		"created_at":      {"created_at", fieldTime},
+		"updated_at":      {"updated_at", fieldTime},
+	},
+	search: []string{"name", "sku"},
+	sort:   "id",
+}
+
+func getProductsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, name, price, short_description, long_description, sku, discount, stock, weight, gift_card, bundle_discount, images, category_id, created_at, updated_at`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	bundleItems, err := bundleItemsForAdmin()
+	if err != nil {
+		return nil, err
+	}
+
 	var items []map[string]interface{}
 	for rows.Next() {
-		var id, discount, categoryID int
+		var id, discount, weight, categoryID int
 		var name, shortDesc, longDesc, sku, images string
-		var price float64
+		var price models.Money
+		var stock, bundleDiscount sql.NullInt64
+		var giftCard bool
 		var createdAt, updatedAt time.Time
 
-		if err := rows.Scan(&id, &name, &price, &shortDesc, &longDesc, &sku, &discount, &images, &categoryID, &createdAt, &updatedAt); err != nil {
+		if err := rows.Scan(&id, &name, &price, &shortDesc, &longDesc, &sku, &discount, &stock, &weight, &giftCard, &bundleDiscount, &images, &categoryID, &createdAt, &updatedAt); err != nil {
 			continue
 		}
 
 		item := map[string]interface{}{
-			"id":                  id,
-			"name":                name,
-			"price":               price,
-			"short_description":   shortDesc,
-			"long_description":    longDesc,
-			"sku":                 sku,
-			"discount":            discount,
-			"images":              images,
-			"category_id":         categoryID,
-			"created_at":          createdAt.Format(time.RFC3339),
-			"updated_at":          updatedAt.Format(time.RFC3339),
+			"id":                id,
+			"name":              name,
+			"price":             price,
+			"short_description": shortDesc,
+			"long_description":  longDesc,
+			"sku":               sku,
+			"discount":          discount,
+			"stock":             nullIntToValue(stock),
+			"weight":            weight,
+			"gift_card":         giftCard,
+			"bundle_items":      bundleItems[id],
+			"bundle_discount":   nullIntToValue(bundleDiscount),
+			"images":            images,
+			"category_id":       categoryID,
+			"created_at":        createdAt.Format(time.RFC3339),
+			"updated_at":        updatedAt.Format(time.RFC3339),
 		}
 		items = append(items, item)
 	}
@@ -397,11 +532,15 @@ func getProductsForAdmin() ([]map[string]interface{}, error) {
 
 func createProduct(data map[string]interface{}) (int64, error) {
 	name := toString(data["name"])
-	price := toFloat64(data["price"])
+	price := toMoney(data["price"])
 	shortDesc := toString(data["short_description"])
 	longDesc := toString(data["long_description"])
 	sku := toString(data["sku"])
 	discount := toInt(data["discount"])
+	stock := toNullInt(data["stock"])
+	weight := toInt(data["weight"])
+	giftCard := toBool(data["gift_card"], false)
+	bundleDiscount := toNullInt(data["bundle_discount"])
 	images := toString(data["images"])
 	categoryID := toInt(data["category_id"])
 
@@ -409,49 +548,181 @@ func createProduct(data map[string]interface{}) (int64, error) {
 		images = "[]"
 	}
 
+	bundleItems, _, err := bundleItemsFromMap(data)
+	if err != nil {
+		return 0, err
+	}
+	if err := validateBundle(0, bundleItems, giftCard); err != nil {
+		return 0, err
+	}
+	if err := validateBundleDiscount(bundleDiscount); err != nil {
+		return 0, err
+	}
+
 	// allow admin-provided timestamps
 	createdAt := parseTimeFromMap(data, "created_at")
 	updatedAt := parseTimeFromMap(data, "updated_at")
 
-	result, err := database.DB.Exec(`
-		INSERT INTO products (name, price, short_description, long_description, sku, discount, images, category_id, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, name, price, shortDesc, longDesc, sku, discount, images, categoryID, createdAt, updatedAt)
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO products (name, price, short_description, long_description, sku, discount, stock, weight, gift_card, bundle_discount, images, category_id, created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, name, price, shortDesc, longDesc, sku, discount, stock, weight, giftCard, bundleDiscount, images, categoryID, createdAt, updatedAt)
 
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := saveBundleItems(tx, int(id), bundleItems); err != nil {
+		return 0, err
+	}
+
+	// Начальная цена - первая запись в истории цен
+	if err := recordPriceChange(tx, int(id), price, discount, "admin"); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
 }
 
 func updateProduct(id int, data map[string]interface{}) error {
-	name := toString(data["name"])
-	price := toFloat64(data["price"])
-	shortDesc := toString(data["short_description"])
-	longDesc := toString(data["long_description"])
-	sku := toString(data["sku"])
-	discount := toInt(data["discount"])
-	images := toString(data["images"])
-	categoryID := toInt(data["category_id"])
+	// Поля, которых нет в теле запроса, сохраняют текущие значения
+	var name, shortDesc, longDesc, sku, images string
+	var price models.Money
+	var discount, weight, categoryID int
+	var stock, bundleDiscount sql.NullInt64
+	var giftCard bool
+	err := database.DB.QueryRow(`
+		SELECT name, price, COALESCE(short_description, ''), COALESCE(long_description, ''), sku, COALESCE(discount, 0),
+		       stock, COALESCE(weight, 0), COALESCE(gift_card, 0), bundle_discount, COALESCE(images, ''), category_id
+		FROM products WHERE id = ?
+	`, id).Scan(&name, &price, &shortDesc, &longDesc, &sku, &discount, &stock, &weight, &giftCard, &bundleDiscount, &images, &categoryID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(404, "Product not found")
+	}
+	if err != nil {
+		return err
+	}
+	oldPrice, oldDiscount := price, discount
+
+	has := func(key string) bool {
+		_, ok := data[key]
+		return ok
+	}
+	if has("name") {
+		name = toString(data["name"])
+	}
+	if has("price") {
+		price = toMoney(data["price"])
+	}
+	if has("short_description") {
+		shortDesc = toString(data["short_description"])
+	}
+	if has("long_description") {
+		longDesc = toString(data["long_description"])
+	}
+	if has("sku") {
+		sku = toString(data["sku"])
+	}
+	if has("discount") {
+		discount = toInt(data["discount"])
+	}
+	if has("stock") {
+		stock = toNullInt(data["stock"])
+	}
+	if has("weight") {
+		weight = toInt(data["weight"])
+	}
+	if has("gift_card") {
+		giftCard = toBool(data["gift_card"], false)
+	}
+	if has("bundle_discount") {
+		bundleDiscount = toNullInt(data["bundle_discount"])
+	}
+	if has("images") {
+		images = toString(data["images"])
+	}
+	if has("category_id") {
+		categoryID = toInt(data["category_id"])
+	}
 
 	if images == "" {
 		images = "[]"
 	}
 
+	// Состав набора меняется, только если передан bundle_items
+	bundleItems, replaceBundle, err := bundleItemsFromMap(data)
+	if err != nil {
+		return err
+	}
+	if !replaceBundle {
+		if bundleItems, err = getBundleItems(id); err != nil {
+			return err
+		}
+	}
+	if err := validateBundle(id, bundleItems, giftCard); err != nil {
+		return err
+	}
+	if err := validateBundleDiscount(bundleDiscount); err != nil {
+		return err
+	}
+
 	updatedAt := parseTimeFromMap(data, "updated_at")
 
-	_, err := database.DB.Exec(`
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		UPDATE products 
-		SET name = ?, price = ?, short_description = ?, long_description = ?, sku = ?, discount = ?, images = ?, category_id = ?, updated_at = ? 
+		SET name = ?, price = ?, short_description = ?, long_description = ?, sku = ?, discount = ?, stock = ?, weight = ?, gift_card = ?, bundle_discount = ?, images = ?, category_id = ?, updated_at = ? 
 		WHERE id = ?
-	`, name, price, shortDesc, longDesc, sku, discount, images, categoryID, updatedAt, id)
+	`, name, price, shortDesc, longDesc, sku, discount, stock, weight, giftCard, bundleDiscount, images, categoryID, updatedAt, id)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if replaceBundle {
+		if err := saveBundleItems(tx, id, bundleItems); err != nil {
+			return err
+		}
+	}
+
+	// Каждое изменение цены или скидки попадает в историю цен
+	if price != oldPrice || discount != oldDiscount {
+		if err := recordPriceChange(tx, id, price, discount, "admin"); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	emitProductEvent(models.EventProductUpdated, id)
+	dispatchProductAlerts(id)
+	return nil
 }
 
 func deleteProduct(id int) error {
+	if err := checkProductNotInBundle(id); err != nil {
+		return err
+	}
+
 	// Delete dependent records (reviews, banners) first to avoid foreign key constraint errors
+	// (состав набора удаляется каскадно)
 	tx, err := database.DB.Begin()
 	if err != nil {
 		return err
@@ -467,6 +738,11 @@ func deleteProduct(id int) error {
 		return err
 	}
 
+	if _, err := tx.Exec("DELETE FROM price_schedules WHERE product_id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if _, err := tx.Exec("DELETE FROM products WHERE id = ?", id); err != nil {
 		tx.Rollback()
 		return err
@@ -476,8 +752,20 @@ func deleteProduct(id int) error {
 }
 
 // Helper functions for Categories
-func getCategoriesForAdmin() ([]map[string]interface{}, error) {
-	rows, err := database.DB.Query(`SELECT id, name, alias FROM categories`)
+var categoriesAdminList = &adminList{
+	from: "categories",
+	fields: map[string]adminField{
+		"id":       {"id", fieldInt},
+		"name":     {"name", fieldText},
+		"alias":    {"alias", fieldText},
+		"tax_rate": {"tax_rate", fieldInt},
+	},
+	search: []string{"name", "alias"},
+	sort:   "id",
+}
+
+func getCategoriesForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, name, alias, tax_rate`)
 	if err != nil {
 		return nil, err
 	}
@@ -487,15 +775,17 @@ func getCategoriesForAdmin() ([]map[string]interface{}, error) {
 	for rows.Next() {
 		var id int
 		var name, alias string
+		var taxRate sql.NullInt64
 
-		if err := rows.Scan(&id, &name, &alias); err != nil {
+		if err := rows.Scan(&id, &name, &alias, &taxRate); err != nil {
 			continue
 		}
 
 		item := map[string]interface{}{
-			"id":    id,
-			"name":  name,
-			"alias": alias,
+			"id":       id,
+			"name":     name,
+			"alias":    alias,
+			"tax_rate": nullIntToValue(taxRate), // null - ставка магазина по умолчанию
 		}
 		items = append(items, item)
 	}
@@ -506,8 +796,11 @@ func getCategoriesForAdmin() ([]map[string]interface{}, error) {
 func createCategory(data map[string]interface{}) (int64, error) {
 	name := toString(data["name"])
 	alias := toString(data["alias"])
+	if err := validateTaxRate(data); err != nil {
+		return 0, err
+	}
 
-	result, err := database.DB.Exec(`INSERT INTO categories (name, alias) VALUES (?, ?)`, name, alias)
+	result, err := database.DB.Exec(`INSERT INTO categories (name, alias, tax_rate) VALUES (?, ?, ?)`, name, alias, toNullInt(data["tax_rate"]))
 	if err != nil {
 		return 0, err
 	}
@@ -518,8 +811,11 @@ func createCategory(data map[string]interface{}) (int64, error) {
 func updateCategory(id int, data map[string]interface{}) error {
 	name := toString(data["name"])
 	alias := toString(data["alias"])
+	if err := validateTaxRate(data); err != nil {
+		return err
+	}
 
-	_, err := database.DB.Exec(`UPDATE categories SET name = ?, alias = ? WHERE id = ?`, name, alias, id)
+	_, err := database.DB.Exec(`UPDATE categories SET name = ?, alias = ?, tax_rate = ? WHERE id = ?`, name, alias, toNullInt(data["tax_rate"]), id)
 	return err
 }
 
@@ -529,8 +825,29 @@ func deleteCategory(id int) error {
 }
 
 // Helper functions for Orders
-func getOrdersForAdmin() ([]map[string]interface{}, error) {
-	rows, err := database.DB.Query(`SELECT id, user_id, product_ids, status, price, created_at FROM orders`)
+var ordersAdminList = &adminList{
+	from: "orders",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"user_id":         {"user_id", fieldInt},
+		"status":          {"status", fieldText},
+		"price":           {"price", fieldMoney},
+		"coupon_code":     {"coupon_code", fieldText},
+		"coupon_discount": {"coupon_discount", fieldMoney},
+		"refunded_amount": {"refunded_amount", fieldMoney},
+		"shipping_method": {"shipping_method", fieldText},
+		"shipping_cost":   {"shipping_cost", fieldMoney},
+		"invoice_number":  {"invoice_number", fieldInt},
+		"guest_email":     {"guest_email", fieldText},
+		"currency":        {"currency", fieldText},
+		"created_at":      {"created_at", fieldTime},
+	},
+	search: []string{"status", "guest_email", "coupon_code"},
+	sort:   "id",
+}
+
+func getOrdersForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, COALESCE(user_id, 0), product_ids, status, price, COALESCE(coupon_code, ''), COALESCE(coupon_discount, 0), COALESCE(refunded_amount, 0), COALESCE(shipping_method, ''), COALESCE(shipping_cost, 0), delivery_address, COALESCE(invoice_number, 0), COALESCE(guest_email, ''), COALESCE(currency, 'RUB'), COALESCE(exchange_rate, 1), created_at`)
 	if err != nil {
 		return nil, err
 	}
@@ -538,22 +855,34 @@ func getOrdersForAdmin() ([]map[string]interface{}, error) {
 
 	var items []map[string]interface{}
 	for rows.Next() {
-		var id, userID int
-		var productIDsStr, status string
-		var price float64
+		var id, userID, invoiceNumber int
+		var productIDsStr, status, couponCode, shippingMethod, guestEmail, currency string
+		var price, couponDiscount, refundedAmount, shippingCost models.Money
+		var exchangeRate float64
+		var address *models.AddressFields
 		var createdAt time.Time
 
-		if err := rows.Scan(&id, &userID, &productIDsStr, &status, &price, &createdAt); err != nil {
+		if err := rows.Scan(&id, &userID, &productIDsStr, &status, &price, &couponCode, &couponDiscount, &refundedAmount, &shippingMethod, &shippingCost, &address, &invoiceNumber, &guestEmail, &currency, &exchangeRate, &createdAt); err != nil {
 			continue
 		}
 
 		item := map[string]interface{}{
-			"id":           id,
-			"user_id":      userID,
-			"product_ids":  productIDsStr,
-			"status":       status,
-			"price":        price,
-			"created_at":   createdAt.Format(time.RFC3339),
+			"id":               id,
+			"user_id":          userID,
+			"product_ids":      productIDsStr,
+			"status":           status,
+			"price":            price,
+			"coupon_code":      couponCode,
+			"coupon_discount":  couponDiscount,
+			"refunded_amount":  refundedAmount,
+			"shipping_method":  shippingMethod,
+			"shipping_cost":    shippingCost,
+			"delivery_address": address,
+			"invoice_number":   invoiceNumber,
+			"guest_email":      guestEmail,
+			"currency":         currency,
+			"exchange_rate":    exchangeRate,
+			"created_at":       createdAt.Format(time.RFC3339),
 		}
 		items = append(items, item)
 	}
@@ -564,7 +893,7 @@ func getOrdersForAdmin() ([]map[string]interface{}, error) {
 func createOrder(data map[string]interface{}) (int64, error) {
 	userID := toInt(data["user_id"])
 	productIDs := toString(data["product_ids"])
-	status := toString(data["status"]) 
+	status := toString(data["status"])
 
 	if status == "" {
 		status = "оплачен"
@@ -573,13 +902,24 @@ func createOrder(data map[string]interface{}) (int64, error) {
 	createdAt := parseTimeFromMap(data, "created_at")
 
 	result, err := database.DB.Exec(`INSERT INTO orders (user_id, product_ids, status, created_at) VALUES (?, ?, ?, ?)`,
-		userID, productIDs, status, createdAt)
+		nullID(userID), productIDs, status, createdAt)
 
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if status == models.OrderStatusPaid {
+		if err := assignInvoiceNumber(database.DB, int(id)); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
 }
 
 func updateOrder(id int, data map[string]interface{}) error {
@@ -587,20 +927,93 @@ func updateOrder(id int, data map[string]interface{}) error {
 	productIDs := toString(data["product_ids"])
 	status := toString(data["status"])
 
+	var oldStatus string
+	if err := database.DB.QueryRow("SELECT status FROM orders WHERE id = ?", id).Scan(&oldStatus); err != nil {
+		return err
+	}
+
 	_, err := database.DB.Exec(`UPDATE orders SET user_id = ?, product_ids = ?, status = ? WHERE id = ?`,
-		userID, productIDs, status, id)
+		nullID(userID), productIDs, status, id)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if status == models.OrderStatusPaid {
+		if err := assignInvoiceNumber(database.DB, id); err != nil {
+			return err
+		}
+	}
+
+	if status != oldStatus {
+		syncOrderBalances(id)
+		notifyOrderStatus(id)
+		emitOrderEvent(models.EventOrderStatusChanged, id)
+		if status == models.OrderStatusPaid {
+			notifyStaffOrderPaid(id)
+		}
+	}
+
+	return nil
 }
 
+// deleteOrder удаляет заказ вместе с позициями, возвратами и отправлениями.
+// Заказ с финансовыми последствиями (оплата, счёт, подарочные карты, баллы) не удаляется:
+// журналы карт и баллов ссылаются на него. Вместо удаления такой заказ отменяют или возвращают.
 func deleteOrder(id int) error {
-	_, err := database.DB.Exec("DELETE FROM orders WHERE id = ?", id)
-	return err
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var financial bool
+	err = tx.QueryRow(`
+		SELECT invoice_number IS NOT NULL
+		    OR EXISTS (SELECT 1 FROM payments WHERE order_id = o.id AND status IN (?, ?))
+		    OR EXISTS (SELECT 1 FROM gift_cards WHERE order_id = o.id)
+		    OR EXISTS (SELECT 1 FROM gift_card_transactions WHERE order_id = o.id)
+		    OR EXISTS (SELECT 1 FROM loyalty_transactions WHERE order_id = o.id)
+		FROM orders o WHERE o.id = ?
+	`, payments.StatusSucceeded, payments.StatusRefunded, id).Scan(&financial)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if financial {
+		return fiber.NewError(409, "Order has payments, gift cards or loyalty points and cannot be deleted")
+	}
+
+	deletes := []string{
+		"DELETE FROM return_items WHERE return_id IN (SELECT id FROM return_requests WHERE order_id = ?)",
+		"DELETE FROM return_requests WHERE order_id = ?",
+		"DELETE FROM order_items WHERE order_id = ?",
+		"DELETE FROM tracking_events WHERE shipment_id IN (SELECT id FROM shipments WHERE order_id = ?)",
+		"DELETE FROM shipments WHERE order_id = ?",
+		"DELETE FROM orders WHERE id = ?",
+	}
+	for _, query := range deletes {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // Helper functions for News
-func getNewsForAdmin() ([]map[string]interface{}, error) {
-	rows, err := database.DB.Query(`SELECT id, title, description, image, created_at FROM news`)
+var newsAdminList = &adminList{
+	from: "news",
+	fields: map[string]adminField{
+		"id":          {"id", fieldInt},
+		"title":       {"title", fieldText},
+		"description": {"description", fieldText},
+		"created_at":  {"created_at", fieldTime},
+	},
+	search: []string{"title", "description"},
+	sort:   "id",
+}
+
+func getNewsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, title, description, image, created_at`)
 	if err != nil {
 		return nil, err
 	}
@@ -663,8 +1076,21 @@ func deleteNews(id int) error {
 }
 
 // Helper functions for Banners
-func getBannersForAdmin() ([]map[string]interface{}, error) {
-	rows, err := database.DB.Query(`SELECT id, product_id, image, position, created_at FROM banners`)
+var bannersAdminList = &adminList{
+	from: "banners",
+	fields: map[string]adminField{
+		"id":         {"id", fieldInt},
+		"product_id": {"product_id", fieldInt},
+		"image":      {"image", fieldText},
+		"position":   {"position", fieldInt},
+		"created_at": {"created_at", fieldTime},
+	},
+	search: []string{"image"},
+	sort:   "id",
+}
+
+func getBannersForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, product_id, image, position, created_at`)
 	if err != nil {
 		return nil, err
 	}
@@ -733,11 +1159,25 @@ func nullStringToString(ns sql.NullString) string {
 	}
 	return ""
 }
-func getUsersForAdmin() ([]map[string]interface{}, error) {
-	rows, err := database.DB.Query(`
-		SELECT id, email, role, name, phone, delivery_address, created_at, updated_at 
-		FROM users
-	`)
+
+// Helper functions for Users
+var usersAdminList = &adminList{
+	from: "users",
+	fields: map[string]adminField{
+		"id":         {"id", fieldInt},
+		"email":      {"email", fieldText},
+		"role":       {"role", fieldText},
+		"name":       {"name", fieldText},
+		"phone":      {"phone", fieldText},
+		"created_at": {"created_at", fieldTime},
+		"updated_at": {"updated_at", fieldTime},
+	},
+	search: []string{"email", "name", "phone"},
+	sort:   "id",
+}
+
+func getUsersForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, email, role, name, phone, delivery_address, created_at, updated_at`)
 	if err != nil {
 		return nil, err
 	}
@@ -755,14 +1195,14 @@ func getUsersForAdmin() ([]map[string]interface{}, error) {
 		}
 
 		item := map[string]interface{}{
-			"id":                 id,
-			"email":              email,
-			"role":               role,
-			"name":               nullStringToString(name),
-			"phone":              nullStringToString(phone),
-			"delivery_address":   nullStringToString(deliveryAddress),
-			"created_at":         createdAt.Format(time.RFC3339),
-			"updated_at":         updatedAt.Format(time.RFC3339),
+			"id":               id,
+			"email":            email,
+			"role":             role,
+			"name":             nullStringToString(name),
+			"phone":            nullStringToString(phone),
+			"delivery_address": nullStringToString(deliveryAddress),
+			"created_at":       createdAt.Format(time.RFC3339),
+			"updated_at":       updatedAt.Format(time.RFC3339),
 		}
 		items = append(items, item)
 	}
@@ -822,6 +1262,167 @@ func deleteUser(id int) error {
 	return err
 }
 
+// Helper functions for Coupons
+var couponsAdminList = &adminList{
+	from: "coupons c",
+	fields: map[string]adminField{
+		"id":              {"c.id", fieldInt},
+		"code":            {"c.code", fieldText},
+		"type":            {"c.type", fieldText},
+		"min_order_total": {"c.min_order_total", fieldMoney},
+		"starts_at":       {"c.starts_at", fieldTime},
+		"ends_at":         {"c.ends_at", fieldTime},
+		"usage_limit":     {"c.usage_limit", fieldInt},
+		"per_user_limit":  {"c.per_user_limit", fieldInt},
+		"stackable":       {"c.stackable", fieldBool},
+		"active":          {"c.active", fieldBool},
+		"used":            {"(SELECT COUNT(*) FROM coupon_usages u WHERE u.coupon_id = c.id)", fieldInt},
+		"created_at":      {"c.created_at", fieldTime},
+	},
+	search: []string{"code"},
+	sort:   "id",
+}
+
+func getCouponsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`c.id, c.code, c.type, c.value, c.min_order_total, c.category_ids, c.product_ids,
+		c.starts_at, c.ends_at, c.usage_limit, c.per_user_limit, c.stackable, c.active, c.created_at,
+		(SELECT COUNT(*) FROM coupon_usages u WHERE u.coupon_id = c.id)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, usageLimit, perUserLimit, used int
+		var code, couponType, categoryIDs, productIDs string
+		var value int64
+		var minOrderTotal models.Money
+		var startsAt, endsAt sql.NullTime
+		var stackable, active bool
+		var createdAt time.Time
+
+		if err := rows.Scan(&id, &code, &couponType, &value, &minOrderTotal, &categoryIDs, &productIDs,
+			&startsAt, &endsAt, &usageLimit, &perUserLimit, &stackable, &active, &createdAt, &used); err != nil {
+			continue
+		}
+
+		item := map[string]interface{}{
+			"id":              id,
+			"code":            code,
+			"type":            couponType,
+			"value":           couponValueForAdmin(couponType, value),
+			"min_order_total": minOrderTotal,
+			"category_ids":    categoryIDs,
+			"product_ids":     productIDs,
+			"starts_at":       nullTimeToString(startsAt),
+			"ends_at":         nullTimeToString(endsAt),
+			"usage_limit":     usageLimit,
+			"per_user_limit":  perUserLimit,
+			"stackable":       stackable,
+			"active":          active,
+			"used":            used,
+			"created_at":      createdAt.Format(time.RFC3339),
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func createCoupon(data map[string]interface{}) (int64, error) {
+	code, couponType, err := couponCodeAndType(data)
+	if err != nil {
+		return 0, err
+	}
+	value, err := couponValueFromMap(couponType, data["value"])
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO coupons (code, type, value, min_order_total, category_ids, product_ids, starts_at, ends_at, usage_limit, per_user_limit, stackable, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, code, couponType, value, toMoney(data["min_order_total"]),
+		intArrayJSON(data["category_ids"]), intArrayJSON(data["product_ids"]),
+		parseNullTimeFromMap(data, "starts_at"), parseNullTimeFromMap(data, "ends_at"),
+		toInt(data["usage_limit"]), toInt(data["per_user_limit"]), toBool(data["stackable"], false), toBool(data["active"], true),
+		parseTimeFromMap(data, "created_at"))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func updateCoupon(id int, data map[string]interface{}) error {
+	code, couponType, err := couponCodeAndType(data)
+	if err != nil {
+		return err
+	}
+	value, err := couponValueFromMap(couponType, data["value"])
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE coupons
+		SET code = ?, type = ?, value = ?, min_order_total = ?, category_ids = ?, product_ids = ?, starts_at = ?, ends_at = ?, usage_limit = ?, per_user_limit = ?, stackable = ?, active = ?
+		WHERE id = ?
+	`, code, couponType, value, toMoney(data["min_order_total"]),
+		intArrayJSON(data["category_ids"]), intArrayJSON(data["product_ids"]),
+		parseNullTimeFromMap(data, "starts_at"), parseNullTimeFromMap(data, "ends_at"),
+		toInt(data["usage_limit"]), toInt(data["per_user_limit"]), toBool(data["stackable"], false), toBool(data["active"], true), id)
+
+	return err
+}
+
+func deleteCoupon(id int) error {
+	_, err := database.DB.Exec("DELETE FROM coupons WHERE id = ?", id)
+	return err
+}
+
+// couponValueFromMap: проценты (1-100) для percent, положительная сумма в копейках для fixed
+func couponValueFromMap(couponType string, val interface{}) (int64, error) {
+	if couponType == models.CouponTypeFixed {
+		value := toMoney(val)
+		if value <= 0 {
+			return 0, fiber.NewError(400, "value of a fixed coupon must be positive")
+		}
+		return int64(value), nil
+	}
+	value := toInt(val)
+	if value < 1 || value > 100 {
+		return 0, fiber.NewError(400, "value of a percent coupon must be between 1 and 100")
+	}
+	return int64(value), nil
+}
+
+func couponValueForAdmin(couponType string, value int64) interface{} {
+	if couponType == models.CouponTypeFixed {
+		return models.Money(value)
+	}
+	return value
+}
+
+func couponCodeAndType(data map[string]interface{}) (string, string, error) {
+	code := normalizeCouponCode(toString(data["code"]))
+	if code == "" {
+		return "", "", fiber.NewError(400, "code is required")
+	}
+
+	couponType := toString(data["type"])
+	if couponType == "" {
+		couponType = models.CouponTypePercent
+	}
+	if couponType != models.CouponTypePercent && couponType != models.CouponTypeFixed {
+		return "", "", fiber.NewError(400, "unknown coupon type: "+couponType)
+	}
+
+	return code, couponType, nil
+}
+
 // Utility conversion functions
 func toString(val interface{}) string {
 	if val == nil {
@@ -883,6 +1484,22 @@ func toFloat64(val interface{}) float64 {
 	return 0
 }
 
+// toMoney converts a ruble amount (JSON number or decimal string) to minor units.
+func toMoney(val interface{}) models.Money {
+	switch v := val.(type) {
+	case float64:
+		return models.MoneyFromFloat(v)
+	case int:
+		return models.Money(v * 100)
+	case string:
+		if m, err := models.ParseMoney(v); err == nil {
+			return m
+		}
+	}
+
+	return 0
+}
+
 func toIntArray(val interface{}) []int {
 	if val == nil {
 		return []int{}
@@ -907,8 +1524,108 @@ func toIntArray(val interface{}) []int {
 	return arr
 }
 
+func toStringArray(val interface{}) []string {
+	arr := []string{}
+	switch v := val.(type) {
+	case string:
+		var jsonArr []string
+		if err := json.Unmarshal([]byte(v), &jsonArr); err == nil {
+			return jsonArr
+		}
+		// Строка через запятую: "Москва, Санкт-Петербург"
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				arr = append(arr, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok && strings.TrimSpace(str) != "" {
+				arr = append(arr, strings.TrimSpace(str))
+			}
+		}
+	}
+
+	return arr
+}
+
+func toBool(val interface{}, def bool) bool {
+	switch v := val.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+
+	return def
+}
+
+// intArrayJSON normalizes an array value (JSON string or list) to a JSON string for storage.
+func intArrayJSON(val interface{}) string {
+	arr := toIntArray(val)
+	if arr == nil {
+		arr = []int{}
+	}
+	b, _ := json.Marshal(arr)
+	return string(b)
+}
+
+// toNullInt returns NULL for missing or empty values, otherwise the integer value.
+func toNullInt(val interface{}) sql.NullInt64 {
+	if val == nil || toString(val) == "" {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(toInt(val)), Valid: true}
+}
+
+func nullIntToValue(n sql.NullInt64) interface{} {
+	if n.Valid {
+		return n.Int64
+	}
+	return nil
+}
+
+func nullTimeToString(t sql.NullTime) string {
+	if t.Valid {
+		return t.Time.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// parseNullTimeFromMap works like parseTimeFromMap but returns NULL for empty or invalid values.
+func parseNullTimeFromMap(data map[string]interface{}, key string) sql.NullTime {
+	if data == nil || toString(data[key]) == "" {
+		return sql.NullTime{}
+	}
+	if t, ok := parseAdminTime(toString(data[key])); ok {
+		return sql.NullTime{Time: t, Valid: true}
+	}
+	return sql.NullTime{}
+}
+
+// Форматы без часового пояса (поля datetime-local админки) - местное время магазина (time.Local, задаётся TZ)
+var localTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// parseAdminTime разбирает время из админки: RFC3339 - с его поясом, без пояса - в местном времени.
+// Результат в UTC: в SQLite время хранится строкой, и сравнение строк с разными поясами было бы неверным.
+func parseAdminTime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), true
+	}
+	for _, l := range localTimeLayouts {
+		if t, err := time.ParseInLocation(l, s, time.Local); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
 // parseTimeFromMap parses a time string from the provided map at key and returns time.Time.
-// It understands RFC3339 and the 'datetime-local' format '2006-01-02T15:04'.
+// It understands RFC3339 and the 'datetime-local' format '2006-01-02T15:04' (read in local time).
 func parseTimeFromMap(data map[string]interface{}, key string) time.Time {
 	if data == nil {
 		return time.Now()
@@ -918,19 +1635,10 @@ func parseTimeFromMap(data map[string]interface{}, key string) time.Time {
 		return time.Now()
 	}
 
-	// try RFC3339
-	if t, err := time.Parse(time.RFC3339, s); err == nil {
+	if t, ok := parseAdminTime(s); ok {
 		return t
 	}
 
-	// try datetime-local format without seconds
-	layouts := []string{"2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
-	for _, l := range layouts {
-		if t, err := time.Parse(l, s); err == nil {
-			return t
-		}
-	}
-
 	// fallback
 	return time.Now()
 }
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"myAPI/database"
+	"myAPI/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Типы полей списка в админке: от типа зависит разбор значения фильтра и допустимые операторы
+const (
+	fieldText = iota
+	fieldInt
+	fieldFloat
+	fieldMoney // в запросе - рубли, в БД - копейки
+	fieldBool
+	fieldTime // RFC3339, "2006-01-02 15:04:05" или "2006-01-02"
+)
+
+// adminField - поле ресурса, доступное для фильтров и сортировки: SQL-выражение и его тип
+type adminField struct {
+	expr string
+	kind int
+}
+
+// adminList описывает ресурс для постраничного списка в админке
+type adminList struct {
+	from   string                // таблица (с JOIN-ами), к которой применяются условия
+	fields map[string]adminField // поля ответа, по которым можно фильтровать и сортировать
+	search []string              // поля для глобального поиска ?search=
+	sort   string                // сортировка по умолчанию в формате ?sort=
+}
+
+// adminLists - ресурсы админки со списками; описания лежат рядом с функциями выборки
+var adminLists = map[string]*adminList{
+	"products":              productsAdminList,
+	"categories":            categoriesAdminList,
+	"orders":                ordersAdminList,
+	"news":                  newsAdminList,
+	"banners":               bannersAdminList,
+	"users":                 usersAdminList,
+	"coupons":               couponsAdminList,
+	"price_schedules":       priceSchedulesAdminList,
+	"payments":              paymentsAdminList,
+	"returns":               returnsAdminList,
+	"shipping_methods":      shippingMethodsAdminList,
+	"shipments":             shipmentsAdminList,
+	"emails":                emailsAdminList,
+	"telegram_messages":     telegramMessagesAdminList,
+	"webhooks":              webhooksAdminList,
+	"webhook_deliveries":    webhookDeliveriesAdminList,
+	"loyalty_transactions":  loyaltyTransactionsAdminList,
+	"gift_cards":            giftCardsAdminList,
+	"currencies":            currenciesAdminList,
+	"product_subscriptions": productSubscriptionsAdminList,
+}
+
+// Ограничения размера страницы
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 500
+)
+
+// adminListQuery - разобранные параметры списка. Без page и page_size - первая страница размера по умолчанию.
+type adminListQuery struct {
+	list     *adminList
+	page     int
+	pageSize int
+	where    []string
+	args     []interface{}
+	order    string
+}
+
+// parseAdminListQuery разбирает параметры списка, общие для всех ресурсов:
+//
+//	page=2&page_size=50                  страница (с 1) и её размер
+//	sort=-created_at,id                  сортировка, "-" - по убыванию
+//	search=текст                         поиск подстроки по основным полям ресурса
+//	filter[status]=paid                  равенство (то же, что filter[status][eq])
+//	filter[price][gte]=1000              операторы: eq, ne, gt, gte, lt, lte, contains, in, null
+//	filter[status][in]=paid,shipped      одно из значений через запятую
+//	filter[voided_at][null]=true         поле пустое (false - заполнено)
+//
+// Ошибки - *fiber.Error с кодом 400.
+func parseAdminListQuery(c *fiber.Ctx, list *adminList) (*adminListQuery, error) {
+	q := &adminListQuery{list: list, page: 1, pageSize: defaultAdminPageSize}
+
+	if pageParam := c.Query("page"); pageParam != "" {
+		page, err := strconv.Atoi(pageParam)
+		if err != nil || page < 1 {
+			return nil, fiber.NewError(400, "page must be a positive number")
+		}
+		q.page = page
+	}
+	if sizeParam := c.Query("page_size"); sizeParam != "" {
+		size, err := strconv.Atoi(sizeParam)
+		if err != nil || size < 1 || size > maxAdminPageSize {
+			return nil, fiber.NewError(400, fmt.Sprintf("page_size must be between 1 and %d", maxAdminPageSize))
+		}
+		q.pageSize = size
+	}
+
+	var filterErr error
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		if filterErr != nil || !strings.HasPrefix(string(key), "filter[") {
+			return
+		}
+		name, op, ok := parseFilterKey(string(key))
+		if !ok {
+			filterErr = fiber.NewError(400, "Invalid filter "+string(key))
+			return
+		}
+		filterErr = q.addFilter(name, op, string(value))
+	})
+	if filterErr != nil {
+		return nil, filterErr
+	}
+
+	if search := strings.TrimSpace(c.Query("search")); search != "" && len(list.search) > 0 {
+		var conds []string
+		for _, name := range list.search {
+			conds = append(conds, list.fields[name].expr+` LIKE ? ESCAPE '\'`)
+			q.args = append(q.args, likePattern(search))
+		}
+		q.where = append(q.where, "("+strings.Join(conds, " OR ")+")")
+	}
+
+	sort := c.Query("sort")
+	if sort == "" {
+		sort = list.sort
+	}
+	order, err := list.orderBy(sort)
+	if err != nil {
+		return nil, err
+	}
+	q.order = order
+
+	return q, nil
+}
+
+// parseFilterKey разбирает "filter[поле]" и "filter[поле][оператор]"
+func parseFilterKey(key string) (name, op string, ok bool) {
+	rest := strings.TrimPrefix(key, "filter[")
+	end := strings.Index(rest, "]")
+	if end <= 0 {
+		return "", "", false
+	}
+	name, rest = rest[:end], rest[end+1:]
+	if rest == "" {
+		return name, "eq", true
+	}
+	if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") {
+		return "", "", false
+	}
+	return name, rest[1 : len(rest)-1], true
+}
+
+var filterOperators = map[string]string{"eq": "=", "ne": "!=", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+func (q *adminListQuery) addFilter(name, op, raw string) error {
+	field, ok := q.list.fields[name]
+	if !ok {
+		return fiber.NewError(400, "Unknown filter field "+name)
+	}
+	expr := field.expr
+	if field.kind == fieldTime {
+		expr = "julianday(" + expr + ")"
+	}
+
+	switch op {
+	case "null":
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fiber.NewError(400, "filter["+name+"][null] must be true or false")
+		}
+		if isNull {
+			q.where = append(q.where, field.expr+" IS NULL")
+		} else {
+			q.where = append(q.where, field.expr+" IS NOT NULL")
+		}
+		return nil
+
+	case "contains":
+		if field.kind != fieldText {
+			return fiber.NewError(400, "contains is only supported for text fields")
+		}
+		q.where = append(q.where, expr+` LIKE ? ESCAPE '\'`)
+		q.args = append(q.args, likePattern(raw))
+		return nil
+
+	case "in":
+		var placeholders []string
+		for _, part := range strings.Split(raw, ",") {
+			value, err := field.value(strings.TrimSpace(part))
+			if err != nil {
+				return fiber.NewError(400, "Invalid value for "+name+": "+err.Error())
+			}
+			placeholders = append(placeholders, field.placeholder())
+			q.args = append(q.args, value)
+		}
+		q.where = append(q.where, expr+" IN ("+strings.Join(placeholders, ", ")+")")
+		return nil
+	}
+
+	sqlOp, ok := filterOperators[op]
+	if !ok {
+		return fiber.NewError(400, "Unknown filter operator "+op)
+	}
+	if field.kind == fieldBool && op != "eq" && op != "ne" {
+		return fiber.NewError(400, op+" is not supported for boolean fields")
+	}
+	value, err := field.value(raw)
+	if err != nil {
+		return fiber.NewError(400, "Invalid value for "+name+": "+err.Error())
+	}
+	q.where = append(q.where, expr+" "+sqlOp+" "+field.placeholder())
+	q.args = append(q.args, value)
+	return nil
+}
+
+// value приводит значение фильтра к типу поля
+func (f adminField) value(raw string) (interface{}, error) {
+	switch f.kind {
+	case fieldInt:
+		return strconv.ParseInt(raw, 10, 64)
+	case fieldFloat:
+		return strconv.ParseFloat(raw, 64)
+	case fieldMoney:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, err
+		}
+		return int64(models.MoneyFromFloat(v)), nil
+	case fieldBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	case fieldTime:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			// Даты без пояса - местное время, как и в формах админки
+			if t, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
+				return t.UTC().Format("2006-01-02 15:04:05"), nil
+			}
+		}
+		return nil, fmt.Errorf("expected date or RFC3339 time")
+	}
+	return raw, nil
+}
+
+func (f adminField) placeholder() string {
+	if f.kind == fieldTime {
+		return "julianday(?)"
+	}
+	return "?"
+}
+
+// orderBy строит ORDER BY по строке вида "-created_at,id"; для устойчивых страниц в конце всегда id
+func (l *adminList) orderBy(sort string) (string, error) {
+	var parts []string
+	hasID := false
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		dir := "ASC"
+		if strings.HasPrefix(key, "-") {
+			dir, key = "DESC", key[1:]
+		}
+		field, ok := l.fields[key]
+		if !ok {
+			return "", fiber.NewError(400, "Unknown sort field "+key)
+		}
+		expr := field.expr
+		if field.kind == fieldTime {
+			expr = "julianday(" + expr + ")"
+		}
+		parts = append(parts, expr+" "+dir)
+		hasID = hasID || key == "id"
+	}
+	if !hasID {
+		parts = append(parts, l.fields["id"].expr+" ASC")
+	}
+	return " ORDER BY " + strings.Join(parts, ", "), nil
+}
+
+// likePattern - шаблон LIKE для поиска подстроки с экранированием % и _
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+func (q *adminListQuery) whereClause() string {
+	if len(q.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.where, " AND ")
+}
+
+// clause - WHERE, ORDER BY и LIMIT для добавления после FROM; аргументы - queryArgs
+func (q *adminListQuery) clause() string {
+	return q.whereClause() + q.order + " LIMIT ? OFFSET ?"
+}
+
+func (q *adminListQuery) queryArgs() []interface{} {
+	return append(append([]interface{}{}, q.args...), q.pageSize, (q.page-1)*q.pageSize)
+}
+
+// query выбирает columns из таблицы ресурса с учётом фильтров, сортировки и страницы
+func (q *adminListQuery) query(columns string) (*sql.Rows, error) {
+	return database.DB.Query("SELECT "+columns+" FROM "+q.list.from+q.clause(), q.queryArgs()...)
+}
+
+// count - сколько записей подходит под фильтры без учёта страницы
+func (q *adminListQuery) count() (int, error) {
+	var total int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM "+q.list.from+q.whereClause(), q.args...).Scan(&total)
+	return total, err
+}
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"log"
 	"myAPI/database"
 	"myAPI/models"
 	"myAPI/utils"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -38,8 +43,8 @@ func Register(c *fiber.Ctx) error {
 
 	// Создаем пользователя
 	result, err := database.DB.Exec(
-		"INSERT INTO users (email, password, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		req.Email, string(hashedPassword), "user", time.Now(), time.Now(),
+		"INSERT INTO users (email, password, role, language, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		req.Email, string(hashedPassword), "user", requestLanguage(c, req.Language), time.Now(), time.Now(),
 	)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -48,6 +53,8 @@ func Register(c *fiber.Ctx) error {
 	}
 
 	userID, _ := result.LastInsertId()
+	notifyRegistration(int(userID))
+	emitUserEvent(models.EventUserRegistered, int(userID))
 
 	// Генерируем токен
 	token, err := utils.GenerateToken(int(userID), req.Email, "user")
@@ -113,6 +120,11 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
+	// Гостевые заказы, оформленные на подтверждённый email после прошлого входа
+	if _, err := claimGuestOrders(user.ID); err != nil {
+		log.Printf("Failed to claim guest orders for user %d: %v", user.ID, err)
+	}
+
 	// Убираем пароль из ответа
 	user.Password = ""
 
@@ -121,3 +133,250 @@ func Login(c *fiber.Ctx) error {
 		User:  user,
 	})
 }
+
+// passwordResetTTL - срок действия ссылки для сброса пароля
+const passwordResetTTL = time.Hour
+
+// ForgotPassword - отправка ссылки для сброса пароля.
+// Ответ одинаковый независимо от того, зарегистрирован ли email.
+func ForgotPassword(c *fiber.Ctx) error {
+	var req models.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var userID int
+	err := database.DB.QueryRow("SELECT id FROM users WHERE email = ?", strings.TrimSpace(req.Email)).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	if err == nil {
+		token, err := createPasswordResetToken(userID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to create reset token",
+			})
+		}
+		notifyPasswordReset(userID, token)
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// ResetPassword - установка нового пароля по токену из письма; токен одноразовый
+func ResetPassword(c *fiber.Ctx) error {
+	var req models.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if len(req.Password) < 6 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Password must be at least 6 characters",
+		})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var expiresAt time.Time
+	err = tx.QueryRow(
+		"SELECT user_id, expires_at FROM password_resets WHERE token_hash = ? AND used_at IS NULL",
+		hashToken(req.Token),
+	).Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to hash password",
+		})
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE users SET password = ?, updated_at = ? WHERE id = ?", string(hashedPassword), now, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update password",
+		})
+	}
+	// Гасим все выданные пользователю ссылки, а не только использованную
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update password",
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update password",
+		})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// emailVerificationTTL - срок действия ссылки для подтверждения email
+const emailVerificationTTL = 24 * time.Hour
+
+// RequestEmailVerification - повторная отправка ссылки для подтверждения email
+func RequestEmailVerification(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var verifiedAt sql.NullTime
+	if err := database.DB.QueryRow("SELECT email_verified_at FROM users WHERE id = ?", userID).Scan(&verifiedAt); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if verifiedAt.Valid {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Email already verified",
+		})
+	}
+
+	token, err := createEmailVerificationToken(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create verification token",
+		})
+	}
+	notifyEmailVerification(userID, token)
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// VerifyEmail подтверждает email по токену из письма и привязывает к аккаунту
+// гостевые заказы, оформленные на этот адрес
+func VerifyEmail(c *fiber.Ctx) error {
+	var req models.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var expiresAt time.Time
+	err = tx.QueryRow(
+		"SELECT user_id, expires_at FROM email_verifications WHERE token_hash = ? AND used_at IS NULL",
+		hashToken(req.Token),
+	).Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?), updated_at = ? WHERE id = ?", now, now, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to verify email",
+		})
+	}
+	if _, err := tx.Exec("UPDATE email_verifications SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to verify email",
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to verify email",
+		})
+	}
+
+	claimed, err := claimGuestOrders(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to claim guest orders",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":        true,
+		"claimed_orders": claimed,
+	})
+}
+
+// createEmailVerificationToken выдаёт случайный токен подтверждения email; в базе хранится только его хеш
+func createEmailVerificationToken(userID int) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = database.DB.Exec(
+		"INSERT INTO email_verifications (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		userID, hashToken(token), now.Add(emailVerificationTTL), now,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// createPasswordResetToken выдаёт случайный токен; в базе хранится только его хеш
+func createPasswordResetToken(userID int) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	now := time.Now()
+	_, err := database.DB.Exec(
+		"INSERT INTO password_resets (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		userID, hashToken(token), now.Add(passwordResetTTL), now,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// hashToken - SHA-256 одноразовых токенов из ссылок: в базе хранится только хеш
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
@@ -9,10 +9,10 @@ import (
 
 // BannerItem - структура, возвращаемая API
 type BannerItem struct {
-	ID        int            `json:"id"`
-	ProductID int            `json:"product_id"`
-	Image     string         `json:"image"`
-	Position  int            `json:"position"`
+	ID        int             `json:"id"`
+	ProductID int             `json:"product_id"`
+	Image     string          `json:"image"`
+	Position  int             `json:"position"`
 	Product   *models.Product `json:"product,omitempty"`
 }
 
@@ -20,7 +20,7 @@ func GetBanners(c *fiber.Ctx) error {
 	// Return banner records with embedded product and category data
 	query := `SELECT b.id, b.product_id, b.image, b.position,
 		p.id, p.name, p.price, p.short_description, p.long_description,
-		p.sku, p.discount, p.images, p.category_id, p.created_at, p.updated_at,
+		p.sku, p.discount, p.stock, p.weight, p.gift_card, p.images, p.category_id, p.created_at, p.updated_at,
 		c.id, c.name, c.alias
 		FROM banners b
 		JOIN products p ON b.product_id = p.id
@@ -41,13 +41,15 @@ func GetBanners(c *fiber.Ctx) error {
 
 		if err := rows.Scan(&it.ID, &it.ProductID, &it.Image, &it.Position,
 			&prod.ID, &prod.Name, &prod.Price, &prod.ShortDescription, &prod.LongDescription,
-			&prod.SKU, &prod.Discount, &prod.Images, &prod.CategoryID, &prod.CreatedAt, &prod.UpdatedAt,
-			&cat.ID, &cat.Name, &cat.Alias);
-			err != nil {
+			&prod.SKU, &prod.Discount, &prod.Stock, &prod.Weight, &prod.GiftCard, &prod.Images, &prod.CategoryID, &prod.CreatedAt, &prod.UpdatedAt,
+			&cat.ID, &cat.Name, &cat.Alias); err != nil {
 			continue
 		}
 
 		prod.Category = &cat
+		if err := applyBundle(&prod); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch banners"})
+		}
 		it.Product = &prod
 		items = append(items, it)
 	}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"myAPI/database"
+	"myAPI/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bundleInfo - состав набора и его ценовой режим
+type bundleInfo struct {
+	Discount   *int
+	Components []models.BundleComponent
+}
+
+// loadBundles возвращает состав наборов среди productIDs; обычных товаров в результате нет
+func loadBundles(productIDs []int) (map[int]*bundleInfo, error) {
+	bundles := map[int]*bundleInfo{}
+	if len(productIDs) == 0 {
+		return bundles, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(productIDs)), ",")
+	args := make([]interface{}, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT bi.bundle_id, b.bundle_discount, p.id, p.name, p.sku, bi.quantity, p.price, p.discount, p.stock, p.weight, p.images
+		FROM bundle_items bi
+		JOIN products b ON b.id = bi.bundle_id
+		JOIN products p ON p.id = bi.product_id
+		WHERE bi.bundle_id IN (`+placeholders+`)
+		ORDER BY bi.bundle_id, p.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bundleID, discount int
+		var bundleDiscount sql.NullInt64
+		var c models.BundleComponent
+		if err := rows.Scan(&bundleID, &bundleDiscount, &c.ProductID, &c.Name, &c.SKU, &c.Quantity,
+			&c.Price, &discount, &c.Stock, &c.Weight, &c.Images); err != nil {
+			return nil, err
+		}
+		c.Price = c.Price.ApplyDiscount(discount)
+
+		info, ok := bundles[bundleID]
+		if !ok {
+			info = &bundleInfo{}
+			if bundleDiscount.Valid {
+				d := int(bundleDiscount.Int64)
+				info.Discount = &d
+			}
+			bundles[bundleID] = info
+		}
+		info.Components = append(info.Components, c)
+	}
+
+	return bundles, rows.Err()
+}
+
+// applyBundles дополняет наборы составом и вычисляемыми полями: остаток - сколько наборов можно собрать
+// из компонентов, вес - сумма компонентов, если у набора он не задан, а при скидке набора
+// цена - сумма цен компонентов, к которой применяется эта скидка
+func applyBundles(products []models.Product) error {
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	bundles, err := loadBundles(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		info, ok := bundles[products[i].ID]
+		if !ok {
+			continue
+		}
+		p := &products[i]
+		p.Components = info.Components
+		p.BundleDiscount = info.Discount
+		p.Stock = bundleStock(info.Components)
+
+		var price models.Money
+		var weight int
+		for _, c := range info.Components {
+			price += c.Price.Mul(c.Quantity)
+			weight += c.Weight * c.Quantity
+		}
+		if info.Discount != nil {
+			p.Price, p.Discount = price, *info.Discount
+		}
+		if p.Weight == 0 {
+			p.Weight = weight
+		}
+	}
+	return nil
+}
+
+// applyBundle - applyBundles для одного товара
+func applyBundle(product *models.Product) error {
+	products := []models.Product{*product}
+	if err := applyBundles(products); err != nil {
+		return err
+	}
+	*product = products[0]
+	return nil
+}
+
+// bundleStock - сколько наборов можно собрать; nil, если ни у одного компонента остаток не отслеживается
+func bundleStock(components []models.BundleComponent) *int {
+	var stock *int
+	for _, c := range components {
+		if c.Stock == nil {
+			continue
+		}
+		available := *c.Stock / c.Quantity
+		if stock == nil || available < *stock {
+			stock = &available
+		}
+	}
+	return stock
+}
+
+// stockDemand - сколько единиц каждого товара со складом списывает заказ: наборы раскладываются на компоненты.
+// ids - товары в порядке первого появления, чтобы ошибки были воспроизводимыми.
+func stockDemand(products []models.Product, counts map[int]int) (ids []int, demand map[int]int, stock map[int]*int) {
+	demand = map[int]int{}
+	stock = map[int]*int{}
+	add := func(id, quantity int, s *int) {
+		if _, ok := demand[id]; !ok {
+			ids = append(ids, id)
+		}
+		demand[id] += quantity
+		stock[id] = s
+	}
+
+	for _, p := range products {
+		if len(p.Components) == 0 {
+			add(p.ID, counts[p.ID], p.Stock)
+			continue
+		}
+		for _, c := range p.Components {
+			add(c.ProductID, counts[p.ID]*c.Quantity, c.Stock)
+		}
+	}
+	return ids, demand, stock
+}
+
+// insertBundleComponents сохраняет компоненты набора строками order_items со ссылкой на строку набора
+// и списывает их остатки
+func insertBundleComponents(tx *sql.Tx, orderID, parentID int64, p models.Product, quantity int) error {
+	for _, c := range p.Components {
+		if _, err := tx.Exec(
+			"INSERT INTO order_items (order_id, product_id, quantity, price, list_price, parent_id) VALUES (?, ?, ?, 0, 0, ?)",
+			orderID, c.ProductID, c.Quantity*quantity, parentID,
+		); err != nil {
+			return err
+		}
+		if err := adjustStock(tx, c.ProductID, -c.Quantity*quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restockOrderItem возвращает на склад quantity единиц позиции заказа.
+// Набор возвращается компонентами в том составе, в котором он был продан.
+func restockOrderItem(tx *sql.Tx, item models.OrderItem, quantity int) error {
+	if len(item.Components) == 0 {
+		return adjustStock(tx, item.ProductID, quantity)
+	}
+	for _, c := range item.Components {
+		if err := adjustStock(tx, c.ProductID, c.Quantity/item.Quantity*quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundleItemsFromMap разбирает состав набора из тела админского запроса: [{"product_id": 1, "quantity": 2}, ...].
+// ok == false, если поле bundle_items не передано и состав менять не нужно.
+func bundleItemsFromMap(data map[string]interface{}) (items []models.BundleItem, ok bool, err error) {
+	raw, ok := data["bundle_items"]
+	if !ok {
+		return nil, false, nil
+	}
+	list, isList := raw.([]interface{})
+	if raw != nil && !isList {
+		return nil, true, fiber.NewError(400, "bundle_items must be a list")
+	}
+
+	quantities := map[int]int{}
+	for _, v := range list {
+		m, isMap := v.(map[string]interface{})
+		if !isMap {
+			return nil, true, fiber.NewError(400, "bundle_items must contain product_id and quantity")
+		}
+		item := models.BundleItem{ProductID: toInt(m["product_id"]), Quantity: toInt(m["quantity"])}
+		if _, set := m["quantity"]; !set {
+			item.Quantity = 1
+		}
+		if item.ProductID <= 0 || item.Quantity <= 0 {
+			return nil, true, fiber.NewError(400, "bundle item needs product_id and a positive quantity")
+		}
+		if _, dup := quantities[item.ProductID]; dup {
+			return nil, true, fiber.NewError(400, fmt.Sprintf("product %d is listed twice in the bundle", item.ProductID))
+		}
+		quantities[item.ProductID] = item.Quantity
+		items = append(items, item)
+	}
+	return items, true, nil
+}
+
+// validateBundle проверяет состав набора: компоненты существуют, сами не являются наборами
+// и подарочными сертификатами, а набор не входит в другие наборы (вложенность не поддерживается).
+// Компонент набора не может стать подарочным сертификатом.
+func validateBundle(bundleID int, items []models.BundleItem, giftCard bool) error {
+	if bundleID != 0 && (giftCard || len(items) > 0) {
+		var parents int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM bundle_items WHERE product_id = ?", bundleID).Scan(&parents); err != nil {
+			return err
+		}
+		if parents > 0 {
+			return fiber.NewError(400, fmt.Sprintf("product %d is a component of another bundle", bundleID))
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	if giftCard {
+		return fiber.NewError(400, "gift card product cannot be a bundle")
+	}
+
+	for _, item := range items {
+		if item.ProductID == bundleID {
+			return fiber.NewError(400, "bundle cannot contain itself")
+		}
+		var isGiftCard bool
+		var components int
+		err := database.DB.QueryRow(
+			"SELECT COALESCE(gift_card, 0), (SELECT COUNT(*) FROM bundle_items WHERE bundle_id = products.id) FROM products WHERE id = ?",
+			item.ProductID,
+		).Scan(&isGiftCard, &components)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(400, fmt.Sprintf("product %d not found", item.ProductID))
+		}
+		if err != nil {
+			return err
+		}
+		if isGiftCard || components > 0 {
+			return fiber.NewError(400, fmt.Sprintf("product %d cannot be a bundle component", item.ProductID))
+		}
+	}
+	return nil
+}
+
+// validateBundleDiscount - скидка набора в процентах; пустое значение - у набора своя цена
+func validateBundleDiscount(discount sql.NullInt64) error {
+	if discount.Valid && (discount.Int64 < 0 || discount.Int64 > 100) {
+		return fiber.NewError(400, "bundle_discount must be between 0 and 100")
+	}
+	return nil
+}
+
+// saveBundleItems заменяет состав набора. У набора нет своего остатка - он считается по компонентам.
+func saveBundleItems(db sqlExecer, bundleID int, items []models.BundleItem) error {
+	if _, err := db.Exec("DELETE FROM bundle_items WHERE bundle_id = ?", bundleID); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if _, err := db.Exec(
+			"INSERT INTO bundle_items (bundle_id, product_id, quantity) VALUES (?, ?, ?)",
+			bundleID, item.ProductID, item.Quantity,
+		); err != nil {
+			return err
+		}
+	}
+	if len(items) > 0 {
+		if _, err := db.Exec("UPDATE products SET stock = NULL WHERE id = ?", bundleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getBundleItems - текущий состав набора; пусто для обычного товара
+func getBundleItems(bundleID int) ([]models.BundleItem, error) {
+	rows, err := database.DB.Query("SELECT product_id, quantity FROM bundle_items WHERE bundle_id = ? ORDER BY product_id", bundleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.BundleItem
+	for rows.Next() {
+		var item models.BundleItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// bundleItemsForAdmin - составы всех наборов для списка товаров в админке
+func bundleItemsForAdmin() (map[int][]models.BundleItem, error) {
+	rows, err := database.DB.Query("SELECT bundle_id, product_id, quantity FROM bundle_items ORDER BY bundle_id, product_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := map[int][]models.BundleItem{}
+	for rows.Next() {
+		var bundleID int
+		var item models.BundleItem
+		if err := rows.Scan(&bundleID, &item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		items[bundleID] = append(items[bundleID], item)
+	}
+	return items, rows.Err()
+}
+
+// checkProductNotInBundle не даёт удалить товар, входящий в набор: иначе набор потеряет компонент
+func checkProductNotInBundle(productID int) error {
+	var bundleID int
+	err := database.DB.QueryRow("SELECT bundle_id FROM bundle_items WHERE product_id = ? LIMIT 1", productID).Scan(&bundleID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fiber.NewError(409, fmt.Sprintf("product is a component of bundle %d", bundleID))
+}
@@ -44,7 +44,7 @@ func AddToCart(c *fiber.Ctx) error {
 
 	// Проверяем существование товара и получим текущую цену и скидку
 	var productID int
-	var prodPrice float64
+	var prodPrice models.Money
 	var prodDiscount int
 	err = database.DB.QueryRow("SELECT id, price, discount FROM products WHERE id = ?", req.ProductID).Scan(&productID, &prodPrice, &prodDiscount)
 	if err == sql.ErrNoRows {
@@ -66,7 +66,7 @@ func AddToCart(c *fiber.Ctx) error {
 	).Scan(&existingQuantity)
 
 	// Рассчитаем цену с учётом скидки и сохраним её в cart_items.price
-	discounted := prodPrice * (1 - float64(prodDiscount)/100.0)
+	discounted := prodPrice.ApplyDiscount(prodDiscount)
 
 	switch err {
 	case sql.ErrNoRows:
@@ -104,9 +104,15 @@ func GetCart(c *fiber.Ctx) error {
 		})
 	}
 
+	// Цены товаров корзины - в валюте ?currency=
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
 	// Получаем ID пользователя
 	var userID int
-	err := database.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+	err = database.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
 	if err == sql.ErrNoRows {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "User not found",
@@ -122,7 +128,7 @@ func GetCart(c *fiber.Ctx) error {
 	rows, err := database.DB.Query(`
 		SELECT 
 			p.id, p.name, p.price, p.short_description, p.long_description,
-			p.sku, p.discount, p.category_id, p.created_at, p.updated_at,
+			p.sku, p.discount, p.stock, p.weight, p.gift_card, p.category_id, p.created_at, p.updated_at,
 			ci.quantity
 		FROM cart_items ci
 		JOIN products p ON ci.product_id = p.id
@@ -149,7 +155,7 @@ func GetCart(c *fiber.Ctx) error {
 
 		err := rows.Scan(
 			&product.ID, &product.Name, &product.Price, &product.ShortDescription,
-			&product.LongDescription, &product.SKU, &product.Discount, &product.CategoryID,
+			&product.LongDescription, &product.SKU, &product.Discount, &product.Stock, &product.Weight, &product.GiftCard, &product.CategoryID,
 			&product.CreatedAt, &product.UpdatedAt, &quantity,
 		)
 		if err != nil {
@@ -158,6 +164,12 @@ func GetCart(c *fiber.Ctx) error {
 			})
 		}
 
+		if err := applyBundle(&product); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to get cart",
+			})
+		}
+		product.Price = convertPrice(product.Price, cur)
 		cartItems = append(cartItems, CartItemResponse{
 			Product:  product,
 			Quantity: quantity,
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"myAPI/database"
+	"myAPI/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ApplyCoupon - предварительный расчёт скидки по промокоду без оформления заказа
+func ApplyCoupon(c *fiber.Ctx) error {
+	var req models.ApplyCouponRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if strings.TrimSpace(req.Code) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Coupon code is required"})
+	}
+
+	userID, authenticated := currentUserID(c)
+
+	// Товары берём из запроса, либо из корзины авторизованного пользователя
+	productIDs := req.ProductIDs
+	if len(productIDs) == 0 {
+		if !authenticated {
+			return c.Status(401).JSON(fiber.Map{"error": "Authorization required to use the cart"})
+		}
+
+		ids, err := getCartProductIDs(userID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to get cart"})
+		}
+		productIDs = ids
+	}
+
+	if len(productIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Product IDs are required"})
+	}
+
+	products, counts, err := loadOrderItems(productIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch products"})
+	}
+	subtotal := itemsTotal(products, counts)
+
+	result, err := evaluateCoupon(req.Code, userID, "", products, counts)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(models.CouponPreview{
+		Code:     result.Coupon.Code,
+		Subtotal: subtotal,
+		Discount: result.Discount,
+		Total:    subtotal - result.Discount,
+	})
+}
+
+// couponResult - купон и рассчитанная по нему скидка
+type couponResult struct {
+	Coupon   models.Coupon
+	Discount models.Money
+}
+
+// evaluateCoupon проверяет применимость купона к набору товаров и считает скидку.
+// Покупатель - пользователь userID или гость с email (для лимита на покупателя).
+// Ошибки валидации возвращаются как *fiber.Error с кодом 400.
+func evaluateCoupon(code string, userID int, email string, products []models.Product, counts map[int]int) (*couponResult, error) {
+	coupon, err := getCouponByCode(code)
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(400, "Coupon not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !coupon.Active {
+		return nil, fiber.NewError(400, "Coupon is not active")
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return nil, fiber.NewError(400, "Coupon is not valid yet")
+	}
+	if coupon.EndsAt != nil && now.After(*coupon.EndsAt) {
+		return nil, fiber.NewError(400, "Coupon has expired")
+	}
+
+	if err := checkCouponLimits(database.DB, coupon, userID, email); err != nil {
+		return nil, err
+	}
+
+	// Сертификаты не учитываются в минимальной сумме, иначе её можно набрать покупкой карты
+	total := discountableTotal(products, counts)
+	if total < coupon.MinOrderTotal {
+		return nil, fiber.NewError(400, "Order total is below coupon minimum")
+	}
+
+	// Сумма товаров, на которые распространяется купон
+	var eligible models.Money
+	for _, p := range products {
+		if !couponAppliesTo(coupon, p) {
+			continue
+		}
+		eligible += discountedPrice(p).Mul(counts[p.ID])
+	}
+	if eligible <= 0 {
+		return nil, fiber.NewError(400, "Coupon does not apply to these products")
+	}
+
+	var discount models.Money
+	switch coupon.Type {
+	case models.CouponTypePercent:
+		discount = eligible.Percent(coupon.Value)
+	case models.CouponTypeFixed:
+		discount = models.Money(coupon.Value)
+	}
+	// Скидка не может увеличить сумму заказа или превысить стоимость подходящих товаров
+	discount = min(max(discount, 0), eligible)
+
+	return &couponResult{Coupon: *coupon, Discount: discount}, nil
+}
+
+// couponAppliesTo проверяет ограничения купона по товарам, категориям и совместимости со скидками.
+// На подарочные сертификаты купоны не действуют: карта выпускается на цену позиции.
+func couponAppliesTo(coupon *models.Coupon, p models.Product) bool {
+	if p.GiftCard {
+		return false
+	}
+	if !coupon.Stackable && p.Discount > 0 {
+		return false
+	}
+	if len(coupon.ProductIDs) == 0 && len(coupon.CategoryIDs) == 0 {
+		return true
+	}
+	for _, id := range coupon.ProductIDs {
+		if id == p.ID {
+			return true
+		}
+	}
+	for _, id := range coupon.CategoryIDs {
+		if id == p.CategoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCouponLimits проверяет общий лимит использований купона и лимит на покупателя.
+// Покупатель узнаётся по пользователю и по email: гостевые заказы и заказы аккаунта с тем же email
+// считаются вместе.
+func checkCouponLimits(db sqlQueryer, coupon *models.Coupon, userID int, email string) error {
+	if coupon.UsageLimit > 0 {
+		var used int
+		if err := db.QueryRow("SELECT COUNT(*) FROM coupon_usages WHERE coupon_id = ?", coupon.ID).Scan(&used); err != nil {
+			return err
+		}
+		if used >= coupon.UsageLimit {
+			return fiber.NewError(400, "Coupon usage limit reached")
+		}
+	}
+
+	email = normalizeEmail(email)
+	if coupon.PerUserLimit > 0 && (userID > 0 || email != "") {
+		var used int
+		err := db.QueryRow(`
+			SELECT COUNT(*) FROM coupon_usages
+			WHERE coupon_id = ? AND (user_id = ? OR email = ? OR email = (SELECT LOWER(TRIM(email)) FROM users WHERE id = ?))
+		`, coupon.ID, userID, email, userID).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used >= coupon.PerUserLimit {
+			return fiber.NewError(400, "Coupon already used")
+		}
+	}
+	return nil
+}
+
+// recordCouponUsage фиксирует использование купона в заказе внутри транзакции его создания.
+// Лимиты проверяются повторно, чтобы одновременные заказы не превысили их.
+func recordCouponUsage(tx *sql.Tx, result *couponResult, userID int, email string, orderID int64) error {
+	if err := checkCouponLimits(tx, &result.Coupon, userID, email); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO coupon_usages (coupon_id, user_id, email, order_id, discount, created_at)
+		VALUES (?, ?, COALESCE(?, (SELECT LOWER(TRIM(email)) FROM users WHERE id = ?)), ?, ?, ?)
+	`, result.Coupon.ID, nullID(userID), nullString(normalizeEmail(email)), userID, orderID, result.Discount, time.Now())
+	return err
+}
+
+func getCouponByCode(code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	var startsAt, endsAt sql.NullTime
+
+	err := database.DB.QueryRow(`
+		SELECT id, code, type, value, min_order_total, category_ids, product_ids,
+		       starts_at, ends_at, usage_limit, per_user_limit, stackable, active, created_at
+		FROM coupons
+		WHERE code = ?
+	`, normalizeCouponCode(code)).Scan(
+		&coupon.ID, &coupon.Code, &coupon.Type, &coupon.Value, &coupon.MinOrderTotal,
+		&coupon.CategoryIDs, &coupon.ProductIDs, &startsAt, &endsAt,
+		&coupon.UsageLimit, &coupon.PerUserLimit, &coupon.Stackable, &coupon.Active, &coupon.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if startsAt.Valid {
+		coupon.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		coupon.EndsAt = &endsAt.Time
+	}
+
+	return &coupon, nil
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// normalizeEmail - email для сравнения: без пробелов по краям и в нижнем регистре
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// getCartProductIDs разворачивает корзину пользователя в список id с повторами по количеству
+func getCartProductIDs(userID int) ([]int, error) {
+	rows, err := database.DB.Query("SELECT product_id, quantity FROM cart_items WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			continue
+		}
+		for i := 0; i < quantity; i++ {
+			ids = append(ids, productID)
+		}
+	}
+
+	return ids, nil
+}
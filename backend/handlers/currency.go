@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"database/sql"
+	"myAPI/currency"
+	"myAPI/database"
+	"myAPI/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// baseCurrency - рубль: цены хранятся в нём и конвертировать их не нужно
+var baseCurrency = models.Currency{Code: currency.Base, Name: "Российский рубль", Rate: 1, Decimals: currency.MaxDecimals}
+
+// GetCurrencies - валюты, в которых можно смотреть цены, с текущими курсами
+func GetCurrencies(c *fiber.Ctx) error {
+	currencies, err := queryCurrencies("ORDER BY code")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch currencies"})
+	}
+
+	return c.JSON(fiber.Map{
+		"base":       currency.Base,
+		"currencies": append([]models.Currency{baseCurrency}, currencies...),
+	})
+}
+
+// AdminImportCurrencyRates загружает курсы из CSV-файла (поле file): code,rate[,decimals][,name].
+// Существующие валюты обновляются, новые добавляются; файл применяется целиком или не применяется вовсе.
+func AdminImportCurrencyRates(c *fiber.Ctx) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file not provided"})
+	}
+	if fileHeader.Size > 1<<20 {
+		return c.Status(400).JSON(fiber.Map{"error": "file is too large"})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to read file"})
+	}
+	defer file.Close()
+
+	rates, err := currency.ParseRates(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, rate := range rates {
+		_, err := tx.Exec(`
+			INSERT INTO currency_rates (code, name, rate, decimals, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(code) DO UPDATE SET
+				name = COALESCE(NULLIF(excluded.name, ''), currency_rates.name),
+				rate = excluded.rate, decimals = excluded.decimals, updated_at = excluded.updated_at
+		`, rate.Code, rate.Name, rate.Rate, rate.Decimals, now)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to save rates"})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save rates"})
+	}
+
+	return c.JSON(fiber.Map{"imported": len(rates)})
+}
+
+// getCurrency - валюта по коду; рубль есть всегда, неизвестный код - *fiber.Error с кодом 400
+func getCurrency(code string) (*models.Currency, error) {
+	code = currency.NormalizeCode(code)
+	if code == "" || code == currency.Base {
+		cur := baseCurrency
+		return &cur, nil
+	}
+	if !currency.ValidCode(code) {
+		return nil, fiber.NewError(400, "Unknown currency")
+	}
+
+	var cur models.Currency
+	err := database.DB.QueryRow("SELECT "+currencyColumns+" FROM currency_rates WHERE code = ?", code).Scan(
+		&cur.ID, &cur.Code, &cur.Name, &cur.Rate, &cur.Decimals, &cur.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(400, "Unknown currency")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+// requestCurrency - валюта из параметра ?currency=; nil, если суммы отдаются в рублях
+func requestCurrency(c *fiber.Ctx) (*models.Currency, error) {
+	cur, err := getCurrency(c.Query("currency"))
+	if err != nil || cur.Code == currency.Base {
+		return nil, err
+	}
+	return cur, nil
+}
+
+// currencyCode - код валюты, в которой отданы суммы ответа
+func currencyCode(cur *models.Currency) string {
+	if cur == nil {
+		return currency.Base
+	}
+	return cur.Code
+}
+
+// convertPrice переводит сумму в рублях в валюту cur по текущему курсу
+func convertPrice(m models.Money, cur *models.Currency) models.Money {
+	if cur == nil {
+		return m
+	}
+	return currency.Convert(m, cur.Rate, cur.Decimals)
+}
+
+// convertProducts переводит цены товаров в валюту cur; скидка в процентах не меняется
+func convertProducts(products []models.Product, cur *models.Currency) {
+	for i := range products {
+		products[i].Price = convertPrice(products[i].Price, cur)
+	}
+}
+
+// convertOrder переводит все суммы заказа в валюту cur. Если это валюта, выбранная при оформлении,
+// используется курс на момент заказа, чтобы покупатель видел те же суммы, что и при покупке.
+func convertOrder(order *models.Order, cur *models.Currency) {
+	if cur == nil {
+		return
+	}
+	rate := cur.Rate
+	if order.Currency == cur.Code && order.ExchangeRate > 0 {
+		rate = order.ExchangeRate
+	}
+	convert := func(m *models.Money) {
+		*m = currency.Convert(*m, rate, cur.Decimals)
+	}
+
+	for _, m := range []*models.Money{
+		&order.Price, &order.CouponDiscount, &order.RefundedAmount, &order.ShippingCost,
+		&order.LoyaltyDiscount, &order.GiftCardAmount, &order.TaxAmount, &order.ShippingTax,
+	} {
+		convert(m)
+	}
+	for i := range order.TaxLines {
+		convert(&order.TaxLines[i].Amount)
+	}
+	for i := range order.Items {
+		convert(&order.Items[i].Price)
+		convert(&order.Items[i].ListPrice)
+		convert(&order.Items[i].TaxAmount)
+	}
+	for i := range order.Products {
+		convert(&order.Products[i].Price)
+	}
+}
+
+// baseAmount - сумма в рублях для суммы amount в валюте cur (фильтры по цене)
+func baseAmount(amount float64, cur *models.Currency) models.Money {
+	if cur == nil {
+		return models.MoneyFromFloat(amount)
+	}
+	return currency.ToBase(amount, cur.Rate)
+}
+
+const currencyColumns = "id, code, COALESCE(name, ''), rate, decimals, updated_at"
+
+// queryCurrencies - валюты из справочника; clause - условия и сортировка после FROM currency_rates
+func queryCurrencies(clause string, args ...interface{}) ([]models.Currency, error) {
+	rows, err := database.DB.Query("SELECT "+currencyColumns+" FROM currency_rates "+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currencies := []models.Currency{}
+	for rows.Next() {
+		var cur models.Currency
+		if err := rows.Scan(&cur.ID, &cur.Code, &cur.Name, &cur.Rate, &cur.Decimals, &cur.UpdatedAt); err != nil {
+			continue
+		}
+		currencies = append(currencies, cur)
+	}
+	return currencies, nil
+}
+
+// Helper functions for Currencies (admin)
+var currenciesAdminList = &adminList{
+	from: "currency_rates",
+	fields: map[string]adminField{
+		"id":         {"id", fieldInt},
+		"code":       {"code", fieldText},
+		"name":       {"name", fieldText},
+		"rate":       {"rate", fieldFloat},
+		"decimals":   {"decimals", fieldInt},
+		"updated_at": {"updated_at", fieldTime},
+	},
+	search: []string{"code", "name"},
+	sort:   "code",
+}
+
+func getCurrenciesForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	currencies, err := queryCurrencies(q.clause(), q.queryArgs()...)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	for _, cur := range currencies {
+		items = append(items, map[string]interface{}{
+			"id":         cur.ID,
+			"code":       cur.Code,
+			"name":       cur.Name,
+			"rate":       cur.Rate,
+			"decimals":   cur.Decimals,
+			"updated_at": cur.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+// currencyFromMap разбирает и проверяет валюту из тела админского запроса
+func currencyFromMap(data map[string]interface{}) (models.Currency, error) {
+	cur := models.Currency{
+		Code:     currency.NormalizeCode(toString(data["code"])),
+		Name:     toString(data["name"]),
+		Rate:     toFloat64(data["rate"]),
+		Decimals: currency.MaxDecimals,
+	}
+	if _, ok := data["decimals"]; ok {
+		cur.Decimals = toInt(data["decimals"])
+	}
+	return cur, currency.Validate(cur)
+}
+
+func createCurrency(data map[string]interface{}) (int64, error) {
+	cur, err := currencyFromMap(data)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO currency_rates (code, name, rate, decimals, updated_at) VALUES (?, ?, ?, ?, ?)",
+		cur.Code, cur.Name, cur.Rate, cur.Decimals, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func updateCurrency(id int, data map[string]interface{}) error {
+	cur, err := currencyFromMap(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE currency_rates SET code = ?, name = ?, rate = ?, decimals = ?, updated_at = ? WHERE id = ?",
+		cur.Code, cur.Name, cur.Rate, cur.Decimals, time.Now(), id,
+	)
+	return err
+}
+
+// deleteCurrency удаляет валюту; в оформленных заказах код и курс сохранены
+func deleteCurrency(id int) error {
+	_, err := database.DB.Exec("DELETE FROM currency_rates WHERE id = ?", id)
+	return err
+}
@@ -2,13 +2,15 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/json"
 	"myAPI/database"
+	"myAPI/models"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// SaveFavorites сохраняет список избранных товаров для пользователя
+// SaveFavorites сохраняет список избранных товаров для пользователя.
+// Список заменяется целиком; ID несуществующих товаров пропускаются.
 func SaveFavorites(c *fiber.Ctx) error {
     var req struct {
         Email      string `json:"email"`
@@ -29,27 +31,62 @@ func SaveFavorites(c *fiber.Ctx) error {
         return c.Status(500).JSON(fiber.Map{"error": "Database error"})
     }
 
-    // Сохраняем productIDs как JSON
-    data, _ := json.Marshal(req.ProductIDs)
-
-    // Используем INSERT OR REPLACE для обновления
-    _, err = database.DB.Exec(`INSERT OR REPLACE INTO favorites (user_id, product_ids, updated_at) VALUES (?, ?, datetime('now'))`, userID, string(data))
+    tx, err := database.DB.Begin()
     if err != nil {
+        return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+    }
+    defer tx.Rollback()
+
+    // Убираем товары, которых больше нет в списке; у оставшихся сохраняется дата добавления
+    query := "DELETE FROM favorite_products WHERE user_id = ?"
+    args := []interface{}{userID}
+    if len(req.ProductIDs) > 0 {
+        query += " AND product_id NOT IN (" + strings.TrimSuffix(strings.Repeat("?,", len(req.ProductIDs)), ",") + ")"
+        for _, id := range req.ProductIDs {
+            args = append(args, id)
+        }
+    }
+    if _, err := tx.Exec(query, args...); err != nil {
+        return c.Status(500).JSON(fiber.Map{"error": "Failed to save favorites"})
+    }
+
+    for _, id := range req.ProductIDs {
+        _, err := tx.Exec(`
+            INSERT OR IGNORE INTO favorite_products (user_id, product_id, created_at)
+            SELECT ?, id, datetime('now') FROM products WHERE id = ?
+        `, userID, id)
+        if err != nil {
+            return c.Status(500).JSON(fiber.Map{"error": "Failed to save favorites"})
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
         return c.Status(500).JSON(fiber.Map{"error": "Failed to save favorites"})
     }
 
     return c.JSON(fiber.Map{"success": true})
 }
 
-// GetFavorites возвращает массив product IDs для пользователя
+// GetFavorites возвращает массив product IDs для пользователя в порядке добавления.
+// С ?expand=products вместо ID отдаются карточки товаров с ценами и остатками (поддерживает ?currency=).
 func GetFavorites(c *fiber.Ctx) error {
     email := c.Query("email")
     if email == "" {
         return c.Status(400).JSON(fiber.Map{"error": "Email is required"})
     }
 
+    expand := c.Query("expand")
+    if expand != "" && expand != "products" {
+        return c.Status(400).JSON(fiber.Map{"error": "expand must be products"})
+    }
+
+    cur, err := requestCurrency(c)
+    if err != nil {
+        return errorResponse(c, err)
+    }
+
     var userID int
-    err := database.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+    err = database.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
     if err == sql.ErrNoRows {
         return c.Status(404).JSON(fiber.Map{"error": "User not found"})
     }
@@ -57,20 +94,51 @@ func GetFavorites(c *fiber.Ctx) error {
         return c.Status(500).JSON(fiber.Map{"error": "Database error"})
     }
 
-    var raw string
-    err = database.DB.QueryRow("SELECT product_ids FROM favorites WHERE user_id = ?", userID).Scan(&raw)
-    if err == sql.ErrNoRows {
-        // возвращаем пустой массив, если нет записи
-        return c.JSON([]int{})
-    }
+    ids, err := favoriteProductIDs(userID)
     if err != nil {
         return c.Status(500).JSON(fiber.Map{"error": "Database error"})
     }
 
-    var ids []int
-    if err := json.Unmarshal([]byte(raw), &ids); err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": "Failed to parse favorites"})
+    if expand == "" {
+        return c.JSON(ids)
+    }
+
+    products, err := getProductsByIDs(ids)
+    if err != nil {
+        return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch products"})
+    }
+    convertProducts(products, cur)
+
+    // getProductsByIDs не сохраняет порядок, восстанавливаем порядок добавления
+    byID := make(map[int]models.Product, len(products))
+    for _, p := range products {
+        byID[p.ID] = p
     }
+    result := make([]models.Product, 0, len(ids))
+    for _, id := range ids {
+        if p, ok := byID[id]; ok {
+            result = append(result, p)
+        }
+    }
+
+    return c.JSON(result)
+}
 
-    return c.JSON(ids)
+// favoriteProductIDs - избранные товары пользователя в порядке добавления
+func favoriteProductIDs(userID int) (models.IntArray, error) {
+    rows, err := database.DB.Query("SELECT product_id FROM favorite_products WHERE user_id = ? ORDER BY created_at, rowid", userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    ids := models.IntArray{}
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
 }
@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/notify"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// giftCardTTL - срок действия подарочной карты, если при выпуске не указан другой
+const giftCardTTL = 365 * 24 * time.Hour
+
+// giftCardAlphabet - символы кода карты без похожих друг на друга (0/O, 1/I)
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// giftCardResult - подарочная карта, применённая к заказу
+type giftCardResult struct {
+	ID     int
+	Code   string
+	Amount models.Money // сколько списывается с карты в оплату заказа
+}
+
+// newGiftCard - данные для выпуска карты
+type newGiftCard struct {
+	Amount         models.Money
+	ExpiresAt      time.Time
+	OrderID        int
+	ProductID      int
+	RecipientEmail string
+	Note           string
+	IssuedBy       int
+}
+
+// generateGiftCardCode - случайный код вида XXXX-XXXX-XXXX-XXXX
+func generateGiftCardCode() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, v := range buf {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(giftCardAlphabet[int(v)%len(giftCardAlphabet)])
+	}
+	return b.String(), nil
+}
+
+// normalizeGiftCardCode приводит введённый код к хранимому виду: регистр и дефисы не важны
+func normalizeGiftCardCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	var b strings.Builder
+	for i, r := range code {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// giftCardStatus - статус карты с учётом срока действия
+func giftCardStatus(status string, expiresAt time.Time) string {
+	if status == models.GiftCardStatusActive && !time.Now().Before(expiresAt) {
+		return models.GiftCardStatusExpired
+	}
+	return status
+}
+
+func getGiftCard(column string, value interface{}) (*models.GiftCard, error) {
+	var card models.GiftCard
+	var voidedAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT id, code, initial_balance, balance, status, expires_at, COALESCE(order_id, 0), COALESCE(product_id, 0),
+		       COALESCE(recipient_email, ''), COALESCE(note, ''), COALESCE(issued_by, 0), voided_at, COALESCE(void_reason, ''), created_at
+		FROM gift_cards WHERE `+column+` = ?
+	`, value).Scan(&card.ID, &card.Code, &card.InitialBalance, &card.Balance, &card.Status, &card.ExpiresAt, &card.OrderID, &card.ProductID,
+		&card.RecipientEmail, &card.Note, &card.IssuedBy, &voidedAt, &card.VoidReason, &card.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if voidedAt.Valid {
+		card.VoidedAt = &voidedAt.Time
+	}
+	card.Status = giftCardStatus(card.Status, card.ExpiresAt)
+	return &card, nil
+}
+
+// evaluateGiftCard проверяет карту и считает, какую часть суммы заказа total она покрывает
+func evaluateGiftCard(code string, products []models.Product, total models.Money) (*giftCardResult, error) {
+	for _, p := range products {
+		if p.GiftCard {
+			return nil, fiber.NewError(400, "Gift cards cannot be paid with a gift card")
+		}
+	}
+
+	card, err := getGiftCard("code", normalizeGiftCardCode(code))
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(404, "Gift card not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case card.Status == models.GiftCardStatusVoid:
+		return nil, fiber.NewError(400, "Gift card is void")
+	case card.Status == models.GiftCardStatusExpired:
+		return nil, fiber.NewError(400, "Gift card has expired")
+	case card.Balance <= 0:
+		return nil, fiber.NewError(400, "Gift card has no balance")
+	}
+
+	return &giftCardResult{ID: card.ID, Code: card.Code, Amount: min(card.Balance, total)}, nil
+}
+
+// redeemGiftCard списывает с карты оплату заказа внутри транзакции его создания.
+// Условие на баланс не даёт потратить одни и те же деньги дважды при одновременных заказах.
+func redeemGiftCard(tx *sql.Tx, g *giftCardResult, orderID int64) error {
+	result, err := tx.Exec(`
+		UPDATE gift_cards SET balance = balance - ?
+		WHERE id = ? AND status = ? AND balance >= ? AND expires_at > ?
+	`, g.Amount, g.ID, models.GiftCardStatusActive, g.Amount, time.Now())
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fiber.NewError(409, "Gift card balance has changed")
+	}
+
+	return addGiftCardTransaction(tx, g.ID, int(orderID), models.GiftCardTxRedeem, -g.Amount, "", 0)
+}
+
+// addGiftCardTransaction записывает операцию с уже изменённым балансом карты
+func addGiftCardTransaction(tx *sql.Tx, cardID, orderID int, txType string, amount models.Money, reason string, adminID int) error {
+	var balance models.Money
+	if err := tx.QueryRow("SELECT balance FROM gift_cards WHERE id = ?", cardID).Scan(&balance); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO gift_card_transactions (gift_card_id, order_id, type, amount, balance_after, reason, admin_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, cardID, nullID(orderID), txType, amount, balance, nullString(reason), nullID(adminID), time.Now())
+	return err
+}
+
+// issueGiftCard выпускает карту с новым кодом и записывает операцию выпуска
+func issueGiftCard(tx *sql.Tx, g newGiftCard) (int64, error) {
+	code, err := generateGiftCardCode()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO gift_cards (code, initial_balance, balance, status, expires_at, order_id, product_id, recipient_email, note, issued_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, code, g.Amount, g.Amount, models.GiftCardStatusActive, g.ExpiresAt, nullID(g.OrderID), nullID(g.ProductID),
+		nullString(g.RecipientEmail), nullString(g.Note), nullID(g.IssuedBy), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, addGiftCardTransaction(tx, int(id), g.OrderID, models.GiftCardTxIssue, g.Amount, g.Note, g.IssuedBy)
+}
+
+// voidGiftCard аннулирует карту и списывает её остаток
+func voidGiftCard(tx *sql.Tx, cardID int, reason string, adminID int) error {
+	var balance models.Money
+	if err := tx.QueryRow("SELECT balance FROM gift_cards WHERE id = ?", cardID).Scan(&balance); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+		UPDATE gift_cards SET status = ?, balance = 0, voided_at = ?, void_reason = ? WHERE id = ?
+	`, models.GiftCardStatusVoid, time.Now(), nullString(reason), cardID)
+	if err != nil {
+		return err
+	}
+	return addGiftCardTransaction(tx, cardID, 0, models.GiftCardTxVoid, -balance, reason, adminID)
+}
+
+// syncOrderGiftCards приводит подарочные карты заказа в соответствие с его статусом:
+// оплаченный заказ (с номером счёта) выпускает карты за товары-сертификаты (по одной на единицу товара),
+// при отмене или возврате выпущенные карты аннулируются, а списанная с карты оплата возвращается на неё.
+func syncOrderGiftCards(orderID int) {
+	issued, err := reconcileOrderGiftCards(orderID)
+	if err != nil {
+		log.Printf("Failed to sync gift cards for order %d: %v", orderID, err)
+		return
+	}
+	if len(issued) > 0 {
+		notifyGiftCardsIssued(orderID, issued)
+	}
+}
+
+func reconcileOrderGiftCards(orderID int) ([]int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var giftCardID sql.NullInt64
+	var giftCardAmount models.Money
+	var paid bool
+	err = tx.QueryRow("SELECT status, gift_card_id, COALESCE(gift_card_amount, 0), invoice_number IS NOT NULL FROM orders WHERE id = ?", orderID).
+		Scan(&status, &giftCardID, &giftCardAmount, &paid)
+	if err != nil {
+		return nil, err
+	}
+	closed := status == models.OrderStatusCancelled || status == models.OrderStatusRefunded
+
+	// Оплата картой: возвращаем на карту при отмене и списываем снова, если заказ восстановили
+	if giftCardID.Valid {
+		cardID := int(giftCardID.Int64)
+		var redeemed models.Money
+		err := tx.QueryRow(`
+			SELECT COALESCE(SUM(amount), 0) FROM gift_card_transactions
+			WHERE gift_card_id = ? AND order_id = ? AND type IN (?, ?)
+		`, cardID, orderID, models.GiftCardTxRedeem, models.GiftCardTxRedeemReturn).Scan(&redeemed)
+		if err != nil {
+			return nil, err
+		}
+
+		target := -giftCardAmount
+		if closed {
+			target = 0
+		}
+		if diff := target - redeemed; diff != 0 {
+			txType := models.GiftCardTxRedeem
+			if diff > 0 {
+				txType = models.GiftCardTxRedeemReturn
+			}
+			if _, err := tx.Exec("UPDATE gift_cards SET balance = balance + ? WHERE id = ?", diff, cardID); err != nil {
+				return nil, err
+			}
+			if err := addGiftCardTransaction(tx, cardID, orderID, txType, diff, "", 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var issued []int64
+	switch {
+	case closed:
+		rows, err := tx.Query("SELECT id FROM gift_cards WHERE order_id = ? AND status = ?", orderID, models.GiftCardStatusActive)
+		if err != nil {
+			return nil, err
+		}
+		var cardIDs []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err == nil {
+				cardIDs = append(cardIDs, id)
+			}
+		}
+		rows.Close()
+
+		for _, id := range cardIDs {
+			if err := voidGiftCard(tx, id, "Заказ №"+strconv.Itoa(orderID)+" "+status, 0); err != nil {
+				return nil, err
+			}
+		}
+
+	case paid:
+		// Карты выпускаются только по оплаченному заказу - с номером счёта, а не по статусу,
+		// и один раз: считаем уже выпущенные по каждому товару
+		rows, err := tx.Query(`
+			SELECT oi.product_id, oi.quantity, oi.price,
+			       (SELECT COUNT(*) FROM gift_cards g WHERE g.order_id = oi.order_id AND g.product_id = oi.product_id)
+			FROM order_items oi
+			JOIN products p ON p.id = oi.product_id
+			WHERE oi.order_id = ? AND p.gift_card = 1
+		`, orderID)
+		if err != nil {
+			return nil, err
+		}
+		var pending []newGiftCard
+		for rows.Next() {
+			var productID, quantity, existing int
+			var price models.Money
+			if err := rows.Scan(&productID, &quantity, &price, &existing); err != nil {
+				continue
+			}
+			for i := existing; i < quantity; i++ {
+				pending = append(pending, newGiftCard{
+					Amount:    price,
+					ExpiresAt: time.Now().Add(giftCardTTL),
+					OrderID:   orderID,
+					ProductID: productID,
+				})
+			}
+		}
+		rows.Close()
+
+		for _, g := range pending {
+			id, err := issueGiftCard(tx, g)
+			if err != nil {
+				return nil, err
+			}
+			issued = append(issued, id)
+		}
+	}
+
+	return issued, tx.Commit()
+}
+
+// notifyGiftCardsIssued отправляет покупателю коды карт, выпущенных по заказу
+func notifyGiftCardsIssued(orderID int, cardIDs []int64) {
+	cards, err := loadGiftCards(cardIDs)
+	if err != nil {
+		log.Printf("Failed to load gift cards of order %d for email: %v", orderID, err)
+		return
+	}
+	notifyOrder(orderID, notify.TemplateGiftCard, emailData{GiftCards: cards})
+}
+
+func loadGiftCards(ids []int64) ([]models.GiftCard, error) {
+	var cards []models.GiftCard
+	for _, id := range ids {
+		card, err := getGiftCard("id", id)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, *card)
+	}
+	return cards, nil
+}
+
+// CheckGiftCard - баланс и срок действия карты по коду (число неудачных попыток ограничено в роутере)
+func CheckGiftCard(c *fiber.Ctx) error {
+	card, err := getGiftCard("code", normalizeGiftCardCode(c.Params("code")))
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Gift card not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(models.GiftCardBalance{
+		Code:      card.Code,
+		Balance:   card.Balance,
+		Status:    card.Status,
+		ExpiresAt: card.ExpiresAt,
+	})
+}
+
+// AdminIssueGiftCard - выпуск карты администратором; при указанном получателе код уходит ему письмом
+func AdminIssueGiftCard(c *fiber.Ctx) error {
+	var req models.IssueGiftCardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Amount must be positive"})
+	}
+	req.RecipientEmail = strings.TrimSpace(req.RecipientEmail)
+	if req.RecipientEmail != "" {
+		if _, err := mail.ParseAddress(req.RecipientEmail); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid recipient email"})
+		}
+	}
+
+	expiresAt := time.Now().Add(giftCardTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return c.Status(400).JSON(fiber.Map{"error": "Expiry must be in the future"})
+		}
+		expiresAt = *req.ExpiresAt
+	}
+	adminID, _ := currentUserID(c)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	id, err := issueGiftCard(tx, newGiftCard{
+		Amount:         req.Amount,
+		ExpiresAt:      expiresAt,
+		RecipientEmail: req.RecipientEmail,
+		Note:           strings.TrimSpace(req.Note),
+		IssuedBy:       adminID,
+	})
+	if err != nil || tx.Commit() != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue gift card"})
+	}
+
+	card, err := getGiftCard("id", id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch gift card"})
+	}
+	if card.RecipientEmail != "" {
+		queueEmail(card.RecipientEmail, notify.NormalizeLanguage(req.Language), notify.TemplateGiftCard, emailData{GiftCards: []models.GiftCard{*card}})
+	}
+
+	return c.Status(201).JSON(card)
+}
+
+// AdminVoidGiftCard - аннулирование карты с обязательной причиной; остаток списывается
+func AdminVoidGiftCard(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid gift card ID"})
+	}
+
+	var req models.VoidGiftCardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Reason is required"})
+	}
+
+	card, err := getGiftCard("id", id)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Gift card not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if card.Status == models.GiftCardStatusVoid {
+		return c.Status(400).JSON(fiber.Map{"error": "Gift card is already void"})
+	}
+	adminID, _ := currentUserID(c)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := voidGiftCard(tx, id, req.Reason, adminID); err != nil || tx.Commit() != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to void gift card"})
+	}
+
+	log.Printf("Admin %d voided gift card %d: %s", adminID, id, req.Reason)
+	return adminGiftCardResponse(c, id)
+}
+
+// AdminGetGiftCard - карта с полной историей операций
+func AdminGetGiftCard(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid gift card ID"})
+	}
+	return adminGiftCardResponse(c, id)
+}
+
+func adminGiftCardResponse(c *fiber.Ctx, id int) error {
+	card, err := getGiftCard("id", id)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Gift card not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, gift_card_id, COALESCE(order_id, 0), type, amount, balance_after, COALESCE(reason, ''), COALESCE(admin_id, 0), created_at
+		FROM gift_card_transactions WHERE gift_card_id = ? ORDER BY id
+	`, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	card.Transactions = []models.GiftCardTransaction{}
+	for rows.Next() {
+		var t models.GiftCardTransaction
+		if err := rows.Scan(&t.ID, &t.GiftCardID, &t.OrderID, &t.Type, &t.Amount, &t.BalanceAfter, &t.Reason, &t.AdminID, &t.CreatedAt); err != nil {
+			continue
+		}
+		card.Transactions = append(card.Transactions, t)
+	}
+
+	return c.JSON(card)
+}
+
+// Helper functions for Gift cards (admin)
+// giftCardsAdminList - поля карт для списка в админке; status "expired" вычисляется, как в giftCardStatus
+var giftCardsAdminList = &adminList{
+	from: "gift_cards",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"code":            {"code", fieldText},
+		"initial_balance": {"initial_balance", fieldMoney},
+		"balance":         {"balance", fieldMoney},
+		"status": {"CASE WHEN status = '" + models.GiftCardStatusActive + "' AND julianday(expires_at) <= julianday('now') " +
+			"THEN '" + models.GiftCardStatusExpired + "' ELSE status END", fieldText},
+		"expires_at":      {"expires_at", fieldTime},
+		"order_id":        {"order_id", fieldInt},
+		"recipient_email": {"recipient_email", fieldText},
+		"note":            {"note", fieldText},
+		"issued_by":       {"issued_by", fieldInt},
+		"voided_at":       {"voided_at", fieldTime},
+		"created_at":      {"created_at", fieldTime},
+	},
+	search: []string{"code", "recipient_email", "note"},
+	sort:   "-id",
+}
+
+func getGiftCardsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, code, initial_balance, balance, status, expires_at, COALESCE(order_id, 0), COALESCE(recipient_email, ''),
+		COALESCE(note, ''), COALESCE(issued_by, 0), voided_at, COALESCE(void_reason, ''), created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, orderID, issuedBy int
+		var code, status, recipientEmail, note, voidReason string
+		var initialBalance, balance models.Money
+		var expiresAt, createdAt time.Time
+		var voidedAt sql.NullTime
+
+		if err := rows.Scan(&id, &code, &initialBalance, &balance, &status, &expiresAt, &orderID, &recipientEmail,
+			&note, &issuedBy, &voidedAt, &voidReason, &createdAt); err != nil {
+			continue
+		}
+
+		items = append(items, map[string]interface{}{
+			"id":              id,
+			"code":            code,
+			"initial_balance": initialBalance,
+			"balance":         balance,
+			"status":          giftCardStatus(status, expiresAt),
+			"expires_at":      expiresAt.Format(time.RFC3339),
+			"order_id":        orderID,
+			"recipient_email": recipientEmail,
+			"note":            note,
+			"issued_by":       issuedBy,
+			"voided_at":       nullTimeToString(voidedAt),
+			"void_reason":     voidReason,
+			"created_at":      createdAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/notify"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// guestContact - контакты покупателя гостевого заказа и хеш токена доступа к нему
+type guestContact struct {
+	Email     string
+	Name      string
+	Phone     string
+	Language  string
+	TokenHash string
+}
+
+// createGuestOrder сохраняет заказ без аккаунта (user_id IS NULL). Токен доступа возвращается
+// в ответе и приходит в письме; в базе хранится только его хеш.
+func createGuestOrder(c *fiber.Ctx, req *models.CreateOrderRequest, o newOrder) error {
+	token, err := randomHex(32)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create order",
+		})
+	}
+
+	o.Guest = &guestContact{
+		Email:     req.Email,
+		Name:      req.Name,
+		Phone:     req.Phone,
+		Language:  requestLanguage(c, req.Language),
+		TokenHash: hashToken(token),
+	}
+	orderID, err := insertOrder(o)
+	if err != nil {
+		return orderErrorResponse(c, err)
+	}
+
+	notifyGuestOrderPlaced(int(orderID), token)
+	notifyStaffOrderCreated(int(orderID))
+	emitOrderEvent(models.EventOrderCreated, int(orderID))
+	if o.paidByGiftCard() {
+		onOrderPaid(int(orderID))
+	}
+
+	order, err := getOrderWithProducts(int(orderID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch order",
+		})
+	}
+
+	return c.JSON(models.OrderResponse{
+		Order:       *order,
+		LookupToken: token,
+	})
+}
+
+// LookupOrder - просмотр заказа без входа: по ссылке с токеном из письма
+// или по номеру заказа и email покупателя. Возвращает статус, позиции и отслеживание.
+// На любое несовпадение ответ одинаковый (404), а число неудачных попыток ограничено в роутере.
+func LookupOrder(c *fiber.Ctx) error {
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var orderID int
+	if token := strings.TrimSpace(c.Query("token")); token != "" {
+		err = database.DB.QueryRow("SELECT id FROM orders WHERE lookup_token_hash = ?", hashToken(token)).Scan(&orderID)
+		if err != nil && err != sql.ErrNoRows {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+	} else {
+		number, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(c.Query("number")), "#"))
+		email := strings.TrimSpace(c.Query("email"))
+		if err != nil || email == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Order number and email are required"})
+		}
+
+		// Email берётся из гостевого заказа, а для привязанного к аккаунту - из профиля
+		err = database.DB.QueryRow(`
+			SELECT o.id FROM orders o
+			LEFT JOIN users u ON u.id = o.user_id
+			WHERE o.id = ? AND (LOWER(o.guest_email) = LOWER(?) OR LOWER(u.email) = LOWER(?))
+		`, number, email, email).Scan(&orderID)
+		if err != nil && err != sql.ErrNoRows {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+	}
+
+	if orderID == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+
+	order, err := getOrderWithProducts(orderID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch order"})
+	}
+
+	// Данные аккаунта по ссылке не раскрываем; состав заказа есть в items
+	order.User = nil
+	order.Products = nil
+	convertOrder(order, cur)
+
+	return c.JSON(fiber.Map{"order": order, "currency": currencyCode(cur)})
+}
+
+// guestOrderURL - ссылка на гостевой заказ из письма
+func guestOrderURL(token string) string {
+	return notify.SiteURL() + "/orders/lookup?token=" + token
+}
+
+// requestOrderToken - токен гостевого заказа из параметра token или заголовка X-Order-Token
+func requestOrderToken(c *fiber.Ctx) string {
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+	return c.Get("X-Order-Token")
+}
+
+// orderAccessAllowed - заказ доступен владельцу, администратору (если allowAdmin) и по токену гостевого заказа
+func orderAccessAllowed(c *fiber.Ctx, orderID, ownerID int, allowAdmin bool) bool {
+	if userID, ok := currentUserID(c); ok {
+		if userID == ownerID || (allowAdmin && c.Locals("role") == "admin") {
+			return true
+		}
+	}
+	return orderTokenValid(orderID, requestOrderToken(c))
+}
+
+// orderTokenValid проверяет токен доступа к заказу. Токен продолжает работать
+// и после привязки заказа к аккаунту, чтобы ссылки из писем не ломались.
+func orderTokenValid(orderID int, token string) bool {
+	if token == "" {
+		return false
+	}
+	var id int
+	err := database.DB.QueryRow("SELECT id FROM orders WHERE id = ? AND lookup_token_hash = ?", orderID, hashToken(token)).Scan(&id)
+	return err == nil
+}
+
+// claimGuestOrders привязывает к пользователю гостевые заказы с его email.
+// Вызывается только для подтверждённого адреса, иначе чужие заказы можно было бы забрать регистрацией.
+func claimGuestOrders(userID int) (int64, error) {
+	result, err := database.DB.Exec(`
+		UPDATE orders SET user_id = ?
+		WHERE user_id IS NULL AND guest_email IS NOT NULL
+		  AND LOWER(guest_email) = (SELECT LOWER(email) FROM users WHERE id = ? AND email_verified_at IS NOT NULL)
+	`, userID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	claimed, _ := result.RowsAffected()
+	if claimed > 0 {
+		log.Printf("Claimed %d guest orders for user %d", claimed, userID)
+		syncUserOrdersLoyalty(userID)
+	}
+	return claimed, nil
+}
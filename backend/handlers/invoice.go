@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"myAPI/database"
+	"myAPI/invoice"
+	"myAPI/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOrderInvoice - PDF-счёт по заказу. Доступен владельцу заказа, администраторам
+// и по токену гостевого заказа.
+// Оплаченным заказам присваивается сквозной номер счёта, неоплаченные получают счёт на оплату без номера.
+func GetOrderInvoice(c *fiber.Ctx) error {
+	if _, ok := currentUserID(c); !ok && requestOrderToken(c) == "" {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	orderID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
+	}
+
+	order, err := getOrderWithProducts(orderID)
+	if err == sql.ErrNoRows || (err == nil && !orderAccessAllowed(c, order.ID, order.UserID, true)) {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	doc, err := invoiceDocument(order)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.Render(&buf, doc); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to render invoice"})
+	}
+
+	filename := fmt.Sprintf("order-%d.pdf", order.ID)
+	if doc.Number > 0 {
+		filename = "invoice-" + invoice.FormatNumber(doc.Number) + ".pdf"
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="`+filename+`"`)
+	return c.Send(buf.Bytes())
+}
+
+// invoiceDocument собирает данные счёта: позиции заказа, итоги, покупатель из users и снимок адреса
+func invoiceDocument(order *models.Order) (invoice.Document, error) {
+	doc := invoice.Document{
+		Number:          order.InvoiceNumber,
+		OrderID:         order.ID,
+		OrderDate:       order.CreatedAt,
+		Status:          order.Status,
+		Seller:          invoice.SellerFromEnv(),
+		CouponCode:      order.CouponCode,
+		CouponDiscount:  order.CouponDiscount,
+		LoyaltyPoints:   order.LoyaltyPoints,
+		LoyaltyDiscount: order.LoyaltyDiscount,
+		GiftCardAmount:  order.GiftCardAmount,
+		TaxMode:         order.TaxMode,
+		Taxes:           order.TaxLines,
+		ShippingCost:    order.ShippingCost,
+		Total:           order.Price,
+		Refunded:        order.RefundedAmount,
+	}
+
+	var invoicedAt sql.NullTime
+	if err := database.DB.QueryRow("SELECT invoiced_at FROM orders WHERE id = ?", order.ID).Scan(&invoicedAt); err != nil {
+		return doc, err
+	}
+	doc.IssuedAt = invoicedAt.Time
+
+	if order.User != nil {
+		doc.Customer = invoice.Customer{
+			Name:    order.User.Name,
+			Email:   order.User.Email,
+			Phone:   order.User.Phone,
+			Address: order.User.DeliveryAddress,
+		}
+	} else {
+		doc.Customer = invoice.Customer{Name: order.GuestName, Email: order.GuestEmail, Phone: order.GuestPhone}
+	}
+	if order.Address != nil {
+		if doc.Customer.Name == "" {
+			doc.Customer.Name = order.Address.Recipient
+		}
+		if doc.Customer.Phone == "" {
+			doc.Customer.Phone = order.Address.Phone
+		}
+		doc.Customer.Address = order.Address.String()
+	}
+
+	if order.ShippingMethod != "" {
+		doc.ShippingName = order.ShippingMethod
+		if method, err := getShippingMethodByCode(order.ShippingMethod); err == nil {
+			doc.ShippingName = method.Name
+		}
+	}
+
+	for _, item := range order.Items {
+		doc.Lines = append(doc.Lines, invoice.Line{
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			ListPrice: item.ListPrice,
+			Price:     item.Price,
+			TaxRate:   item.TaxRate,
+		})
+	}
+
+	return doc, nil
+}
+
+// assignInvoiceNumber присваивает оплаченному заказу следующий сквозной номер счёта.
+// Повторный вызов номер не меняет.
+func assignInvoiceNumber(db sqlExecer, orderID int) error {
+	_, err := db.Exec(`
+		UPDATE orders
+		SET invoice_number = (SELECT COALESCE(MAX(invoice_number), 0) + 1 FROM orders), invoiced_at = ?
+		WHERE id = ? AND invoice_number IS NULL
+	`, time.Now(), orderID)
+	return err
+}
@@ -0,0 +1,562 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"myAPI/database"
+	"myAPI/loyalty"
+	"myAPI/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sqlQueryer - общий интерфейс *sql.DB и *sql.Tx для чтения одной строки
+type sqlQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loyaltyEntry - новая запись журнала баллов
+type loyaltyEntry struct {
+	UserID  int
+	OrderID int
+	Type    string
+	Points  int
+	Reason  string
+	AdminID int
+}
+
+// StartLoyaltyWorker периодически списывает баллы с истёкшим сроком
+func StartLoyaltyWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := expireLoyaltyPoints(time.Now()); err != nil {
+				log.Printf("Loyalty expiry error: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// loyaltyBalance - текущий баланс баллов пользователя (может быть отрицательным,
+// если начисление отменили после того, как баллы потратили)
+func loyaltyBalance(db sqlQueryer, userID int) (int, error) {
+	var balance int
+	err := db.QueryRow("SELECT COALESCE(SUM(points), 0) FROM loyalty_transactions WHERE user_id = ?", userID).Scan(&balance)
+	return balance, err
+}
+
+// addLoyaltyEntry записывает начисление или списание баллов.
+// Начисление становится новой партией со сроком сгорания, но сначала гасит долг при отрицательном балансе.
+// Возврат потраченных на заказ баллов восстанавливает партии, из которых они были списаны, с их прежним сроком.
+// Списание уменьшает остатки партий, начиная с тех, что сгорают раньше.
+func addLoyaltyEntry(tx *sql.Tx, e loyaltyEntry) error {
+	if e.Points == 0 {
+		return nil
+	}
+
+	balance, err := loyaltyBalance(tx, e.UserID)
+	if err != nil {
+		return err
+	}
+
+	if e.Points < 0 {
+		entryID, err := insertLoyaltyEntry(tx, e, balance+e.Points, 0, sql.NullTime{})
+		if err != nil {
+			return err
+		}
+		return consumeLoyaltyLots(tx, entryID, e.UserID, -e.Points)
+	}
+
+	credit := e.Points
+	if balance < 0 {
+		credit = max(e.Points+balance, 0)
+	}
+
+	fresh := e.Points
+	if e.Type == loyalty.TypeSpendReturn {
+		returned, restored, err := restoreLoyaltyLots(tx, e.OrderID, e.Points, credit)
+		if err != nil {
+			return err
+		}
+		fresh -= returned
+		credit -= restored
+	}
+
+	// Остаток без записей о партиях (списания до их появления) становится новой партией
+	var remaining int
+	var expiresAt sql.NullTime
+	if fresh > 0 {
+		remaining = min(fresh, credit)
+		expiresAt = sql.NullTime{Time: loyalty.Current().ExpiresAt(time.Now()), Valid: true}
+	}
+
+	_, err = insertLoyaltyEntry(tx, e, balance+e.Points, remaining, expiresAt)
+	return err
+}
+
+func insertLoyaltyEntry(tx *sql.Tx, e loyaltyEntry, balanceAfter, remaining int, expiresAt sql.NullTime) (int64, error) {
+	result, err := tx.Exec(`
+		INSERT INTO loyalty_transactions (user_id, order_id, type, points, remaining, balance_after, expires_at, reason, admin_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.UserID, nullID(e.OrderID), e.Type, e.Points, remaining, balanceAfter, expiresAt, nullString(e.Reason), nullID(e.AdminID), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// consumeLoyaltyLots уменьшает остатки партий на points, раньше сгорающие - первыми,
+// и запоминает, сколько взято из каждой партии записью entryID
+func consumeLoyaltyLots(tx *sql.Tx, entryID int64, userID, points int) error {
+	rows, err := tx.Query(`
+		SELECT id, remaining FROM loyalty_transactions
+		WHERE user_id = ? AND remaining > 0
+		ORDER BY expires_at ASC, id ASC
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	type lot struct{ id, remaining int }
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+
+	for _, l := range lots {
+		if points == 0 {
+			break
+		}
+		used := min(l.remaining, points)
+		if _, err := tx.Exec("UPDATE loyalty_transactions SET remaining = remaining - ? WHERE id = ?", used, l.id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO loyalty_lot_usages (transaction_id, lot_id, points) VALUES (?, ?, ?)", entryID, l.id, used); err != nil {
+			return err
+		}
+		points -= used
+	}
+	return nil
+}
+
+// restoreLoyaltyLots возвращает до points баллов, потраченных на заказ, в исходные партии -
+// начиная с тех, что сгорают позже. В остатки партий зачисляется не больше credit баллов:
+// остальное гасит долг. Возвращает, сколько баллов нашлось в записях о партиях и сколько из них
+// зачислено. Если срок партии уже прошёл, восстановленный остаток сгорит при ближайшей проверке.
+func restoreLoyaltyLots(tx *sql.Tx, orderID, points, credit int) (returned, restored int, err error) {
+	rows, err := tx.Query(`
+		SELECT u.id, u.lot_id, u.points FROM loyalty_lot_usages u
+		JOIN loyalty_transactions s ON s.id = u.transaction_id
+		JOIN loyalty_transactions l ON l.id = u.lot_id
+		WHERE s.order_id = ? AND s.type = ? AND u.points > 0
+		ORDER BY l.expires_at DESC, l.id DESC
+	`, orderID, loyalty.TypeSpend)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type usage struct{ id, lotID, points int }
+	var usages []usage
+	for rows.Next() {
+		var u usage
+		if err := rows.Scan(&u.id, &u.lotID, &u.points); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		usages = append(usages, u)
+	}
+	rows.Close()
+
+	for _, u := range usages {
+		if returned == points {
+			break
+		}
+		back := min(u.points, points-returned)
+		if _, err := tx.Exec("UPDATE loyalty_lot_usages SET points = points - ? WHERE id = ?", back, u.id); err != nil {
+			return 0, 0, err
+		}
+		if add := min(back, credit-restored); add > 0 {
+			if _, err := tx.Exec("UPDATE loyalty_transactions SET remaining = remaining + ? WHERE id = ?", add, u.lotID); err != nil {
+				return 0, 0, err
+			}
+			restored += add
+		}
+		returned += back
+	}
+	return returned, restored, nil
+}
+
+// expireLoyaltyPoints списывает несгоревшие остатки партий с истёкшим сроком
+func expireLoyaltyPoints(now time.Time) error {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, remaining FROM loyalty_transactions
+		WHERE remaining > 0 AND expires_at IS NOT NULL AND expires_at <= ?
+		ORDER BY expires_at ASC, id ASC
+	`, now)
+	if err != nil {
+		return err
+	}
+
+	type lot struct{ id, userID, remaining int }
+	var due []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.userID, &l.remaining); err != nil {
+			continue
+		}
+		due = append(due, l)
+	}
+	rows.Close()
+
+	for _, l := range due {
+		if err := expireLoyaltyLot(l.id, l.userID, l.remaining); err != nil {
+			return err
+		}
+		log.Printf("Expired %d loyalty points of user %d", l.remaining, l.userID)
+	}
+	return nil
+}
+
+func expireLoyaltyLot(lotID, userID, points int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Условие на remaining защищает от двойного списания, если партию успели потратить
+	result, err := tx.Exec("UPDATE loyalty_transactions SET remaining = 0 WHERE id = ? AND remaining = ?", lotID, points)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil
+	}
+
+	balance, err := loyaltyBalance(tx, userID)
+	if err != nil {
+		return err
+	}
+	entry := loyaltyEntry{UserID: userID, Type: loyalty.TypeExpire, Points: -points}
+	if _, err := insertLoyaltyEntry(tx, entry, balance-points, 0, sql.NullTime{}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// syncOrderLoyalty приводит записи журнала по заказу в соответствие с его состоянием:
+// за оплаченный заказ начисляется процент от оплаченной суммы за вычетом возвратов,
+// у отменённого или возвращённого начисление снимается, а потраченные на него баллы возвращаются.
+// Пишутся только разницы, поэтому функцию можно вызывать после любого изменения заказа.
+func syncOrderLoyalty(orderID int) {
+	if err := reconcileOrderLoyalty(orderID); err != nil {
+		log.Printf("Failed to sync loyalty points for order %d: %v", orderID, err)
+	}
+}
+
+// syncUserOrdersLoyalty начисляет баллы за заказы, привязанные к пользователю позже оплаты
+func syncUserOrdersLoyalty(userID int) {
+	rows, err := database.DB.Query("SELECT id FROM orders WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("Failed to sync loyalty points for user %d: %v", userID, err)
+		return
+	}
+	var orderIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			orderIDs = append(orderIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range orderIDs {
+		syncOrderLoyalty(id)
+	}
+}
+
+func reconcileOrderLoyalty(orderID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID, spentPoints int
+	var status string
+	var price, refunded models.Money
+	err = tx.QueryRow(`
+		SELECT COALESCE(user_id, 0), status, price, COALESCE(refunded_amount, 0), COALESCE(loyalty_points, 0)
+		FROM orders WHERE id = ?
+	`, orderID).Scan(&userID, &status, &price, &refunded, &spentPoints)
+	if err != nil {
+		return err
+	}
+	if userID == 0 {
+		return nil
+	}
+
+	var earned, spent int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN type IN (?, ?) THEN points END), 0),
+		       COALESCE(SUM(CASE WHEN type IN (?, ?) THEN points END), 0)
+		FROM loyalty_transactions WHERE order_id = ?
+	`, loyalty.TypeEarn, loyalty.TypeEarnReversal, loyalty.TypeSpend, loyalty.TypeSpendReturn, orderID).Scan(&earned, &spent)
+	if err != nil {
+		return err
+	}
+
+	targetEarned := 0
+	switch status {
+	case models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusDelivered:
+		targetEarned = loyalty.Current().EarnedPoints(price - refunded)
+	}
+	targetSpent := -spentPoints
+	if status == models.OrderStatusCancelled || status == models.OrderStatusRefunded {
+		targetSpent = 0
+	}
+
+	if diff := targetSpent - spent; diff != 0 {
+		entryType := loyalty.TypeSpend
+		if diff > 0 {
+			entryType = loyalty.TypeSpendReturn
+		}
+		if err := addLoyaltyEntry(tx, loyaltyEntry{UserID: userID, OrderID: orderID, Type: entryType, Points: diff}); err != nil {
+			return err
+		}
+	}
+	if diff := targetEarned - earned; diff != 0 {
+		entryType := loyalty.TypeEarn
+		if diff < 0 {
+			entryType = loyalty.TypeEarnReversal
+		}
+		if err := addLoyaltyEntry(tx, loyaltyEntry{UserID: userID, OrderID: orderID, Type: entryType, Points: diff}); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkLoyaltySpend проверяет, можно ли оплатить баллами часть заказа с суммой товаров total
+func checkLoyaltySpend(userID, points int, total models.Money) error {
+	if points < 0 {
+		return fiber.NewError(400, "Invalid loyalty points")
+	}
+
+	if limit := loyalty.Current().MaxSpendPoints(total); points > limit {
+		return fiber.NewError(400, fmt.Sprintf("At most %d loyalty points can be used for this order", limit))
+	}
+
+	balance, err := loyaltyBalance(database.DB, userID)
+	if err != nil {
+		return err
+	}
+	if points > balance {
+		return fiber.NewError(409, "Not enough loyalty points")
+	}
+	return nil
+}
+
+// spendOrderLoyalty списывает баллы за заказ внутри транзакции его создания.
+// Баланс проверяется повторно, чтобы одни и те же баллы не ушли на два заказа сразу.
+func spendOrderLoyalty(tx *sql.Tx, userID int, orderID int64, points int) error {
+	balance, err := loyaltyBalance(tx, userID)
+	if err != nil {
+		return err
+	}
+	if points > balance {
+		return fiber.NewError(409, "Not enough loyalty points")
+	}
+
+	return addLoyaltyEntry(tx, loyaltyEntry{UserID: userID, OrderID: int(orderID), Type: loyalty.TypeSpend, Points: -points})
+}
+
+// GetLoyalty - баланс, ближайшие сгорания и история баллов текущего пользователя
+func GetLoyalty(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	balance, err := loyaltyBalance(database.DB, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	account := models.LoyaltyAccount{
+		Balance:     balance,
+		Value:       loyalty.Value(max(balance, 0)),
+		EarnPercent: loyalty.Current().EarnPercent,
+		Expiring:    []models.LoyaltyExpiration{},
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT remaining, expires_at FROM loyalty_transactions
+		WHERE user_id = ? AND remaining > 0 AND expires_at IS NOT NULL
+		ORDER BY expires_at ASC, id ASC
+	`, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	for rows.Next() {
+		var e models.LoyaltyExpiration
+		if err := rows.Scan(&e.Points, &e.ExpiresAt); err != nil {
+			continue
+		}
+		account.Expiring = append(account.Expiring, e)
+	}
+	rows.Close()
+
+	account.History, err = getLoyaltyTransactions(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(account)
+}
+
+func getLoyaltyTransactions(userID int) ([]models.LoyaltyTransaction, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, COALESCE(order_id, 0), type, points, remaining, balance_after, expires_at,
+		       COALESCE(reason, ''), COALESCE(admin_id, 0), created_at
+		FROM loyalty_transactions WHERE user_id = ?
+		ORDER BY id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.LoyaltyTransaction{}
+	for rows.Next() {
+		var t models.LoyaltyTransaction
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.UserID, &t.OrderID, &t.Type, &t.Points, &t.Remaining, &t.BalanceAfter, &expiresAt,
+			&t.Reason, &t.AdminID, &t.CreatedAt); err != nil {
+			continue
+		}
+		if expiresAt.Valid {
+			t.ExpiresAt = &expiresAt.Time
+		}
+		history = append(history, t)
+	}
+	return history, nil
+}
+
+// AdminAdjustLoyalty - ручное начисление или списание баллов. Причина обязательна,
+// а автор корректировки сохраняется в журнале.
+func AdminAdjustLoyalty(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	adminID, _ := currentUserID(c)
+
+	var req models.LoyaltyAdjustRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Points == 0 || req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Non-zero points and reason are required"})
+	}
+
+	var exists int
+	if err := database.DB.QueryRow("SELECT id FROM users WHERE id = ?", userID).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	entry := loyaltyEntry{UserID: userID, Type: loyalty.TypeAdjust, Points: req.Points, Reason: req.Reason, AdminID: adminID}
+	if err := addLoyaltyEntry(tx, entry); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to adjust loyalty points"})
+	}
+	balance, err := loyaltyBalance(tx, userID)
+	if err != nil || tx.Commit() != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to adjust loyalty points"})
+	}
+
+	log.Printf("Admin %d adjusted loyalty points of user %d by %d: %s", adminID, userID, req.Points, req.Reason)
+	return c.Status(201).JSON(fiber.Map{"balance": balance})
+}
+
+// Helper functions for Loyalty transactions (admin)
+var loyaltyTransactionsAdminList = &adminList{
+	from: "loyalty_transactions",
+	fields: map[string]adminField{
+		"id":            {"id", fieldInt},
+		"user_id":       {"user_id", fieldInt},
+		"order_id":      {"order_id", fieldInt},
+		"type":          {"type", fieldText},
+		"points":        {"points", fieldInt},
+		"remaining":     {"remaining", fieldInt},
+		"balance_after": {"balance_after", fieldInt},
+		"expires_at":    {"expires_at", fieldTime},
+		"reason":        {"reason", fieldText},
+		"admin_id":      {"admin_id", fieldInt},
+		"created_at":    {"created_at", fieldTime},
+	},
+	search: []string{"type", "reason"},
+	sort:   "-id",
+}
+
+func getLoyaltyTransactionsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, user_id, COALESCE(order_id, 0), type, points, remaining, balance_after, expires_at,
+		COALESCE(reason, ''), COALESCE(admin_id, 0), created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, userID, orderID, points, remaining, balanceAfter, adminID int
+		var entryType, reason string
+		var expiresAt sql.NullTime
+		var createdAt time.Time
+
+		if err := rows.Scan(&id, &userID, &orderID, &entryType, &points, &remaining, &balanceAfter, &expiresAt,
+			&reason, &adminID, &createdAt); err != nil {
+			continue
+		}
+
+		items = append(items, map[string]interface{}{
+			"id":            id,
+			"user_id":       userID,
+			"order_id":      orderID,
+			"type":          entryType,
+			"points":        points,
+			"remaining":     remaining,
+			"balance_after": balanceAfter,
+			"expires_at":    nullTimeToString(expiresAt),
+			"reason":        reason,
+			"admin_id":      adminID,
+			"created_at":    createdAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
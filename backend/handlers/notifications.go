@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"myAPI/alerts"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/notify"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Статусы сообщения в очередях отправки (письма, Telegram)
+const (
+	QueueStatusPending = "pending"
+	QueueStatusSent    = "sent"
+	QueueStatusFailed  = "failed"
+)
+
+// maxDeliveryAttempts - после стольких неудачных попыток сообщение помечается как failed
+const maxDeliveryAttempts = 5
+
+// emailData - данные для шаблонов писем
+type emailData struct {
+	SiteURL   string
+	Name      string
+	Email     string
+	Order     *models.Order
+	ResetURL  string
+	VerifyURL string
+	LookupURL string // ссылка на гостевой заказ
+	GiftCards []models.GiftCard
+	Alert     *alerts.Alert // уведомление подписчику товара
+}
+
+// emailWake будит обработчик очереди сразу после постановки письма
+var emailWake = make(chan struct{}, 1)
+
+// StartEmailWorker запускает фоновую отправку писем из очереди
+func StartEmailWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := deliverPendingEmails(); err != nil {
+				log.Printf("Email worker error: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-emailWake:
+			}
+		}
+	}()
+}
+
+func wakeEmailWorker() {
+	select {
+	case emailWake <- struct{}{}:
+	default:
+	}
+}
+
+type queuedEmail struct {
+	ID        int
+	Recipient string
+	Subject   string
+	Body      string
+	Attempts  int
+}
+
+func deliverPendingEmails() error {
+	sender, ok := notify.Current()
+	if !ok {
+		return nil
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, recipient, subject, body, attempts FROM email_queue
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY id LIMIT 50
+	`, QueueStatusPending, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var emails []queuedEmail
+	for rows.Next() {
+		var e queuedEmail
+		if err := rows.Scan(&e.ID, &e.Recipient, &e.Subject, &e.Body, &e.Attempts); err != nil {
+			continue
+		}
+		emails = append(emails, e)
+	}
+	rows.Close()
+
+	for _, e := range emails {
+		err := sender.Send(notify.Message{To: e.Recipient, Subject: e.Subject, Body: e.Body})
+		if err == nil {
+			database.DB.Exec("UPDATE email_queue SET status = ?, attempts = ?, last_error = NULL, sent_at = ? WHERE id = ?",
+				QueueStatusSent, e.Attempts+1, time.Now(), e.ID)
+			continue
+		}
+
+		log.Printf("Failed to send email %d to %s: %v", e.ID, e.Recipient, err)
+		attempts := e.Attempts + 1
+		status := QueueStatusPending
+		if attempts >= maxDeliveryAttempts {
+			status = QueueStatusFailed
+		}
+		database.DB.Exec("UPDATE email_queue SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+			status, attempts, err.Error(), time.Now().Add(retryDelay(attempts)), e.ID)
+	}
+
+	return nil
+}
+
+// retryDelay - экспоненциальная задержка перед повтором: 1, 2, 4, 8... минут
+func retryDelay(attempts int) time.Duration {
+	return time.Minute << (attempts - 1)
+}
+
+// queueEmail рендерит шаблон и ставит письмо в очередь. Ошибки только логируются:
+// уведомления не должны ломать основную операцию.
+func queueEmail(to, lang, template string, data emailData) {
+	if to == "" {
+		return
+	}
+	data.SiteURL = notify.SiteURL()
+	if data.Email == "" {
+		data.Email = to
+	}
+
+	subject, body, err := notify.Render(lang, template, data)
+	if err != nil {
+		log.Printf("Failed to render email %s: %v", template, err)
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO email_queue (recipient, template, subject, body, status, attempts, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+	`, to, template, subject, body, QueueStatusPending, time.Now(), time.Now())
+	if err != nil {
+		log.Printf("Failed to queue email %s to %s: %v", template, to, err)
+		return
+	}
+
+	wakeEmailWorker()
+}
+
+// emailRecipient - адрес, имя и язык писем пользователя
+func emailRecipient(userID int) (email, name, lang string, err error) {
+	err = database.DB.QueryRow("SELECT email, COALESCE(name, ''), COALESCE(language, '') FROM users WHERE id = ?", userID).
+		Scan(&email, &name, &lang)
+	return email, name, lang, err
+}
+
+// requestLanguage - язык из тела запроса или заголовка Accept-Language
+func requestLanguage(c *fiber.Ctx, explicit string) string {
+	if explicit != "" {
+		return notify.NormalizeLanguage(explicit)
+	}
+	return notify.NormalizeLanguage(c.Get(fiber.HeaderAcceptLanguage))
+}
+
+// notifyRegistration - приветственное письмо со ссылкой для подтверждения email
+func notifyRegistration(userID int) {
+	email, name, lang, err := emailRecipient(userID)
+	if err != nil {
+		log.Printf("Failed to load user %d for email: %v", userID, err)
+		return
+	}
+	data := emailData{Name: name}
+	if token, err := createEmailVerificationToken(userID); err == nil {
+		data.VerifyURL = verifyEmailURL(token)
+	} else {
+		log.Printf("Failed to create email verification for user %d: %v", userID, err)
+	}
+	queueEmail(email, lang, notify.TemplateRegistration, data)
+}
+
+func notifyEmailVerification(userID int, token string) {
+	email, name, lang, err := emailRecipient(userID)
+	if err != nil {
+		log.Printf("Failed to load user %d for email: %v", userID, err)
+		return
+	}
+	queueEmail(email, lang, notify.TemplateVerifyEmail, emailData{Name: name, VerifyURL: verifyEmailURL(token)})
+}
+
+func verifyEmailURL(token string) string {
+	return notify.SiteURL() + "/verify-email?token=" + token
+}
+
+func notifyPasswordReset(userID int, token string) {
+	email, name, lang, err := emailRecipient(userID)
+	if err != nil {
+		log.Printf("Failed to load user %d for email: %v", userID, err)
+		return
+	}
+	resetURL := notify.SiteURL() + "/reset-password?token=" + token
+	queueEmail(email, lang, notify.TemplatePasswordReset, emailData{Name: name, ResetURL: resetURL})
+}
+
+func notifyOrderPlaced(orderID int) {
+	notifyOrder(orderID, notify.TemplateOrderPlaced, emailData{})
+}
+
+// notifyGuestOrderPlaced - письмо о гостевом заказе со ссылкой для просмотра и оплаты без аккаунта
+func notifyGuestOrderPlaced(orderID int, lookupToken string) {
+	notifyOrder(orderID, notify.TemplateOrderPlaced, emailData{LookupURL: guestOrderURL(lookupToken)})
+}
+
+// notifyOrderStatus сообщает покупателю о новом статусе заказа; для отправленного заказа - с трек-номерами
+func notifyOrderStatus(orderID int) {
+	notifyOrder(orderID, "", emailData{})
+}
+
+func notifyOrder(orderID int, template string, data emailData) {
+	order, err := getOrderWithProducts(orderID)
+	if err != nil {
+		log.Printf("Failed to load order %d for email: %v", orderID, err)
+		return
+	}
+
+	if template == "" {
+		template = notify.TemplateStatusChanged
+		if order.Status == models.OrderStatusShipped {
+			template = notify.TemplateShipped
+		}
+	}
+
+	// Письма по гостевому заказу уходят на адрес из заказа
+	email, name, lang := order.GuestEmail, order.GuestName, order.GuestLanguage
+	if order.UserID != 0 {
+		email, name, lang, err = emailRecipient(order.UserID)
+		if err != nil {
+			log.Printf("Failed to load user %d for email: %v", order.UserID, err)
+			return
+		}
+	}
+	if name == "" && order.Address != nil {
+		name = order.Address.Recipient
+	}
+
+	data.Name = name
+	data.Order = order
+	queueEmail(email, lang, template, data)
+}
+
+// AdminRetryEmail - повторная отправка письма из очереди (например, после исправления настроек SMTP)
+func AdminRetryEmail(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid email ID"})
+	}
+
+	result, err := database.DB.Exec("UPDATE email_queue SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ?",
+		QueueStatusPending, time.Now(), id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Email not found"})
+	}
+
+	wakeEmailWorker()
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// Helper functions for Email queue (admin)
+var emailsAdminList = &adminList{
+	from: "email_queue",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"recipient":       {"recipient", fieldText},
+		"template":        {"template", fieldText},
+		"subject":         {"subject", fieldText},
+		"status":          {"status", fieldText},
+		"attempts":        {"attempts", fieldInt},
+		"next_attempt_at": {"next_attempt_at", fieldTime},
+		"sent_at":         {"sent_at", fieldTime},
+		"created_at":      {"created_at", fieldTime},
+	},
+	search: []string{"recipient", "subject"},
+	sort:   "-id",
+}
+
+func getEmailsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, recipient, template, subject, status, attempts, COALESCE(last_error, ''), next_attempt_at, sent_at, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, attempts int
+		var recipient, template, subject, status, lastError string
+		var nextAttemptAt, createdAt time.Time
+		var sentAt sql.NullTime
+
+		if err := rows.Scan(&id, &recipient, &template, &subject, &status, &attempts, &lastError, &nextAttemptAt, &sentAt, &createdAt); err != nil {
+			continue
+		}
+
+		items = append(items, map[string]interface{}{
+			"id":              id,
+			"recipient":       recipient,
+			"template":        template,
+			"subject":         subject,
+			"status":          status,
+			"attempts":        attempts,
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt.Format(time.RFC3339),
+			"sent_at":         nullTimeToString(sentAt),
+			"created_at":      createdAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+func deleteEmail(id int) error {
+	_, err := database.DB.Exec("DELETE FROM email_queue WHERE id = ?", id)
+	return err
+}
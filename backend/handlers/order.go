@@ -3,16 +3,21 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"myAPI/database"
+	"myAPI/loyalty"
 	"myAPI/models"
 	"myAPI/utils"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// CreateOrder - создание заказа с регистрацией пользователя
+// CreateOrder - создание заказа без авторизации: с регистрацией пользователя, если передан пароль,
+// иначе гостевой заказ без аккаунта
 func CreateOrder(c *fiber.Ctx) error {
 	var req models.CreateOrderRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -28,66 +33,142 @@ func CreateOrder(c *fiber.Ctx) error {
 		})
 	}
 
-	// Проверяем существует ли пользователь
-	var existingUser models.User
-	err := database.DB.QueryRow("SELECT id FROM users WHERE email = ?", req.Email).Scan(&existingUser.ID)
-	if err != sql.ErrNoRows {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "User already exists",
-		})
+	// Валюта только фиксируется в заказе вместе с курсом; суммы и оплата остаются в рублях
+	cur, err := getCurrency(req.Currency)
+	if err != nil {
+		return errorResponse(c, err)
 	}
 
-	// Хешируем пароль
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	guest := req.Password == ""
+	if guest {
+		req.Email = strings.TrimSpace(req.Email)
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Valid email is required",
+			})
+		}
+	} else {
+		// Проверяем существует ли пользователь
+		var existingUser models.User
+		err := database.DB.QueryRow("SELECT id FROM users WHERE email = ?", req.Email).Scan(&existingUser.ID)
+		if err != sql.ErrNoRows {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "User already exists",
+			})
+		}
+	}
+
+	// Рассчитаем итоговую цену с учётом скидок и количеств
+	products, counts, err := loadOrderItems(req.ProductIDs)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to hash password",
+			"error": "Failed to fetch products",
 		})
 	}
+	orderPrice := itemsTotal(products, counts)
 
-	// Создаем пользователя
-	result, err := database.DB.Exec(
-		"INSERT INTO users (email, password, name, phone, delivery_address, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		req.Email, string(hashedPassword), req.Name, req.Phone, req.DeliveryAddress, time.Now(), time.Now(),
-	)
+	// Проверяем остатки и промокод заранее, чтобы не хешировать пароль и не открывать транзакцию зря
+	if err := checkStock(products, counts); err != nil {
+		return errorResponse(c, err)
+	}
+
+	var coupon *couponResult
+	if req.CouponCode != "" {
+		// Лимит на покупателя для гостя и нового пользователя считается по email
+		coupon, err = evaluateCoupon(req.CouponCode, 0, req.Email, products, counts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		orderPrice -= coupon.Discount
+	}
+
+	// У нового пользователя ещё нет адресной книги, поэтому address_id не используется
+	address, err := orderAddress(0, 0, req.Address, req.Name, req.Phone, req.DeliveryAddress)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	region := orderRegion(req.Region, address)
+	var shipping *models.ShippingQuote
+	if req.ShippingMethod != "" {
+		shipping, err = shippingForOrder(req.ShippingMethod, region, products, counts, orderPrice)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		orderPrice += shipping.Cost
+	}
+
+	taxes, err := calculateOrderTax(products, counts, coupon, 0, shippingCost(shipping))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create user",
+			"error": "Failed to calculate tax",
 		})
 	}
+	if !taxes.Config.Inclusive() {
+		orderPrice += taxes.Total
+	}
 
-	userID, _ := result.LastInsertId()
-
-	// Создаем заказ
-	productIDsJSON, _ := json.Marshal(req.ProductIDs)
-	// Рассчитаем итоговую цену с учётом скидок и количеств
-	counts := make(map[int]int)
-	for _, id := range req.ProductIDs {
-		counts[id]++
+	var giftCard *giftCardResult
+	if req.GiftCardCode != "" {
+		giftCard, err = evaluateGiftCard(req.GiftCardCode, products, orderPrice)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		orderPrice -= giftCard.Amount
 	}
-	// Получим уникальные id для выборки
-	uniqueIDs := make([]int, 0, len(counts))
-	for id := range counts {
-		uniqueIDs = append(uniqueIDs, id)
+
+	o := newOrder{
+		ProductIDs: req.ProductIDs,
+		Products:   products,
+		Counts:     counts,
+		Price:      orderPrice,
+		Coupon:     coupon,
+		Shipping:   shipping,
+		Region:     region,
+		Address:    address,
+		Tax:        taxes,
+		GiftCard:   giftCard,
+		Currency:   cur,
 	}
-	productIDsArr := models.IntArray(uniqueIDs)
-	products, _ := getProductsByIDs(productIDsArr)
-	var orderPrice float64
-	for _, p := range products {
-		cnt := counts[p.ID]
-		orderPrice += p.Price * (1 - float64(p.Discount)/100.0) * float64(cnt)
+	if guest {
+		return createGuestOrder(c, &req, o)
 	}
-	orderResult, err := database.DB.Exec(
-		"INSERT INTO orders (user_id, product_ids, status, created_at, price) VALUES (?, ?, ?, ?, ?)",
-		userID, string(productIDsJSON), "оплачен", time.Now(), orderPrice,
-	)
+
+	// Хешируем пароль
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create order",
+			"error": "Failed to hash password",
 		})
 	}
 
-	orderID, _ := orderResult.LastInsertId()
+	// Пользователь создаётся в одной транзакции с заказом: если заказ не оформится, аккаунта не останется
+	o.Account = &newAccount{
+		Email:           req.Email,
+		PasswordHash:    string(hashedPassword),
+		Name:            req.Name,
+		Phone:           req.Phone,
+		DeliveryAddress: req.DeliveryAddress,
+		Language:        requestLanguage(c, req.Language),
+	}
+	orderID, err := insertOrder(o)
+	if err != nil {
+		return orderErrorResponse(c, err)
+	}
+	userID := o.Account.ID
+
+	if req.Address != nil {
+		rememberOrderAddress(int(userID), *address)
+	}
+
+	notifyRegistration(int(userID))
+	emitUserEvent(models.EventUserRegistered, int(userID))
+	notifyOrderPlaced(int(orderID))
+	notifyStaffOrderCreated(int(orderID))
+	emitOrderEvent(models.EventOrderCreated, int(orderID))
+	if o.paidByGiftCard() {
+		onOrderPaid(int(orderID))
+	}
 
 	// Получаем созданный заказ с товарами
 	order, err := getOrderWithProducts(int(orderID))
@@ -141,47 +222,124 @@ func CreateOrderAuth(c *fiber.Ctx) error {
 		})
 	}
 
-	// Обновляем профиль пользователя
-	_, err := database.DB.Exec(
-		"UPDATE users SET name = ?, phone = ?, delivery_address = ?, updated_at = ? WHERE id = ?",
-		req.Name, req.Phone, req.DeliveryAddress, time.Now(), userID,
-	)
+	cur, err := getCurrency(req.Currency)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	// Рассчитаем итоговую цену с учётом скидок и количеств
+	products, counts, err := loadOrderItems(req.ProductIDs)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update user profile",
+			"error": "Failed to fetch products",
 		})
 	}
+	orderPrice := itemsTotal(products, counts)
 
-	// Создаем заказ
-	productIDsJSON, _ := json.Marshal(req.ProductIDs)
-	// Рассчитаем итоговую цену с учётом скидок и количеств
-	counts := make(map[int]int)
-	for _, id := range req.ProductIDs {
-		counts[id]++
+	if err := checkStock(products, counts); err != nil {
+		return errorResponse(c, err)
 	}
-	// Получим уникальные id для выборки
-	uniqueIDs := make([]int, 0, len(counts))
-	for id := range counts {
-		uniqueIDs = append(uniqueIDs, id)
+
+	var coupon *couponResult
+	if req.CouponCode != "" {
+		coupon, err = evaluateCoupon(req.CouponCode, userID, "", products, counts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		orderPrice -= coupon.Discount
 	}
-	productIDsArr := models.IntArray(uniqueIDs)
-	products, _ := getProductsByIDs(productIDsArr)
-	var orderPrice float64
-	for _, p := range products {
-		cnt := counts[p.ID]
-		orderPrice += p.Price * (1 - float64(p.Discount)/100.0) * float64(cnt)
+
+	// Баллами можно оплатить часть суммы товаров, но не доставку и не подарочные сертификаты
+	var loyaltyDiscount models.Money
+	if req.LoyaltyPoints != 0 {
+		if err := checkLoyaltySpend(userID, req.LoyaltyPoints, discountableTotal(products, counts)-couponDiscount(coupon)); err != nil {
+			return errorResponse(c, err)
+		}
+		loyaltyDiscount = loyalty.Value(req.LoyaltyPoints)
+		orderPrice -= loyaltyDiscount
 	}
-	orderResult, err := database.DB.Exec(
-		"INSERT INTO orders (user_id, product_ids, status, created_at, price) VALUES (?, ?, ?, ?, ?)",
-		userID, string(productIDsJSON), "новый", time.Now(), orderPrice,
-	)
+
+	address, err := orderAddress(userID, req.AddressID, req.Address, req.Name, req.Phone, req.DeliveryAddress)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	region := orderRegion(req.Region, address)
+	var shipping *models.ShippingQuote
+	if req.ShippingMethod != "" {
+		// Порог бесплатной доставки - от суммы после промокода, как в /api/shipping/quote: баллы его не уменьшают
+		shipping, err = shippingForOrder(req.ShippingMethod, region, products, counts, orderPrice+loyaltyDiscount)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		orderPrice += shipping.Cost
+	}
+
+	// В режиме цен без налога он добавляется к итогу; подарочная карта покрывает сумму с налогом
+	taxes, err := calculateOrderTax(products, counts, coupon, loyaltyDiscount, shippingCost(shipping))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create order",
+			"error": "Failed to calculate tax",
 		})
 	}
+	if !taxes.Config.Inclusive() {
+		orderPrice += taxes.Total
+	}
 
-	orderID, _ := orderResult.LastInsertId()
+	var giftCard *giftCardResult
+	if req.GiftCardCode != "" {
+		giftCard, err = evaluateGiftCard(req.GiftCardCode, products, orderPrice)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		orderPrice -= giftCard.Amount
+	}
+
+	// Обновляем контактные данные профиля; адрес хранится в адресной книге и в самом заказе
+	if req.Name != "" || req.Phone != "" {
+		_, err = database.DB.Exec(
+			"UPDATE users SET name = COALESCE(NULLIF(?, ''), name), phone = COALESCE(NULLIF(?, ''), phone), updated_at = ? WHERE id = ?",
+			req.Name, req.Phone, time.Now(), userID,
+		)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to update user profile",
+			})
+		}
+	}
+
+	if req.Address != nil && req.AddressID == 0 {
+		rememberOrderAddress(userID, *address)
+	}
+
+	// Создаем заказ
+	o := newOrder{
+		UserID:          userID,
+		ProductIDs:      req.ProductIDs,
+		Products:        products,
+		Counts:          counts,
+		Price:           orderPrice,
+		Coupon:          coupon,
+		Shipping:        shipping,
+		Region:          region,
+		Address:         address,
+		Loyalty:         req.LoyaltyPoints,
+		LoyaltyDiscount: loyaltyDiscount,
+		Tax:             taxes,
+		GiftCard:        giftCard,
+		Currency:        cur,
+	}
+	orderID, err := insertOrder(o)
+	if err != nil {
+		return orderErrorResponse(c, err)
+	}
+
+	notifyOrderPlaced(int(orderID))
+	notifyStaffOrderCreated(int(orderID))
+	emitOrderEvent(models.EventOrderCreated, int(orderID))
+	if o.paidByGiftCard() {
+		onOrderPaid(int(orderID))
+	}
 
 	// Получаем созданный заказ с товарами
 	order, err := getOrderWithProducts(int(orderID))
@@ -212,8 +370,19 @@ func GetUserOrders(c *fiber.Ctx) error {
 		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
+	// Суммы заказов - в валюте ?currency=
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
 	query := `
-		SELECT id, user_id, product_ids, status, price, created_at
+		SELECT id, user_id, product_ids, status, price, COALESCE(coupon_code, ''), COALESCE(coupon_discount, 0), COALESCE(refunded_amount, 0),
+		       COALESCE(shipping_method, ''), COALESCE(shipping_cost, 0), COALESCE(shipping_region, ''), delivery_address, COALESCE(invoice_number, 0),
+		       COALESCE(loyalty_points, 0), COALESCE(loyalty_discount, 0),
+		       COALESCE((SELECT code FROM gift_cards WHERE id = gift_card_id), ''), COALESCE(gift_card_amount, 0),
+		       COALESCE(tax_mode, ''), COALESCE(tax_amount, 0), COALESCE(shipping_tax_rate, 0), COALESCE(shipping_tax, 0),
+		       COALESCE(currency, 'RUB'), COALESCE(exchange_rate, 1), created_at
 		FROM orders
 		WHERE user_id = ?
 		ORDER BY created_at DESC
@@ -230,16 +399,28 @@ func GetUserOrders(c *fiber.Ctx) error {
 	var orders []models.Order
 	for rows.Next() {
 		var order models.Order
-		 err := rows.Scan(&order.ID, &order.UserID, &order.ProductIDs, &order.Status, &order.Price, &order.CreatedAt)
+		err := rows.Scan(&order.ID, &order.UserID, &order.ProductIDs, &order.Status, &order.Price, &order.CouponCode, &order.CouponDiscount, &order.RefundedAmount,
+			&order.ShippingMethod, &order.ShippingCost, &order.ShippingRegion, &order.Address, &order.InvoiceNumber,
+			&order.LoyaltyPoints, &order.LoyaltyDiscount, &order.GiftCardCode, &order.GiftCardAmount,
+			&order.TaxMode, &order.TaxAmount, &order.ShippingTaxRate, &order.ShippingTax,
+			&order.Currency, &order.ExchangeRate, &order.CreatedAt)
 		if err != nil {
 			continue
 		}
 
-		// Получаем товары для каждого заказа
+		// Получаем товары и позиции для каждого заказа
 		products, err := getProductsByIDs(order.ProductIDs)
 		if err == nil {
 			order.Products = products
 		}
+		if items, err := getOrderItems(order.ID); err == nil {
+			order.Items = items
+			order.TaxLines = orderTaxLines(&order)
+		}
+		if shipments, err := getOrderShipments(order.ID); err == nil {
+			order.Shipments = shipments
+		}
+		convertOrder(&order, cur)
 
 		orders = append(orders, order)
 	}
@@ -250,49 +431,470 @@ func GetUserOrders(c *fiber.Ctx) error {
 	if err != nil {
 		// Если не удалось получить пользователя, вернём только заказы
 		return c.JSON(fiber.Map{
-			"orders": orders,
+			"orders":   orders,
+			"currency": currencyCode(cur),
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"orders": orders,
-		"user":   user,
+		"orders":   orders,
+		"user":     user,
+		"currency": currencyCode(cur),
 	})
 }
 
 // Вспомогательные функции
 
+// currentUserID безопасно извлекает userID из контекста — может быть int, int64 или float64
+func currentUserID(c *fiber.Ctx) (int, bool) {
+	switch v := c.Locals("userID").(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
 func getOrderWithProducts(orderID int) (*models.Order, error) {
 	var order models.Order
 	var user models.User
+	var userID sql.NullInt64
 
+	// LEFT JOIN: у гостевого заказа нет пользователя
 	query := `
-		SELECT o.id, o.user_id, o.product_ids, o.status, o.price, o.created_at,
-			   u.id, u.email, COALESCE(u.role, 'user'), COALESCE(u.name, ''), COALESCE(u.phone, ''), COALESCE(u.delivery_address, ''), u.created_at, u.updated_at
+		SELECT o.id, COALESCE(o.user_id, 0), o.product_ids, o.status, o.price, COALESCE(o.coupon_code, ''), COALESCE(o.coupon_discount, 0), COALESCE(o.refunded_amount, 0),
+		       COALESCE(o.shipping_method, ''), COALESCE(o.shipping_cost, 0), COALESCE(o.shipping_region, ''), o.delivery_address, COALESCE(o.invoice_number, 0),
+		       COALESCE(o.loyalty_points, 0), COALESCE(o.loyalty_discount, 0), COALESCE(g.code, ''), COALESCE(o.gift_card_amount, 0),
+		       COALESCE(o.tax_mode, ''), COALESCE(o.tax_amount, 0), COALESCE(o.shipping_tax_rate, 0), COALESCE(o.shipping_tax, 0),
+		       COALESCE(o.currency, 'RUB'), COALESCE(o.exchange_rate, 1),
+		       COALESCE(o.guest_email, ''), COALESCE(o.guest_name, ''), COALESCE(o.guest_phone, ''), COALESCE(o.guest_language, ''), o.created_at,
+			   u.id, COALESCE(u.email, ''), COALESCE(u.role, 'user'), COALESCE(u.name, ''), COALESCE(u.phone, ''), COALESCE(u.delivery_address, ''),
+			   COALESCE(u.created_at, o.created_at), COALESCE(u.updated_at, o.created_at)
 		FROM orders o
-		JOIN users u ON o.user_id = u.id
+		LEFT JOIN users u ON o.user_id = u.id
+		LEFT JOIN gift_cards g ON o.gift_card_id = g.id
 		WHERE o.id = ?
 	`
 
 	err := database.DB.QueryRow(query, orderID).Scan(
-		&order.ID, &order.UserID, &order.ProductIDs, &order.Status, &order.Price, &order.CreatedAt,
-		&user.ID, &user.Email, &user.Role, &user.Name, &user.Phone, &user.DeliveryAddress, &user.CreatedAt, &user.UpdatedAt,
+		&order.ID, &order.UserID, &order.ProductIDs, &order.Status, &order.Price, &order.CouponCode, &order.CouponDiscount, &order.RefundedAmount,
+		&order.ShippingMethod, &order.ShippingCost, &order.ShippingRegion, &order.Address, &order.InvoiceNumber,
+		&order.LoyaltyPoints, &order.LoyaltyDiscount, &order.GiftCardCode, &order.GiftCardAmount,
+		&order.TaxMode, &order.TaxAmount, &order.ShippingTaxRate, &order.ShippingTax,
+		&order.Currency, &order.ExchangeRate,
+		&order.GuestEmail, &order.GuestName, &order.GuestPhone, &order.GuestLanguage, &order.CreatedAt,
+		&userID, &user.Email, &user.Role, &user.Name, &user.Phone, &user.DeliveryAddress, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	order.User = &user
+	if userID.Valid {
+		user.ID = int(userID.Int64)
+		order.User = &user
+	}
 
 	// Получаем товары
 	products, err := getProductsByIDs(order.ProductIDs)
 	if err == nil {
 		order.Products = products
 	}
+	if items, err := getOrderItems(order.ID); err == nil {
+		order.Items = items
+		order.TaxLines = orderTaxLines(&order)
+	}
+	if shipments, err := getOrderShipments(order.ID); err == nil {
+		order.Shipments = shipments
+	}
 
 	return &order, nil
 }
 
+// errorResponse отдаёт *fiber.Error с его кодом и сообщением, остальные ошибки как 500
+func errorResponse(c *fiber.Ctx, err error) error {
+	if e, ok := err.(*fiber.Error); ok {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+}
+
+// orderErrorResponse отдаёт ошибки бизнес-логики (*fiber.Error) как есть, остальные - как ошибку создания заказа
+func orderErrorResponse(c *fiber.Ctx, err error) error {
+	if _, ok := err.(*fiber.Error); ok {
+		return errorResponse(c, err)
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error": "Failed to create order",
+	})
+}
+
+// newOrder - данные для сохранения заказа
+type newOrder struct {
+	UserID          int
+	ProductIDs      []int
+	Products        []models.Product
+	Counts          map[int]int
+	Price           models.Money
+	Coupon          *couponResult
+	Shipping        *models.ShippingQuote
+	Region          string
+	Address         *models.AddressFields
+	Guest           *guestContact // только для гостевого заказа (UserID = 0, в базе user_id IS NULL)
+	Account         *newAccount   // регистрация при оформлении: пользователь создаётся вместе с заказом
+	Loyalty         int           // баллы, потраченные на заказ
+	LoyaltyDiscount models.Money
+	Tax             *orderTax // nil - налог не рассчитывался
+	GiftCard        *giftCardResult
+	Currency        *models.Currency // валюта покупателя; nil - рубли
+}
+
+// newAccount - пользователь, регистрируемый при оформлении заказа; ID заполняет insertOrder
+type newAccount struct {
+	ID              int64
+	Email           string
+	PasswordHash    string
+	Name            string
+	Phone           string
+	DeliveryAddress string
+	Language        string
+}
+
+// paidByGiftCard - заказ целиком оплачен подарочной картой и не требует оплаты через провайдера
+func (o newOrder) paidByGiftCard() bool {
+	return o.GiftCard != nil && o.Price == 0
+}
+
+// insertOrder в одной транзакции создаёт пользователя (o.Account), сохраняет заказ и его позиции,
+// списывает остатки, баллы лояльности и баланс подарочной карты и фиксирует использование промокода
+func insertOrder(o newOrder) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if o.Account != nil {
+		userID, err := insertAccount(tx, o.Account)
+		if err != nil {
+			return 0, err
+		}
+		o.UserID = int(userID)
+	}
+
+	var guest guestContact
+	if o.Guest != nil {
+		guest = *o.Guest
+	}
+
+	var taxMode string
+	var taxAmount, shippingTax models.Money
+	var shippingTaxRate int
+	if o.Tax != nil {
+		taxMode, taxAmount = o.Tax.Config.Mode, o.Tax.Total
+		shippingTaxRate, shippingTax = o.Tax.ShippingRate, o.Tax.Shipping
+	}
+
+	cur := baseCurrency
+	if o.Currency != nil {
+		cur = *o.Currency
+	}
+
+	status := models.OrderStatusNew
+	var giftCardID int
+	var giftCardAmount models.Money
+	if o.GiftCard != nil {
+		giftCardID, giftCardAmount = o.GiftCard.ID, o.GiftCard.Amount
+		if o.paidByGiftCard() {
+			status = models.OrderStatusPaid
+		}
+	}
+
+	productIDsJSON, _ := json.Marshal(o.ProductIDs)
+	result, err := tx.Exec(
+		`INSERT INTO orders (user_id, product_ids, status, created_at, price, coupon_code, coupon_discount, shipping_method, shipping_cost, shipping_region, delivery_address,
+		                     guest_email, guest_name, guest_phone, guest_language, lookup_token_hash, loyalty_points, loyalty_discount,
+		                     gift_card_id, gift_card_amount, tax_mode, tax_amount, shipping_tax_rate, shipping_tax, currency, exchange_rate)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullID(o.UserID), string(productIDsJSON), status, time.Now(), o.Price, couponCode(o.Coupon), couponDiscount(o.Coupon),
+		shippingMethod(o.Shipping), shippingCost(o.Shipping), o.Region, o.Address,
+		nullString(guest.Email), nullString(guest.Name), nullString(guest.Phone), nullString(guest.Language), nullString(guest.TokenHash),
+		o.Loyalty, o.LoyaltyDiscount, nullID(giftCardID), giftCardAmount,
+		nullString(taxMode), taxAmount, shippingTaxRate, shippingTax, cur.Code, cur.Rate,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range o.Products {
+		quantity := o.Counts[p.ID]
+		taxRate, taxAmount := o.Tax.line(p.ID)
+		result, err := tx.Exec(
+			"INSERT INTO order_items (order_id, product_id, quantity, price, list_price, tax_rate, tax_amount) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			orderID, p.ID, quantity, discountedPrice(p), p.Price, taxRate, taxAmount,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		// Набор раскладывается на компоненты: они комплектуются и списываются со склада
+		if len(p.Components) > 0 {
+			itemID, err := result.LastInsertId()
+			if err != nil {
+				return 0, err
+			}
+			if err := insertBundleComponents(tx, orderID, itemID, p, quantity); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if err := adjustStock(tx, p.ID, -quantity); err != nil {
+			return 0, err
+		}
+	}
+
+	if o.Coupon != nil {
+		if err := recordCouponUsage(tx, o.Coupon, o.UserID, guest.Email, orderID); err != nil {
+			return 0, err
+		}
+	}
+
+	if o.Loyalty > 0 {
+		if err := spendOrderLoyalty(tx, o.UserID, orderID, o.Loyalty); err != nil {
+			return 0, err
+		}
+	}
+
+	if o.GiftCard != nil {
+		if err := redeemGiftCard(tx, o.GiftCard, orderID); err != nil {
+			return 0, err
+		}
+	}
+	if status == models.OrderStatusPaid {
+		if err := assignInvoiceNumber(tx, int(orderID)); err != nil {
+			return 0, err
+		}
+	}
+
+	return orderID, tx.Commit()
+}
+
+// insertAccount создаёт пользователя, регистрирующегося при оформлении заказа
+func insertAccount(tx *sql.Tx, a *newAccount) (int64, error) {
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", a.Email).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists > 0 {
+		return 0, fiber.NewError(400, "User already exists")
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(
+		"INSERT INTO users (email, password, name, phone, delivery_address, language, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		a.Email, a.PasswordHash, a.Name, a.Phone, a.DeliveryAddress, a.Language, now, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	a.ID, err = result.LastInsertId()
+	return a.ID, err
+}
+
+// checkStock - предварительная проверка остатков до оформления заказа.
+// Наборы проверяются по компонентам вместе с теми же товарами, купленными отдельно.
+func checkStock(products []models.Product, counts map[int]int) error {
+	ids, demand, stock := stockDemand(products, counts)
+	for _, id := range ids {
+		if s := stock[id]; s != nil && *s < demand[id] {
+			return fiber.NewError(409, fmt.Sprintf("Insufficient stock for product %d", id))
+		}
+	}
+	return nil
+}
+
+// adjustStock изменяет остаток товара на delta; товары без учёта остатков (stock IS NULL) не меняются.
+// Списание больше остатка возвращает *fiber.Error с кодом 409.
+func adjustStock(tx *sql.Tx, productID int, delta int) error {
+	result, err := tx.Exec(
+		"UPDATE products SET stock = stock + ? WHERE id = ? AND stock IS NOT NULL AND stock + ? >= 0",
+		delta, productID, delta,
+	)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 && delta < 0 {
+		var stock sql.NullInt64
+		if err := tx.QueryRow("SELECT stock FROM products WHERE id = ?", productID).Scan(&stock); err != nil {
+			return err
+		}
+		if stock.Valid {
+			return fiber.NewError(409, fmt.Sprintf("Insufficient stock for product %d", productID))
+		}
+	}
+
+	return nil
+}
+
+// getOrderItems возвращает позиции заказа. Для заказов, созданных до появления order_items,
+// позиции восстанавливаются из product_ids по текущим ценам.
+func getOrderItems(orderID int) ([]models.OrderItem, error) {
+	rows, err := database.DB.Query(`
+		SELECT oi.id, COALESCE(oi.parent_id, 0), oi.product_id, COALESCE(p.name, ''), oi.quantity, oi.price, COALESCE(NULLIF(oi.list_price, 0), oi.price),
+		       COALESCE(oi.tax_rate, 0), COALESCE(oi.tax_amount, 0)
+		FROM order_items oi
+		LEFT JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id = ?
+		ORDER BY oi.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Компоненты наборов идут после строки набора и вкладываются в неё
+	var items []models.OrderItem
+	positions := map[int]int{}
+	for rows.Next() {
+		var id, parentID int
+		var item models.OrderItem
+		if err := rows.Scan(&id, &parentID, &item.ProductID, &item.Name, &item.Quantity, &item.Price, &item.ListPrice, &item.TaxRate, &item.TaxAmount); err != nil {
+			continue
+		}
+		if i, ok := positions[parentID]; ok {
+			items[i].Components = append(items[i].Components, item)
+			continue
+		}
+		positions[id] = len(items)
+		items = append(items, item)
+	}
+	if len(items) > 0 {
+		return items, nil
+	}
+
+	var productIDs models.IntArray
+	if err := database.DB.QueryRow("SELECT product_ids FROM orders WHERE id = ?", orderID).Scan(&productIDs); err != nil {
+		return nil, err
+	}
+	products, counts, err := loadOrderItems(productIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		items = append(items, models.OrderItem{ProductID: p.ID, Name: p.Name, Quantity: counts[p.ID], Price: discountedPrice(p), ListPrice: p.Price})
+	}
+
+	return items, nil
+}
+
+// loadOrderItems загружает товары заказа и считает количество каждого товара
+func loadOrderItems(productIDs []int) ([]models.Product, map[int]int, error) {
+	counts := make(map[int]int)
+	for _, id := range productIDs {
+		counts[id]++
+	}
+	// Получим уникальные id для выборки
+	uniqueIDs := make([]int, 0, len(counts))
+	for id := range counts {
+		uniqueIDs = append(uniqueIDs, id)
+	}
+
+	products, err := getProductsByIDs(models.IntArray(uniqueIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return products, counts, nil
+}
+
+// discountedPrice - цена товара с учётом его скидки, округлённая до копейки
+func discountedPrice(p models.Product) models.Money {
+	return p.Price.ApplyDiscount(p.Discount)
+}
+
+// itemsTotal - сумма товаров с учётом скидок и количеств.
+// Скидка округляется за единицу товара, затем умножается на количество.
+func itemsTotal(products []models.Product, counts map[int]int) models.Money {
+	var total models.Money
+	for _, p := range products {
+		total += discountedPrice(p).Mul(counts[p.ID])
+	}
+	return total
+}
+
+// discountableTotal - сумма товаров без подарочных сертификатов: на неё действуют промокоды и баллы
+func discountableTotal(products []models.Product, counts map[int]int) models.Money {
+	var total models.Money
+	for _, p := range products {
+		if !p.GiftCard {
+			total += discountedPrice(p).Mul(counts[p.ID])
+		}
+	}
+	return total
+}
+
+func couponCode(result *couponResult) string {
+	if result == nil {
+		return ""
+	}
+	return result.Coupon.Code
+}
+
+func couponDiscount(result *couponResult) models.Money {
+	if result == nil {
+		return 0
+	}
+	return result.Discount
+}
+
+// orderRegion - регион доставки: явно переданный или город из адреса
+func orderRegion(region string, address *models.AddressFields) string {
+	if region == "" && address != nil {
+		return address.City
+	}
+	return region
+}
+
+func shippingMethod(quote *models.ShippingQuote) string {
+	if quote == nil {
+		return ""
+	}
+	return quote.Method
+}
+
+func shippingCost(quote *models.ShippingQuote) models.Money {
+	if quote == nil {
+		return 0
+	}
+	return quote.Cost
+}
+
+// syncOrderBalances пересчитывает баллы лояльности и подарочные карты заказа после смены статуса или возврата
+func syncOrderBalances(orderID int) {
+	syncOrderLoyalty(orderID)
+	syncOrderGiftCards(orderID)
+}
+
+// nullString - пустая строка сохраняется как NULL (важно для уникальных колонок)
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullID - нулевой идентификатор (например, пользователь гостевого заказа) сохраняется как NULL
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
 func getProductsByIDs(productIDs models.IntArray) ([]models.Product, error) {
 	if len(productIDs) == 0 {
 		return []models.Product{}, nil
@@ -311,7 +913,7 @@ func getProductsByIDs(productIDs models.IntArray) ([]models.Product, error) {
 
 	query := `
 		SELECT p.id, p.name, p.price, p.short_description, p.long_description,
-		       p.sku, p.discount, p.images, p.category_id, p.created_at, p.updated_at,
+		       p.sku, p.discount, p.stock, p.weight, p.gift_card, p.images, p.category_id, p.created_at, p.updated_at,
 		       c.id, c.name, c.alias
 		FROM products p
 		JOIN categories c ON p.category_id = c.id
@@ -331,7 +933,7 @@ func getProductsByIDs(productIDs models.IntArray) ([]models.Product, error) {
 
 		err := rows.Scan(
 			&product.ID, &product.Name, &product.Price, &product.ShortDescription,
-			&product.LongDescription, &product.SKU, &product.Discount, &product.Images,
+			&product.LongDescription, &product.SKU, &product.Discount, &product.Stock, &product.Weight, &product.GiftCard, &product.Images,
 			&product.CategoryID, &product.CreatedAt, &product.UpdatedAt,
 			&category.ID, &category.Name, &category.Alias,
 		)
@@ -343,5 +945,10 @@ func getProductsByIDs(productIDs models.IntArray) ([]models.Product, error) {
 		products = append(products, product)
 	}
 
+	// Цена, остаток и состав наборов вычисляются по компонентам
+	if err := applyBundles(products); err != nil {
+		return nil, err
+	}
+
 	return products, nil
 }
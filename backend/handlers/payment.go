@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/payments"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateOrderPayment - создание платежа по заказу у платёжного провайдера.
+// Гостевой заказ оплачивается по токену из ссылки.
+func CreateOrderPayment(c *fiber.Ctx) error {
+	if _, ok := currentUserID(c); !ok && requestOrderToken(c) == "" {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	orderID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
+	}
+
+	var req models.CreatePaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Provider == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "provider is required"})
+	}
+
+	provider, ok := payments.Get(req.Provider)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Unknown payment provider"})
+	}
+
+	var ownerID int
+	var status string
+	var price models.Money
+	err = database.DB.QueryRow("SELECT COALESCE(user_id, 0), status, price FROM orders WHERE id = ?", orderID).Scan(&ownerID, &status, &price)
+	if err == sql.ErrNoRows || (err == nil && !orderAccessAllowed(c, orderID, ownerID, false)) {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if status != models.OrderStatusNew {
+		return c.Status(400).JSON(fiber.Map{"error": "Order cannot be paid in status " + status})
+	}
+
+	// У заказа может быть только один незавершённый платёж, иначе его можно оплатить дважды.
+	// Повторный запрос к тому же провайдеру возвращает уже созданный платёж.
+	pending, err := getOrderPendingPayment(orderID)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if pending != nil {
+		if pending.Provider != provider.Name() || pending.Amount != price {
+			return c.Status(409).JSON(fiber.Map{"error": "Order already has a pending payment"})
+		}
+		return c.JSON(fiber.Map{
+			"payment":          pending,
+			"confirmation_url": pending.ConfirmationURL,
+		})
+	}
+
+	session, err := provider.CreatePayment(payments.PaymentRequest{
+		OrderID:     orderID,
+		Amount:      price,
+		Description: fmt.Sprintf("Заказ №%d", orderID),
+		ReturnURL:   req.ReturnURL,
+	})
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{"error": "Failed to create payment"})
+	}
+
+	now := time.Now()
+	result, err := database.DB.Exec(`
+		INSERT INTO payments (order_id, provider, external_id, amount, refunded_amount, status, confirmation_url, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?)
+	`, orderID, provider.Name(), session.ExternalID, price, payments.StatusPending, session.ConfirmationURL, now, now)
+	if err != nil {
+		// Параллельный запрос успел создать платёж: уникальный индекс по незавершённым платежам заказа
+		if _, pendingErr := getOrderPendingPayment(orderID); pendingErr == nil {
+			return c.Status(409).JSON(fiber.Map{"error": "Order already has a pending payment"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save payment"})
+	}
+
+	paymentID, _ := result.LastInsertId()
+	payment, err := getPayment("id", paymentID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch payment"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"payment":          payment,
+		"confirmation_url": session.ConfirmationURL,
+	})
+}
+
+// PaymentWebhook - уведомление от платёжного провайдера с проверкой подписи
+func PaymentWebhook(c *fiber.Ctx) error {
+	provider, ok := payments.Get(c.Params("provider"))
+	if !ok || c.Params("provider") == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "Unknown payment provider"})
+	}
+
+	event, err := provider.HandleCallback(c.Body(), func(key string) string { return c.Get(key) })
+	if err == payments.ErrInvalidSignature {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid signature"})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid callback"})
+	}
+
+	payment, err := getPayment("external_id", event.ExternalID)
+	if err == sql.ErrNoRows || (err == nil && payment.Provider != provider.Name()) {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	// Повторные уведомления по уже обработанному платежу игнорируем
+	if payment.Status != payments.StatusPending {
+		if payment.Status == payments.StatusFailed && event.Status == payments.StatusSucceeded {
+			log.Printf("Payment %d of order %d succeeded after it was closed, refund it manually", payment.ID, payment.OrderID)
+		}
+		return c.JSON(fiber.Map{"success": true})
+	}
+
+	if err := applyPaymentStatus(payment, event.Status); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update payment"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// applyPaymentStatus обновляет статус незавершённого платежа; успешная оплата переводит заказ из "новый" в "оплачен".
+// Повторное уведомление ничего не меняет. Если заказ уже не ждёт оплаты (например, отменён),
+// платёж фиксируется как успешный, но заказ не меняется - деньги нужно вернуть через админку.
+func applyPaymentStatus(payment *models.Payment, status string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE payments SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+		status, time.Now(), payment.ID, payments.StatusPending)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 {
+		return nil
+	}
+
+	paid := false
+	if status == payments.StatusSucceeded {
+		result, err := tx.Exec("UPDATE orders SET status = ? WHERE id = ? AND status = ?",
+			models.OrderStatusPaid, payment.OrderID, models.OrderStatusNew)
+		if err != nil {
+			return err
+		}
+		affected, _ := result.RowsAffected()
+		paid = affected == 1
+		if paid {
+			if err := assignInvoiceNumber(tx, payment.OrderID); err != nil {
+				return err
+			}
+		} else {
+			log.Printf("Payment %d succeeded for order %d that is not awaiting payment, refund it manually", payment.ID, payment.OrderID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if paid {
+		onOrderPaid(payment.OrderID)
+	}
+
+	return nil
+}
+
+// onOrderPaid - действия после успешной оплаты заказа
+func onOrderPaid(orderID int) {
+	log.Printf("Order %d paid", orderID)
+	syncOrderBalances(orderID)
+	notifyOrderStatus(orderID)
+	emitOrderEvent(models.EventOrderStatusChanged, orderID)
+	notifyStaffOrderPaid(orderID)
+}
+
+// FakePaymentPage - страница подтверждения платежа локального тестового шлюза
+func FakePaymentPage(c *fiber.Ctx) error {
+	fake, ok := fakeProvider()
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Fake payment provider is disabled"})
+	}
+
+	payment, err := getPayment("external_id", c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+
+	var buf bytes.Buffer
+	if err := fake.RenderPage(&buf, payment.ExternalID, payment.Amount, payment.Status); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to render page"})
+	}
+
+	c.Type("html", "utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// FakePaymentConfirm - решение покупателя на странице тестового шлюза (action=pay|fail)
+func FakePaymentConfirm(c *fiber.Ctx) error {
+	fake, ok := fakeProvider()
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Fake payment provider is disabled"})
+	}
+
+	payment, err := getPayment("external_id", c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+
+	if payment.Status == payments.StatusPending {
+		if err := fake.Complete(payment.ExternalID, c.FormValue("action") == "pay"); err != nil {
+			return c.Status(502).JSON(fiber.Map{"error": "Failed to deliver webhook: " + err.Error()})
+		}
+	}
+
+	return c.Redirect("/api/payments/fake/"+payment.ExternalID, fiber.StatusSeeOther)
+}
+
+// AdminRefundPayment - возврат (полный или частичный) успешного платежа
+func AdminRefundPayment(c *fiber.Ctx) error {
+	paymentID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid payment ID"})
+	}
+
+	var req models.RefundRequest
+	if err := c.BodyParser(&req); err != nil && len(c.Body()) > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	payment, err := getPayment("id", paymentID)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := refundPayment(payment, req.Amount); err != nil {
+		return errorResponse(c, err)
+	}
+
+	payment, err = getPayment("id", paymentID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch payment"})
+	}
+
+	return c.JSON(fiber.Map{"payment": payment})
+}
+
+// refundPayment возвращает amount (0 - весь остаток) через провайдера и фиксирует возврат
+// в платеже и в сумме возвратов заказа. Сумма резервируется в платеже до обращения к провайдеру,
+// поэтому одновременные возвраты не могут вернуть больше оплаченного; при ошибке провайдера резерв снимается.
+// Ошибки валидации возвращаются как *fiber.Error.
+func refundPayment(payment *models.Payment, amount models.Money) error {
+	if payment.Status != payments.StatusSucceeded {
+		return fiber.NewError(400, "Only succeeded payments can be refunded")
+	}
+
+	remaining := payment.Amount - payment.RefundedAmount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		return fiber.NewError(400, "Invalid refund amount")
+	}
+
+	provider, ok := payments.Get(payment.Provider)
+	if !ok {
+		return fiber.NewError(400, "Unknown payment provider")
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE payments SET refunded_amount = refunded_amount + ?, updated_at = ?
+		WHERE id = ? AND status = ? AND refunded_amount + ? <= amount
+	`, amount, time.Now(), payment.ID, payments.StatusSucceeded, amount)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 {
+		return fiber.NewError(409, "Refund exceeds the remaining amount of the payment")
+	}
+
+	if err := provider.Refund(payment.ExternalID, amount); err != nil {
+		if _, undoErr := database.DB.Exec("UPDATE payments SET refunded_amount = refunded_amount - ?, updated_at = ? WHERE id = ?",
+			amount, time.Now(), payment.ID); undoErr != nil {
+			log.Printf("Failed to release refund reservation of payment %d: %v", payment.ID, undoErr)
+		}
+		return fiber.NewError(502, "Provider refund failed: "+err.Error())
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Платёж возвращён полностью - резервы всех возвратов покрыли его сумму
+	result, err = tx.Exec("UPDATE payments SET status = ?, updated_at = ? WHERE id = ? AND status = ? AND refunded_amount = amount",
+		payments.StatusRefunded, time.Now(), payment.ID, payments.StatusSucceeded)
+	if err != nil {
+		return err
+	}
+	affected, _ := result.RowsAffected()
+	fullyRefunded := affected == 1
+
+	if err := recordOrderRefund(tx, payment.OrderID, amount); err != nil {
+		return err
+	}
+	// Отменённый заказ остаётся отменённым: возврат по нему - следствие отмены
+	if fullyRefunded {
+		if _, err := tx.Exec("UPDATE orders SET status = ? WHERE id = ? AND status != ?",
+			models.OrderStatusRefunded, payment.OrderID, models.OrderStatusCancelled); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Payment %d: %s refunded at the provider but not recorded in the order: %v", payment.ID, amount, err)
+		return err
+	}
+
+	// Начисленные за заказ баллы уменьшаются пропорционально возврату, при полном возврате аннулируются купленные подарочные карты
+	syncOrderBalances(payment.OrderID)
+	if fullyRefunded {
+		emitOrderEvent(models.EventOrderStatusChanged, payment.OrderID)
+	}
+	return nil
+}
+
+// recordOrderRefund увеличивает сумму возвратов по заказу
+func recordOrderRefund(db sqlExecer, orderID int, amount models.Money) error {
+	_, err := db.Exec("UPDATE orders SET refunded_amount = COALESCE(refunded_amount, 0) + ? WHERE id = ?", amount, orderID)
+	return err
+}
+
+// getOrderSucceededPayment возвращает последний успешный платёж заказа
+func getOrderSucceededPayment(orderID int) (*models.Payment, error) {
+	var id int
+	err := database.DB.QueryRow(
+		"SELECT id FROM payments WHERE order_id = ? AND status = ? ORDER BY id DESC LIMIT 1",
+		orderID, payments.StatusSucceeded,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return getPayment("id", id)
+}
+
+// getOrderPendingPayment возвращает незавершённый платёж заказа
+func getOrderPendingPayment(orderID int) (*models.Payment, error) {
+	var id int
+	err := database.DB.QueryRow(
+		"SELECT id FROM payments WHERE order_id = ? AND status = ? ORDER BY id DESC LIMIT 1",
+		orderID, payments.StatusPending,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return getPayment("id", id)
+}
+
+func fakeProvider() (*payments.FakeProvider, bool) {
+	p, ok := payments.Get("fake")
+	if !ok {
+		return nil, false
+	}
+	fake, ok := p.(*payments.FakeProvider)
+	return fake, ok
+}
+
+// getPayment ищет платёж по id или external_id
+func getPayment(column string, value interface{}) (*models.Payment, error) {
+	var p models.Payment
+	err := database.DB.QueryRow(`
+		SELECT id, order_id, provider, external_id, amount, refunded_amount, status, COALESCE(confirmation_url, ''), created_at, updated_at
+		FROM payments
+		WHERE `+column+` = ?
+	`, value).Scan(&p.ID, &p.OrderID, &p.Provider, &p.ExternalID, &p.Amount, &p.RefundedAmount,
+		&p.Status, &p.ConfirmationURL, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Helper functions for Payments (admin, только чтение)
+var paymentsAdminList = &adminList{
+	from: "payments",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"order_id":        {"order_id", fieldInt},
+		"provider":        {"provider", fieldText},
+		"external_id":     {"external_id", fieldText},
+		"amount":          {"amount", fieldMoney},
+		"refunded_amount": {"refunded_amount", fieldMoney},
+		"status":          {"status", fieldText},
+		"created_at":      {"created_at", fieldTime},
+		"updated_at":      {"updated_at", fieldTime},
+	},
+	search: []string{"external_id", "provider"},
+	sort:   "-created_at",
+}
+
+func getPaymentsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, order_id, provider, external_id, amount, refunded_amount, status, created_at, updated_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var p models.Payment
+		if err := rows.Scan(&p.ID, &p.OrderID, &p.Provider, &p.ExternalID, &p.Amount, &p.RefundedAmount,
+			&p.Status, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			continue
+		}
+
+		items = append(items, map[string]interface{}{
+			"id":              p.ID,
+			"order_id":        p.OrderID,
+			"provider":        p.Provider,
+			"external_id":     p.ExternalID,
+			"amount":          p.Amount,
+			"refunded_amount": p.RefundedAmount,
+			"status":          p.Status,
+			"created_at":      p.CreatedAt.Format(time.RFC3339),
+			"updated_at":      p.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Статусы запланированных изменений цены
+const (
+	scheduleStatusPending  = "pending"
+	scheduleStatusActive   = "active"
+	scheduleStatusFinished = "finished"
+	scheduleStatusConflict = "conflict" // завершено без отката: цену изменили вручную во время акции
+)
+
+// PriceHistoryEntry - запись истории цены товара
+type PriceHistoryEntry struct {
+	Price      models.Money `json:"price"`
+	Discount   int          `json:"discount"`
+	FinalPrice models.Money `json:"final_price"`
+	Source     string       `json:"source"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// sqlExecer - общий интерфейс *sql.DB и *sql.Tx для выполнения запросов
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// GetPriceHistory - история цены товара и минимальная цена за последние 30 дней
+func GetPriceHistory(c *fiber.Ctx) error {
+	productID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var price models.Money
+	var discount int
+	err = database.DB.QueryRow("SELECT price, discount FROM products WHERE id = ?", productID).Scan(&price, &discount)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT price, discount, final_price, source, created_at
+		FROM price_history
+		WHERE product_id = ?
+		ORDER BY created_at ASC, id ASC
+	`, productID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch price history"})
+	}
+	defer rows.Close()
+
+	history := []PriceHistoryEntry{}
+	for rows.Next() {
+		var e PriceHistoryEntry
+		if err := rows.Scan(&e.Price, &e.Discount, &e.FinalPrice, &e.Source, &e.CreatedAt); err != nil {
+			continue
+		}
+		history = append(history, e)
+	}
+
+	currentPrice := price.ApplyDiscount(discount)
+	since := time.Now().AddDate(0, 0, -30)
+
+	// Учитываем текущую цену, все изменения за период
+	// и цену, действовавшую на начало периода
+	lowest := currentPrice
+	for i, e := range history {
+		inWindow := !e.CreatedAt.Before(since)
+		lastBeforeWindow := !inWindow && (i == len(history)-1 || !history[i+1].CreatedAt.Before(since))
+		if (inWindow || lastBeforeWindow) && e.FinalPrice < lowest {
+			lowest = e.FinalPrice
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"product_id":       productID,
+		"current_price":    currentPrice,
+		"lowest_price_30d": lowest,
+		"history":          history,
+	})
+}
+
+// StartPriceScheduler запускает фоновое применение запланированных цен и скидок
+func StartPriceScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := applyPriceSchedules(time.Now()); err != nil {
+				log.Printf("Price scheduler error: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// applyPriceSchedules включает наступившие изменения цен и откатывает завершившиеся
+func applyPriceSchedules(now time.Time) error {
+	rows, err := database.DB.Query(`
+		SELECT id, product_id, price, discount, starts_at, ends_at, status
+		FROM price_schedules
+		WHERE status IN (?, ?)
+		ORDER BY starts_at ASC
+	`, scheduleStatusPending, scheduleStatusActive)
+	if err != nil {
+		return err
+	}
+
+	type schedule struct {
+		id, productID int
+		price         sql.NullInt64
+		discount      sql.NullInt64
+		startsAt      time.Time
+		endsAt        sql.NullTime
+		status        string
+	}
+
+	var due []schedule
+	for rows.Next() {
+		var s schedule
+		if err := rows.Scan(&s.id, &s.productID, &s.price, &s.discount, &s.startsAt, &s.endsAt, &s.status); err != nil {
+			continue
+		}
+		switch {
+		case s.status == scheduleStatusActive && s.endsAt.Valid && !now.Before(s.endsAt.Time):
+			due = append(due, s)
+		case s.status == scheduleStatusPending && !now.Before(s.startsAt):
+			due = append(due, s)
+		}
+	}
+	rows.Close()
+
+	for _, s := range due {
+		var err error
+		if s.status == scheduleStatusPending {
+			err = activatePriceSchedule(s.id, s.productID, s.price, s.discount, s.endsAt, now)
+		} else {
+			err = finishPriceSchedule(s.id)
+		}
+		if err != nil {
+			log.Printf("Failed to apply price schedule %d: %v", s.id, err)
+			continue
+		}
+		emitProductEvent(models.EventProductUpdated, s.productID)
+		dispatchProductAlerts(s.productID)
+	}
+
+	return nil
+}
+
+// activatePriceSchedule применяет запланированные цену/скидку, запоминая прежние значения.
+// Изменение без ends_at постоянное и сразу завершается; если окно уже прошло
+// целиком (сервер был выключен), оно завершается без изменения цены.
+func activatePriceSchedule(id, productID int, price sql.NullInt64, discount sql.NullInt64, endsAt sql.NullTime, now time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var prevPrice models.Money
+	var prevDiscount int
+	if err := tx.QueryRow("SELECT price, discount FROM products WHERE id = ?", productID).Scan(&prevPrice, &prevDiscount); err != nil {
+		return err
+	}
+
+	if endsAt.Valid && !now.Before(endsAt.Time) {
+		if _, err := tx.Exec("UPDATE price_schedules SET status = ? WHERE id = ?", scheduleStatusFinished, id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	newPrice, newDiscount := prevPrice, prevDiscount
+	if price.Valid {
+		newPrice = models.Money(price.Int64)
+	}
+	if discount.Valid {
+		newDiscount = int(discount.Int64)
+	}
+
+	if _, err := tx.Exec("UPDATE products SET price = ?, discount = ?, updated_at = ? WHERE id = ?", newPrice, newDiscount, time.Now(), productID); err != nil {
+		return err
+	}
+	status := scheduleStatusActive
+	if !endsAt.Valid {
+		status = scheduleStatusFinished
+	}
+	if _, err := tx.Exec("UPDATE price_schedules SET status = ?, prev_price = ?, prev_discount = ? WHERE id = ?",
+		status, prevPrice, prevDiscount, id); err != nil {
+		return err
+	}
+	if newPrice != prevPrice || newDiscount != prevDiscount {
+		if err := recordPriceChange(tx, productID, newPrice, newDiscount, "schedule"); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// finishPriceSchedule возвращает цену и скидку, действовавшие до начала акции.
+// Если во время акции цену или скидку изменили вручную, они не трогаются,
+// а изменение завершается со статусом conflict.
+func finishPriceSchedule(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var productID int
+	var prevPrice, appliedPrice, currentPrice models.Money
+	var prevDiscount, appliedDiscount, currentDiscount int
+	err = tx.QueryRow(`
+		SELECT s.product_id, s.prev_price, s.prev_discount, COALESCE(s.price, s.prev_price), COALESCE(s.discount, s.prev_discount),
+		       p.price, p.discount
+		FROM price_schedules s JOIN products p ON p.id = s.product_id
+		WHERE s.id = ?
+	`, id).Scan(&productID, &prevPrice, &prevDiscount, &appliedPrice, &appliedDiscount, &currentPrice, &currentDiscount)
+	if err != nil {
+		return err
+	}
+
+	if currentPrice != appliedPrice || currentDiscount != appliedDiscount {
+		if _, err := tx.Exec("UPDATE price_schedules SET status = ? WHERE id = ?", scheduleStatusConflict, id); err != nil {
+			return err
+		}
+		log.Printf("Price schedule %d finished without reverting: product %d price was changed during the sale", id, productID)
+		return tx.Commit()
+	}
+
+	if _, err := tx.Exec("UPDATE products SET price = ?, discount = ?, updated_at = ? WHERE id = ?", prevPrice, prevDiscount, time.Now(), productID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE price_schedules SET status = ? WHERE id = ?", scheduleStatusFinished, id); err != nil {
+		return err
+	}
+	if err := recordPriceChange(tx, productID, prevPrice, prevDiscount, "schedule"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordPriceChange добавляет запись в историю цен
+func recordPriceChange(db sqlExecer, productID int, price models.Money, discount int, source string) error {
+	_, err := db.Exec(
+		"INSERT INTO price_history (product_id, price, discount, final_price, source, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		productID, price, discount, price.ApplyDiscount(discount), source, time.Now(),
+	)
+	return err
+}
+
+// Helper functions for Price Schedules (admin)
+var priceSchedulesAdminList = &adminList{
+	from: "price_schedules",
+	fields: map[string]adminField{
+		"id":         {"id", fieldInt},
+		"product_id": {"product_id", fieldInt},
+		"price":      {"price", fieldMoney},
+		"discount":   {"discount", fieldInt},
+		"starts_at":  {"starts_at", fieldTime},
+		"ends_at":    {"ends_at", fieldTime},
+		"status":     {"status", fieldText},
+		"created_at": {"created_at", fieldTime},
+	},
+	search: []string{"status"},
+	sort:   "-starts_at",
+}
+
+func getPriceSchedulesForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, product_id, price, discount, starts_at, ends_at, status, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, productID int
+		var price sql.NullInt64
+		var discount sql.NullInt64
+		var startsAt, createdAt time.Time
+		var endsAt sql.NullTime
+		var status string
+
+		if err := rows.Scan(&id, &productID, &price, &discount, &startsAt, &endsAt, &status, &createdAt); err != nil {
+			continue
+		}
+
+		item := map[string]interface{}{
+			"id":         id,
+			"product_id": productID,
+			"price":      nil,
+			"discount":   nil,
+			"starts_at":  startsAt.Format(time.RFC3339),
+			"ends_at":    nullTimeToString(endsAt),
+			"status":     status,
+			"created_at": createdAt.Format(time.RFC3339),
+		}
+		if price.Valid {
+			item["price"] = models.Money(price.Int64)
+		}
+		if discount.Valid {
+			item["discount"] = discount.Int64
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func createPriceSchedule(data map[string]interface{}) (int64, error) {
+	productID, price, discount, startsAt, endsAt, err := priceScheduleFromMap(data)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkScheduleOverlap(0, productID, startsAt, endsAt); err != nil {
+		return 0, err
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO price_schedules (product_id, price, discount, starts_at, ends_at, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, productID, price, discount, startsAt, endsAt, scheduleStatusPending, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// updatePriceSchedule разрешает редактировать только ещё не начавшиеся изменения
+func updatePriceSchedule(id int, data map[string]interface{}) error {
+	var status string
+	if err := database.DB.QueryRow("SELECT status FROM price_schedules WHERE id = ?", id).Scan(&status); err != nil {
+		return err
+	}
+	if status != scheduleStatusPending {
+		return fiber.NewError(409, "only pending schedules can be changed")
+	}
+
+	productID, price, discount, startsAt, endsAt, err := priceScheduleFromMap(data)
+	if err != nil {
+		return err
+	}
+
+	if err := checkScheduleOverlap(id, productID, startsAt, endsAt); err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE price_schedules SET product_id = ?, price = ?, discount = ?, starts_at = ?, ends_at = ? WHERE id = ?
+	`, productID, price, discount, startsAt, endsAt, id)
+	return err
+}
+
+// deletePriceSchedule отменяет изменение; активная акция при этом откатывается
+func deletePriceSchedule(id int) error {
+	var status string
+	var productID int
+	if err := database.DB.QueryRow("SELECT status, product_id FROM price_schedules WHERE id = ?", id).Scan(&status, &productID); err != nil {
+		return err
+	}
+
+	if status == scheduleStatusActive {
+		if err := finishPriceSchedule(id); err != nil {
+			return err
+		}
+		emitProductEvent(models.EventProductUpdated, productID)
+		dispatchProductAlerts(productID)
+	}
+
+	_, err := database.DB.Exec("DELETE FROM price_schedules WHERE id = ?", id)
+	return err
+}
+
+func priceScheduleFromMap(data map[string]interface{}) (int, sql.NullInt64, sql.NullInt64, time.Time, sql.NullTime, error) {
+	productID := toInt(data["product_id"])
+	var price sql.NullInt64
+	var discount sql.NullInt64
+	if v, ok := data["price"]; ok && v != nil && toString(v) != "" {
+		price = sql.NullInt64{Int64: int64(toMoney(v)), Valid: true}
+	}
+	if v, ok := data["discount"]; ok && v != nil && toString(v) != "" {
+		discount = sql.NullInt64{Int64: int64(toInt(v)), Valid: true}
+	}
+
+	startsAt := parseNullTimeFromMap(data, "starts_at")
+	endsAt := parseNullTimeFromMap(data, "ends_at")
+
+	switch {
+	case productID == 0:
+		return 0, price, discount, time.Time{}, endsAt, fiber.NewError(400, "product_id is required")
+	case !price.Valid && !discount.Valid:
+		return 0, price, discount, time.Time{}, endsAt, fiber.NewError(400, "price or discount is required")
+	case discount.Valid && (discount.Int64 < 0 || discount.Int64 > 100):
+		return 0, price, discount, time.Time{}, endsAt, fiber.NewError(400, "discount must be between 0 and 100")
+	case !startsAt.Valid:
+		return 0, price, discount, time.Time{}, endsAt, fiber.NewError(400, "starts_at is required")
+	case endsAt.Valid && !endsAt.Time.After(startsAt.Time):
+		return 0, price, discount, time.Time{}, endsAt, fiber.NewError(400, "ends_at must be after starts_at")
+	}
+
+	return productID, price, discount, startsAt.Time, endsAt, nil
+}
+
+// checkScheduleOverlap запрещает пересекающиеся изменения одного товара,
+// иначе откат по окончании акции вернул бы неверную цену
+func checkScheduleOverlap(id, productID int, startsAt time.Time, endsAt sql.NullTime) error {
+	rows, err := database.DB.Query(`
+		SELECT starts_at, ends_at FROM price_schedules
+		WHERE product_id = ? AND id != ? AND status IN (?, ?)
+	`, productID, id, scheduleStatusPending, scheduleStatusActive)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var otherStart time.Time
+		var otherEnd sql.NullTime
+		if err := rows.Scan(&otherStart, &otherEnd); err != nil {
+			continue
+		}
+		startsBeforeOtherEnds := !otherEnd.Valid || startsAt.Before(otherEnd.Time)
+		endsAfterOtherStarts := !endsAt.Valid || endsAt.Time.After(otherStart)
+		if startsBeforeOtherEnds && endsAfterOtherStarts {
+			return fiber.NewError(409, "schedule overlaps with another schedule for this product")
+		}
+	}
+
+	return nil
+}
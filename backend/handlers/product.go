@@ -20,12 +20,17 @@ func GetProduct(c *fiber.Ctx) error {
 		})
 	}
 
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
 	var product models.Product
 	var category models.Category
 
 	query := `
 		SELECT p.id, p.name, p.price, p.short_description, p.long_description, 
-		       p.sku, p.discount, p.images, p.category_id, p.created_at, p.updated_at,
+		       p.sku, p.discount, p.stock, p.weight, p.gift_card, p.images, p.category_id, p.created_at, p.updated_at,
 		       c.id, c.name, c.alias
 		FROM products p
 		JOIN categories c ON p.category_id = c.id
@@ -34,7 +39,7 @@ func GetProduct(c *fiber.Ctx) error {
 
 	err = database.DB.QueryRow(query, productID).Scan(
 		&product.ID, &product.Name, &product.Price, &product.ShortDescription,
-		&product.LongDescription, &product.SKU, &product.Discount, &product.Images,
+		&product.LongDescription, &product.SKU, &product.Discount, &product.Stock, &product.Weight, &product.GiftCard, &product.Images,
 		&product.CategoryID, &product.CreatedAt, &product.UpdatedAt,
 		&category.ID, &category.Name, &category.Alias,
 	)
@@ -52,6 +57,13 @@ func GetProduct(c *fiber.Ctx) error {
 
 	product.Category = &category
 
+	// Для набора - состав, а также цена и остаток по компонентам
+	if err := applyBundle(&product); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
 	// Получаем отзывы для товара
 	reviewsQuery := `
 		SELECT id, product_id, name, text, rating, created_at
@@ -79,9 +91,12 @@ func GetProduct(c *fiber.Ctx) error {
 		reviews = append(reviews, review)
 	}
 
+	product.Price = convertPrice(product.Price, cur)
+
 	return c.JSON(fiber.Map{
-		"product": product,
-		"reviews": reviews,
+		"product":  product,
+		"reviews":  reviews,
+		"currency": currencyCode(cur),
 	})
 }
 
@@ -106,6 +121,12 @@ func GetProducts(c *fiber.Ctx) error {
 		req.Offset = 0
 	}
 
+	// Цены в ответе и фильтры price_from/price_to - в валюте ?currency=
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
 	// Строим запрос
 	var conditions []string
 	var args []interface{}
@@ -139,12 +160,12 @@ func GetProducts(c *fiber.Ctx) error {
 
 	if req.PriceFrom != nil {
 		conditions = append(conditions, "p.price >= ?")
-		args = append(args, *req.PriceFrom)
+		args = append(args, baseAmount(*req.PriceFrom, cur))
 	}
 
 	if req.PriceTo != nil {
 		conditions = append(conditions, "p.price <= ?")
-		args = append(args, *req.PriceTo)
+		args = append(args, baseAmount(*req.PriceTo, cur))
 	}
 
 	if req.HasDiscount != nil && *req.HasDiscount {
@@ -171,24 +192,30 @@ func GetProducts(c *fiber.Ctx) error {
 	`, whereClause)
 
 	var total int
-	err := database.DB.QueryRow(countQuery, args...).Scan(&total)
+	err = database.DB.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to count products",
 		})
 	}
 
+	// Сортировка: по умолчанию новые товары первыми
+	orderBy := "p.created_at DESC"
+	if req.Sort == "popularity" {
+		orderBy = "p.view_count DESC, p.created_at DESC"
+	}
+
 	// Основной запрос
 	query := fmt.Sprintf(`
 		SELECT p.id, p.name, p.price, p.short_description, p.long_description,
-		       p.sku, p.discount, p.images, p.category_id, p.created_at, p.updated_at,
+		       p.sku, p.discount, p.stock, p.weight, p.gift_card, p.images, p.category_id, p.created_at, p.updated_at,
 		       c.id, c.name, c.alias
 		FROM products p
 		JOIN categories c ON p.category_id = c.id
 		%s
-		ORDER BY p.created_at DESC
+		ORDER BY %s
 		LIMIT ? OFFSET ?
-	`, whereClause)
+	`, whereClause, orderBy)
 
 	args = append(args, req.Limit, req.Offset)
 
@@ -207,7 +234,7 @@ func GetProducts(c *fiber.Ctx) error {
 
 		err := rows.Scan(
 			&product.ID, &product.Name, &product.Price, &product.ShortDescription,
-			&product.LongDescription, &product.SKU, &product.Discount, &product.Images,
+			&product.LongDescription, &product.SKU, &product.Discount, &product.Stock, &product.Weight, &product.GiftCard, &product.Images,
 			&product.CategoryID, &product.CreatedAt, &product.UpdatedAt,
 			&category.ID, &category.Name, &category.Alias,
 		)
@@ -219,11 +246,19 @@ func GetProducts(c *fiber.Ctx) error {
 		products = append(products, product)
 	}
 
+	if err := applyBundles(products); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch products",
+		})
+	}
+	convertProducts(products, cur)
+
 	response := models.ProductListResponse{
 		Products: products,
 		Total:    total,
 		Limit:    req.Limit,
 		Offset:   req.Offset,
+		Currency: currencyCode(cur),
 	}
 
 	return c.JSON(response)
@@ -0,0 +1,623 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/payments"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CancelOrder - отмена заказа покупателем до отправки.
+// Оплаченный заказ возвращается полностью, товары возвращаются на склад.
+func CancelOrder(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	orderID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
+	}
+
+	var ownerID int
+	var status string
+	err = database.DB.QueryRow("SELECT COALESCE(user_id, 0), status FROM orders WHERE id = ?", orderID).Scan(&ownerID, &status)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if status != models.OrderStatusNew && status != models.OrderStatusPaid {
+		return c.Status(400).JSON(fiber.Map{"error": "Order cannot be cancelled in status " + status})
+	}
+
+	var payment *models.Payment
+	if status == models.OrderStatusPaid {
+		payment, err = getOrderSucceededPayment(orderID)
+		if err != nil && err != sql.ErrNoRows {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+	}
+
+	items, err := getOrderItems(orderID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch order items"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	// Сначала занимаем смену статуса: повторная или одновременная отмена получит 409 и не вернёт деньги второй раз
+	result, err := tx.Exec("UPDATE orders SET status = ? WHERE id = ? AND status = ?", models.OrderStatusCancelled, orderID, status)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to cancel order"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Order status has changed"})
+	}
+
+	// Незавершённые платежи закрываются: оплата по старой ссылке не вернёт отменённый заказ
+	if _, err := tx.Exec("UPDATE payments SET status = ?, updated_at = ? WHERE order_id = ? AND status = ?",
+		payments.StatusFailed, time.Now(), orderID, payments.StatusPending); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to cancel order"})
+	}
+
+	for _, item := range items {
+		if err := restockOrderItem(tx, item, item.Quantity); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to restock products"})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to cancel order"})
+	}
+
+	// Оплаченный заказ возвращается полностью. Если провайдер откажет, заказ всё равно отменён,
+	// а платёж остаётся успешным - его возвращают вручную через админку
+	var refundErr error
+	if payment != nil {
+		if refundErr = refundPayment(payment, 0); refundErr != nil {
+			log.Printf("Order %d cancelled but payment %d was not refunded, refund it manually: %v", orderID, payment.ID, refundErr)
+		}
+	}
+
+	syncOrderBalances(orderID)
+	notifyOrderStatus(orderID)
+	emitOrderEvent(models.EventOrderStatusChanged, orderID)
+	dispatchProductAlerts(orderItemProductIDs(items)...)
+
+	if refundErr != nil {
+		return c.Status(502).JSON(fiber.Map{"error": "Order cancelled, but the refund failed and will be completed by support"})
+	}
+
+	order, err := getOrderWithProducts(orderID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch order"})
+	}
+
+	return c.JSON(order)
+}
+
+// CreateReturn - заявка на возврат товаров доставленного заказа
+func CreateReturn(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	orderID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
+	}
+
+	var req models.CreateReturnRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Reason is required"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Items are required"})
+	}
+	for _, photo := range req.Photos {
+		if !strings.HasPrefix(photo, "/images/returns/") {
+			return c.Status(400).JSON(fiber.Map{"error": "Photos must be uploaded via /api/returns/photos"})
+		}
+	}
+
+	var ownerID int
+	var status string
+	err = database.DB.QueryRow("SELECT COALESCE(user_id, 0), status FROM orders WHERE id = ?", orderID).Scan(&ownerID, &status)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if status != models.OrderStatusDelivered {
+		return c.Status(400).JSON(fiber.Map{"error": "Only delivered orders can be returned"})
+	}
+
+	items, err := returnableItems(orderID, req.Items)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	photos := req.Photos
+	if photos == nil {
+		photos = []string{}
+	}
+	photosJSON, _ := json.Marshal(photos)
+	now := time.Now()
+
+	result, err := tx.Exec(`
+		INSERT INTO return_requests (order_id, user_id, reason, photos, status, refund_amount, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+	`, orderID, userID, req.Reason, string(photosJSON), models.ReturnStatusRequested, now, now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create return request"})
+	}
+
+	returnID, _ := result.LastInsertId()
+	for _, item := range items {
+		if _, err := tx.Exec(
+			"INSERT INTO return_items (return_id, product_id, quantity, price) VALUES (?, ?, ?, ?)",
+			returnID, item.ProductID, item.Quantity, item.Price,
+		); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to create return request"})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create return request"})
+	}
+
+	ret, err := getReturnRequest(int(returnID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch return request"})
+	}
+
+	return c.Status(201).JSON(ret)
+}
+
+// GetUserReturns - заявки на возврат текущего пользователя
+func GetUserReturns(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	rows, err := database.DB.Query("SELECT id FROM return_requests WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	returns := []models.ReturnRequest{}
+	for _, id := range ids {
+		ret, err := getReturnRequest(id)
+		if err != nil {
+			continue
+		}
+		returns = append(returns, *ret)
+	}
+
+	return c.JSON(returns)
+}
+
+// UploadReturnPhoto загружает фото для заявки на возврат в images/returns
+func UploadReturnPhoto(c *fiber.Ctx) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file not provided"})
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".webp":
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "unsupported file type"})
+	}
+	if fileHeader.Size > 10<<20 {
+		return c.Status(400).JSON(fiber.Map{"error": "file is too large"})
+	}
+
+	destDir := filepath.Join("images", "returns")
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create dir"})
+	}
+
+	// Имя файла генерируем сами, чтобы не доверять пользовательскому
+	fname := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
+	if err := c.SaveFile(fileHeader, filepath.Join(destDir, fname)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save file"})
+	}
+
+	return c.JSON(fiber.Map{"path": "/images/returns/" + fname})
+}
+
+// returnableItems проверяет позиции заявки по составу заказа с учётом уже поданных возвратов
+// и подставляет цену за единицу из заказа. Ошибки валидации возвращаются как *fiber.Error.
+func returnableItems(orderID int, requested []models.ReturnItem) ([]models.ReturnItem, error) {
+	orderItems, err := getOrderItems(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	available := make(map[int]models.OrderItem)
+	for _, item := range orderItems {
+		available[item.ProductID] = item
+	}
+
+	// Вычитаем товары из активных заявок (кроме отклонённых)
+	rows, err := database.DB.Query(`
+		SELECT ri.product_id, SUM(ri.quantity)
+		FROM return_items ri
+		JOIN return_requests rr ON rr.id = ri.return_id
+		WHERE rr.order_id = ? AND rr.status != ?
+		GROUP BY ri.product_id
+	`, orderID, models.ReturnStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			continue
+		}
+		if item, ok := available[productID]; ok {
+			item.Quantity -= quantity
+			available[productID] = item
+		}
+	}
+
+	merged := make(map[int]int)
+	var order []int
+	for _, item := range requested {
+		if item.Quantity <= 0 {
+			return nil, fiber.NewError(400, "Quantity must be positive")
+		}
+		if _, ok := available[item.ProductID]; !ok {
+			return nil, fiber.NewError(400, fmt.Sprintf("Product %d is not in the order", item.ProductID))
+		}
+		if _, seen := merged[item.ProductID]; !seen {
+			order = append(order, item.ProductID)
+		}
+		merged[item.ProductID] += item.Quantity
+	}
+
+	var items []models.ReturnItem
+	for _, productID := range order {
+		orderItem := available[productID]
+		if merged[productID] > orderItem.Quantity {
+			return nil, fiber.NewError(400, fmt.Sprintf("Too many items of product %d to return", productID))
+		}
+		items = append(items, models.ReturnItem{ProductID: productID, Quantity: merged[productID], Price: orderItem.Price})
+	}
+
+	return items, nil
+}
+
+func getReturnRequest(id int) (*models.ReturnRequest, error) {
+	var ret models.ReturnRequest
+	err := database.DB.QueryRow(`
+		SELECT id, order_id, user_id, reason, COALESCE(photos, '[]'), status, refund_amount, COALESCE(admin_comment, ''), created_at, updated_at
+		FROM return_requests
+		WHERE id = ?
+	`, id).Scan(&ret.ID, &ret.OrderID, &ret.UserID, &ret.Reason, &ret.Photos, &ret.Status,
+		&ret.RefundAmount, &ret.AdminComment, &ret.CreatedAt, &ret.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Items, err = getReturnItems(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func getReturnItems(returnID int) ([]models.ReturnItem, error) {
+	rows, err := database.DB.Query("SELECT product_id, quantity, price FROM return_items WHERE return_id = ? ORDER BY id", returnID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.ReturnItem{}
+	for rows.Next() {
+		var item models.ReturnItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// returnRefundAmount - сумма возврата по позициям заявки за вычетом пропорциональной доли скидки по промокоду.
+// Не превышает невозвращённый остаток по заказу.
+func returnRefundAmount(ret *models.ReturnRequest) (models.Money, error) {
+	var price, couponDiscount, refunded, shipping models.Money
+	err := database.DB.QueryRow(
+		"SELECT price, COALESCE(coupon_discount, 0), COALESCE(refunded_amount, 0), COALESCE(shipping_cost, 0) FROM orders WHERE id = ?",
+		ret.OrderID,
+	).Scan(&price, &couponDiscount, &refunded, &shipping)
+	if err != nil {
+		return 0, err
+	}
+
+	var amount models.Money
+	for _, item := range ret.Items {
+		amount += item.Price.Mul(item.Quantity)
+	}
+
+	// Стоимость товаров до промокода: доставка при возврате части товаров не возвращается
+	if subtotal := price - shipping + couponDiscount; couponDiscount > 0 && subtotal > 0 {
+		// Округление половины вверх, как и в остальных денежных расчётах
+		share := (int64(couponDiscount)*int64(amount)*2 + int64(subtotal)) / (2 * int64(subtotal))
+		amount -= models.Money(share)
+	}
+
+	if remaining := price - refunded; amount > remaining {
+		amount = remaining
+	}
+	if amount < 0 {
+		amount = 0
+	}
+
+	return amount, nil
+}
+
+// returnTransitions - допустимые переходы статусов заявки на возврат
+var returnTransitions = map[string][]string{
+	models.ReturnStatusRequested: {models.ReturnStatusApproved, models.ReturnStatusRejected},
+	models.ReturnStatusApproved:  {models.ReturnStatusReceived, models.ReturnStatusRejected},
+	models.ReturnStatusReceived:  {models.ReturnStatusRefunded},
+}
+
+func canTransitionReturn(from, to string) bool {
+	for _, status := range returnTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper functions for Returns (admin)
+var returnsAdminList = &adminList{
+	from: "return_requests",
+	fields: map[string]adminField{
+		"id":            {"id", fieldInt},
+		"order_id":      {"order_id", fieldInt},
+		"user_id":       {"user_id", fieldInt},
+		"reason":        {"reason", fieldText},
+		"status":        {"status", fieldText},
+		"refund_amount": {"refund_amount", fieldMoney},
+		"admin_comment": {"admin_comment", fieldText},
+		"created_at":    {"created_at", fieldTime},
+		"updated_at":    {"updated_at", fieldTime},
+	},
+	search: []string{"reason", "admin_comment"},
+	sort:   "-created_at",
+}
+
+func getReturnsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, order_id, user_id, reason, COALESCE(photos, '[]'), status, refund_amount, COALESCE(admin_comment, ''), created_at, updated_at`)
+	if err != nil {
+		return nil, err
+	}
+
+	var returns []models.ReturnRequest
+	for rows.Next() {
+		var ret models.ReturnRequest
+		if err := rows.Scan(&ret.ID, &ret.OrderID, &ret.UserID, &ret.Reason, &ret.Photos, &ret.Status,
+			&ret.RefundAmount, &ret.AdminComment, &ret.CreatedAt, &ret.UpdatedAt); err != nil {
+			continue
+		}
+		returns = append(returns, ret)
+	}
+	rows.Close()
+
+	var items []map[string]interface{}
+	for _, ret := range returns {
+		returnItems, _ := getReturnItems(ret.ID)
+		items = append(items, map[string]interface{}{
+			"id":            ret.ID,
+			"order_id":      ret.OrderID,
+			"user_id":       ret.UserID,
+			"reason":        ret.Reason,
+			"photos":        ret.Photos,
+			"status":        ret.Status,
+			"refund_amount": ret.RefundAmount,
+			"admin_comment": ret.AdminComment,
+			"items":         returnItems,
+			"created_at":    ret.CreatedAt.Format(time.RFC3339),
+			"updated_at":    ret.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+// updateReturn меняет статус заявки по допустимым переходам.
+// received - товары возвращаются на склад, refunded - деньги возвращаются покупателю.
+func updateReturn(id int, data map[string]interface{}) error {
+	ret, err := getReturnRequest(id)
+	if err != nil {
+		return err
+	}
+
+	if comment, ok := data["admin_comment"]; ok {
+		if _, err := database.DB.Exec("UPDATE return_requests SET admin_comment = ?, updated_at = ? WHERE id = ?",
+			toString(comment), time.Now(), id); err != nil {
+			return err
+		}
+	}
+
+	status := toString(data["status"])
+	if status == "" || status == ret.Status {
+		return nil
+	}
+	if !canTransitionReturn(ret.Status, status) {
+		return fmt.Errorf("cannot change return status from %s to %s", ret.Status, status)
+	}
+
+	var refundAmount models.Money
+	if status == models.ReturnStatusRefunded {
+		refundAmount, err = returnRefundAmount(ret)
+		if err != nil {
+			return err
+		}
+		if v, ok := data["refund_amount"]; ok {
+			override := toMoney(v)
+			if override < 0 || override > refundAmount {
+				return fmt.Errorf("refund amount must be between 0 and %s", refundAmount)
+			}
+			refundAmount = override
+		}
+	}
+
+	// Наборы возвращаются на склад компонентами из состава заказа
+	orderItems := map[int]models.OrderItem{}
+	if status == models.ReturnStatusReceived {
+		items, err := getOrderItems(ret.OrderID)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			orderItems[item.ProductID] = item
+		}
+	}
+
+	var payment *models.Payment
+	if refundAmount > 0 {
+		payment, err = getOrderSucceededPayment(ret.OrderID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE return_requests SET status = ?, refund_amount = ?, updated_at = ? WHERE id = ? AND status = ?",
+		status, refundAmount, time.Now(), id, ret.Status,
+	)
+	if err != nil {
+		return err
+	}
+	// Смена статуса занимается до возврата денег: одновременное одобрение той же заявки получит 409
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fiber.NewError(409, "Return status has changed")
+	}
+
+	switch status {
+	case models.ReturnStatusReceived:
+		for _, item := range ret.Items {
+			orderItem, ok := orderItems[item.ProductID]
+			if !ok {
+				orderItem = models.OrderItem{ProductID: item.ProductID}
+			}
+			if err := restockOrderItem(tx, orderItem, item.Quantity); err != nil {
+				return err
+			}
+		}
+	case models.ReturnStatusRefunded:
+		if refundAmount > 0 && payment == nil {
+			if err := recordOrderRefund(tx, ret.OrderID, refundAmount); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Если провайдер откажет, заявка возвращается в прежний статус
+	if payment != nil {
+		if err := refundPayment(payment, refundAmount); err != nil {
+			if _, undoErr := database.DB.Exec(
+				"UPDATE return_requests SET status = ?, refund_amount = ?, updated_at = ? WHERE id = ? AND status = ?",
+				ret.Status, ret.RefundAmount, time.Now(), id, status,
+			); undoErr != nil {
+				log.Printf("Failed to restore status of return %d after a failed refund: %v", id, undoErr)
+			}
+			return err
+		}
+	}
+
+	if status == models.ReturnStatusReceived {
+		var restocked []models.OrderItem
+		for _, item := range ret.Items {
+			if orderItem, ok := orderItems[item.ProductID]; ok {
+				restocked = append(restocked, orderItem)
+			} else {
+				restocked = append(restocked, models.OrderItem{ProductID: item.ProductID})
+			}
+		}
+		dispatchProductAlerts(orderItemProductIDs(restocked)...)
+	}
+	return nil
+}
+
+func deleteReturn(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM return_items WHERE return_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM return_requests WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
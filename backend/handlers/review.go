@@ -66,5 +66,7 @@ func CreateReview(c *fiber.Ctx) error {
         return c.Status(500).JSON(fiber.Map{"error": "failed to fetch created review"})
     }
 
+    emitEvent(models.EventReviewCreated, review)
+
     return c.Status(201).JSON(review)
 }
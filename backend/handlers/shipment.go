@@ -0,0 +1,572 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"myAPI/carriers"
+	"myAPI/database"
+	"myAPI/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StartTrackingPoller периодически запрашивает у перевозчиков историю недоставленных отправлений
+func StartTrackingPoller(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := syncActiveShipments(); err != nil {
+				log.Printf("Tracking poller error: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func syncActiveShipments() error {
+	shipments, err := queryShipments("WHERE delivered_at IS NULL ORDER BY id")
+	if err != nil {
+		return err
+	}
+
+	for i := range shipments {
+		if err := syncShipment(&shipments[i]); err != nil {
+			log.Printf("Failed to sync shipment %d: %v", shipments[i].ID, err)
+		}
+	}
+
+	return nil
+}
+
+// syncShipment загружает историю отправления у перевозчика и применяет новые события.
+// Отправления перевозчиков без адаптера ведутся вручную и пропускаются.
+func syncShipment(shipment *models.Shipment) error {
+	carrier, ok := carriers.Get(shipment.Carrier)
+	if !ok {
+		return nil
+	}
+
+	events, err := carrier.Track(shipment.TrackingNumber)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := applyTrackingEvent(shipment, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyTrackingEvent сохраняет событие (повторы игнорируются) и продвигает статус отправления и заказа:
+// отправление в пути - заказ "отправлен", вручено - заказ "доставлен".
+func applyTrackingEvent(shipment *models.Shipment, event carriers.TrackingEvent) error {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO tracking_events (shipment_id, status, description, location, occurred_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, shipment.ID, event.Status, event.Description, event.Location, event.OccurredAt, time.Now()); err != nil {
+		return err
+	}
+
+	if carriers.StatusRank(event.Status) <= carriers.StatusRank(shipment.Status) {
+		return tx.Commit()
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE shipments SET status = ?, updated_at = ? WHERE id = ?", event.Status, now, shipment.ID); err != nil {
+		return err
+	}
+
+	if event.Status != carriers.StatusCreated && shipment.ShippedAt == nil {
+		if _, err := tx.Exec("UPDATE shipments SET shipped_at = ? WHERE id = ?", event.OccurredAt, shipment.ID); err != nil {
+			return err
+		}
+		shipment.ShippedAt = &event.OccurredAt
+	}
+
+	orderChanged := false
+	switch event.Status {
+	case carriers.StatusInTransit, carriers.StatusOutForDelivery:
+		if orderChanged, err = markOrderShipped(tx, shipment.OrderID); err != nil {
+			return err
+		}
+	case carriers.StatusDelivered:
+		if _, err := tx.Exec("UPDATE shipments SET delivered_at = ? WHERE id = ?", event.OccurredAt, shipment.ID); err != nil {
+			return err
+		}
+		shipment.DeliveredAt = &event.OccurredAt
+		if orderChanged, err = markOrderDelivered(tx, shipment.OrderID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	shipment.Status = event.Status
+	if orderChanged {
+		syncOrderBalances(shipment.OrderID)
+		notifyOrderStatus(shipment.OrderID)
+		emitOrderEvent(models.EventOrderStatusChanged, shipment.OrderID)
+	}
+	return nil
+}
+
+// markOrderShipped переводит оплаченный заказ в "отправлен". Неоплаченный заказ статус не меняет:
+// иначе он стал бы доступен для возврата, начисления баллов и выпуска подарочных карт.
+// Возвращает true, если статус заказа изменился.
+func markOrderShipped(db sqlExecer, orderID int) (bool, error) {
+	result, err := db.Exec("UPDATE orders SET status = ? WHERE id = ? AND status = ?",
+		models.OrderStatusShipped, orderID, models.OrderStatusPaid)
+	return statusChanged(result, err)
+}
+
+// markOrderDelivered переводит в "доставлен" оплаченный или отправленный заказ
+func markOrderDelivered(db sqlExecer, orderID int) (bool, error) {
+	result, err := db.Exec("UPDATE orders SET status = ? WHERE id = ? AND status IN (?, ?)",
+		models.OrderStatusDelivered, orderID, models.OrderStatusPaid, models.OrderStatusShipped)
+	return statusChanged(result, err)
+}
+
+func statusChanged(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// AdminAddTrackingEvent - ручное добавление события отслеживания
+func AdminAddTrackingEvent(c *fiber.Ctx) error {
+	shipment, err := shipmentFromParam(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var req models.TrackingEventRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if carriers.StatusRank(req.Status) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Unknown tracking status"})
+	}
+
+	event := carriers.TrackingEvent{
+		Status:      req.Status,
+		Description: strings.TrimSpace(req.Description),
+		Location:    strings.TrimSpace(req.Location),
+	}
+	if req.OccurredAt != nil {
+		event.OccurredAt = *req.OccurredAt
+	}
+
+	if err := applyTrackingEvent(shipment, event); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save tracking event"})
+	}
+
+	return shipmentResponse(c, shipment.ID)
+}
+
+// AdminAdvanceFakeShipment - продвинуть отправление тестового перевозчика на следующий статус
+func AdminAdvanceFakeShipment(c *fiber.Ctx) error {
+	shipment, err := shipmentFromParam(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	fake, ok := fakeCarrier()
+	if !ok || shipment.Carrier != fake.Name() {
+		return c.Status(400).JSON(fiber.Map{"error": "Shipment does not use the fake carrier"})
+	}
+
+	fake.Advance(shipment.TrackingNumber)
+	if err := syncShipment(shipment); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to sync shipment"})
+	}
+
+	return shipmentResponse(c, shipment.ID)
+}
+
+func fakeCarrier() (*carriers.FakeCarrier, bool) {
+	carrier, ok := carriers.Get("fake")
+	if !ok {
+		return nil, false
+	}
+	fake, ok := carrier.(*carriers.FakeCarrier)
+	return fake, ok
+}
+
+func shipmentFromParam(c *fiber.Ctx) (*models.Shipment, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(400, "Invalid shipment ID")
+	}
+
+	shipment, err := getShipment(id)
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(404, "Shipment not found")
+	}
+	return shipment, err
+}
+
+func shipmentResponse(c *fiber.Ctx, id int) error {
+	shipment, err := getShipment(id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch shipment"})
+	}
+	return c.JSON(shipment)
+}
+
+const shipmentColumns = "id, order_id, carrier, tracking_number, status, shipped_at, delivered_at, created_at, updated_at"
+
+func scanShipment(row interface{ Scan(...interface{}) error }, s *models.Shipment) error {
+	var shippedAt, deliveredAt sql.NullTime
+	if err := row.Scan(&s.ID, &s.OrderID, &s.Carrier, &s.TrackingNumber, &s.Status, &shippedAt, &deliveredAt,
+		&s.CreatedAt, &s.UpdatedAt); err != nil {
+		return err
+	}
+	if shippedAt.Valid {
+		s.ShippedAt = &shippedAt.Time
+	}
+	if deliveredAt.Valid {
+		s.DeliveredAt = &deliveredAt.Time
+	}
+	return nil
+}
+
+func getShipment(id int) (*models.Shipment, error) {
+	var s models.Shipment
+	if err := scanShipment(database.DB.QueryRow("SELECT "+shipmentColumns+" FROM shipments WHERE id = ?", id), &s); err != nil {
+		return nil, err
+	}
+
+	events, err := getTrackingEvents(s.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.Events = events
+
+	return &s, nil
+}
+
+// queryShipments - отправления с историей; clause - условия и сортировка после FROM shipments
+func queryShipments(clause string, args ...interface{}) ([]models.Shipment, error) {
+	rows, err := database.DB.Query("SELECT "+shipmentColumns+" FROM shipments "+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var shipments []models.Shipment
+	for rows.Next() {
+		var s models.Shipment
+		if err := scanShipment(rows, &s); err != nil {
+			continue
+		}
+		shipments = append(shipments, s)
+	}
+	rows.Close()
+
+	for i := range shipments {
+		events, err := getTrackingEvents(shipments[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		shipments[i].Events = events
+	}
+
+	return shipments, nil
+}
+
+// getOrderShipments - отправления заказа с историей отслеживания
+func getOrderShipments(orderID int) ([]models.Shipment, error) {
+	return queryShipments("WHERE order_id = ? ORDER BY id", orderID)
+}
+
+func getTrackingEvents(shipmentID int) ([]models.TrackingEvent, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, shipment_id, status, COALESCE(description, ''), COALESCE(location, ''), occurred_at
+		FROM tracking_events
+		WHERE shipment_id = ?
+		ORDER BY occurred_at, id
+	`, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.TrackingEvent{}
+	for rows.Next() {
+		var e models.TrackingEvent
+		if err := rows.Scan(&e.ID, &e.ShipmentID, &e.Status, &e.Description, &e.Location, &e.OccurredAt); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// Helper functions for Shipments (admin)
+var shipmentsAdminList = &adminList{
+	from: "shipments",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"order_id":        {"order_id", fieldInt},
+		"carrier":         {"carrier", fieldText},
+		"tracking_number": {"tracking_number", fieldText},
+		"status":          {"status", fieldText},
+		"shipped_at":      {"shipped_at", fieldTime},
+		"delivered_at":    {"delivered_at", fieldTime},
+		"created_at":      {"created_at", fieldTime},
+		"updated_at":      {"updated_at", fieldTime},
+	},
+	search: []string{"tracking_number", "carrier"},
+	sort:   "id",
+}
+
+func getShipmentsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	shipments, err := queryShipments(q.clause(), q.queryArgs()...)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	for _, s := range shipments {
+		items = append(items, map[string]interface{}{
+			"id":              s.ID,
+			"order_id":        s.OrderID,
+			"carrier":         s.Carrier,
+			"tracking_number": s.TrackingNumber,
+			"status":          s.Status,
+			"shipped_at":      timePtrToString(s.ShippedAt),
+			"delivered_at":    timePtrToString(s.DeliveredAt),
+			"events":          s.Events,
+			"created_at":      s.CreatedAt.Format(time.RFC3339),
+			"updated_at":      s.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+// createShipment регистрирует отправление. Если трек-номер не указан, его выдаёт адаптер перевозчика.
+// Заказ переводится в "отправлен".
+func createShipment(data map[string]interface{}) (int64, error) {
+	orderID := toInt(data["order_id"])
+	carrierName := strings.TrimSpace(toString(data["carrier"]))
+	trackingNumber := strings.TrimSpace(toString(data["tracking_number"]))
+
+	if carrierName == "" {
+		return 0, fiber.NewError(400, "carrier is required")
+	}
+
+	var status string
+	var address *models.AddressFields
+	err := database.DB.QueryRow("SELECT status, delivery_address FROM orders WHERE id = ?", orderID).Scan(&status, &address)
+	if err == sql.ErrNoRows {
+		return 0, fiber.NewError(400, "order not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status == models.OrderStatusCancelled || status == models.OrderStatusRefunded {
+		return 0, fiber.NewError(409, fmt.Sprintf("order in status %s cannot be shipped", status))
+	}
+
+	carrier, registered := carriers.Get(carrierName)
+	if trackingNumber == "" {
+		if !registered {
+			return 0, fiber.NewError(400, "tracking_number is required for carrier "+carrierName)
+		}
+		trackingNumber, err = carrier.CreateShipment(shipmentRequest(orderID, address))
+		if err != nil {
+			return 0, fiber.NewError(502, "carrier error: "+err.Error())
+		}
+	}
+
+	shippedAt := parseNullTimeFromMap(data, "shipped_at")
+	if !shippedAt.Valid {
+		shippedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO shipments (order_id, carrier, tracking_number, status, shipped_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, orderID, carrierName, trackingNumber, carriers.StatusCreated, shippedAt, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	orderChanged, err := markOrderShipped(tx, orderID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if registered {
+		if shipment, err := getShipment(int(id)); err == nil {
+			if err := syncShipment(shipment); err != nil {
+				log.Printf("Failed to sync shipment %d: %v", id, err)
+			}
+		}
+	}
+
+	if orderChanged {
+		syncOrderBalances(orderID)
+		notifyOrderStatus(orderID)
+		emitOrderEvent(models.EventOrderStatusChanged, orderID)
+	}
+
+	return id, nil
+}
+
+func shipmentRequest(orderID int, address *models.AddressFields) carriers.ShipmentRequest {
+	req := carriers.ShipmentRequest{OrderID: orderID}
+	if address != nil {
+		req.Recipient = address.Recipient
+		req.City = address.City
+		req.Address = address.String()
+	}
+	if items, err := getOrderItems(orderID); err == nil {
+		for _, item := range items {
+			var weight int
+			database.DB.QueryRow("SELECT COALESCE(weight, 0) FROM products WHERE id = ?", item.ProductID).Scan(&weight)
+			if weight > 0 {
+				req.Weight += weight * item.Quantity
+				continue
+			}
+			// Набор без собственного веса весит как его компоненты; их количество - уже на всю позицию
+			for _, c := range item.Components {
+				var componentWeight int
+				database.DB.QueryRow("SELECT COALESCE(weight, 0) FROM products WHERE id = ?", c.ProductID).Scan(&componentWeight)
+				req.Weight += componentWeight * c.Quantity
+			}
+		}
+	}
+	return req
+}
+
+// updateShipment - правка перевозчика, трек-номера и дат; указанная дата доставки переводит заказ в "доставлен"
+func updateShipment(id int, data map[string]interface{}) error {
+	shipment, err := getShipment(id)
+	if err != nil {
+		return err
+	}
+
+	carrierName := strings.TrimSpace(toString(data["carrier"]))
+	if carrierName == "" {
+		carrierName = shipment.Carrier
+	}
+	trackingNumber := strings.TrimSpace(toString(data["tracking_number"]))
+	if trackingNumber == "" {
+		trackingNumber = shipment.TrackingNumber
+	}
+	shippedAt := nullTimeFromMap(data, "shipped_at", shipment.ShippedAt)
+	deliveredAt := nullTimeFromMap(data, "delivered_at", shipment.DeliveredAt)
+
+	status := shipment.Status
+	if deliveredAt.Valid {
+		status = carriers.StatusDelivered
+	} else if status == carriers.StatusDelivered {
+		status = carriers.StatusInTransit
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE shipments
+		SET carrier = ?, tracking_number = ?, status = ?, shipped_at = ?, delivered_at = ?, updated_at = ?
+		WHERE id = ?
+	`, carrierName, trackingNumber, status, shippedAt, deliveredAt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	orderChanged := false
+	if deliveredAt.Valid {
+		if orderChanged, err = markOrderDelivered(tx, shipment.OrderID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if orderChanged {
+		syncOrderBalances(shipment.OrderID)
+		notifyOrderStatus(shipment.OrderID)
+		emitOrderEvent(models.EventOrderStatusChanged, shipment.OrderID)
+	}
+	return nil
+}
+
+func deleteShipment(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tracking_events WHERE shipment_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM shipments WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func timePtrToString(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// nullTimeFromMap - как parseNullTimeFromMap, но при отсутствии ключа оставляет текущее значение
+func nullTimeFromMap(data map[string]interface{}, key string, current *time.Time) sql.NullTime {
+	if _, ok := data[key]; !ok && current != nil {
+		return sql.NullTime{Time: *current, Valid: true}
+	}
+	return parseNullTimeFromMap(data, key)
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"myAPI/database"
+	"myAPI/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetShippingMethods - список активных способов доставки
+func GetShippingMethods(c *fiber.Ctx) error {
+	methods, err := getActiveShippingMethods()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch shipping methods"})
+	}
+
+	return c.JSON(methods)
+}
+
+// QuoteShipping - расчёт стоимости доставки набора товаров всеми доступными способами
+func QuoteShipping(c *fiber.Ctx) error {
+	var req models.ShippingQuoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if len(req.ProductIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Product IDs are required"})
+	}
+
+	products, counts, err := loadOrderItems(req.ProductIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch products"})
+	}
+
+	// Порог бесплатной доставки считаем от суммы после скидки по промокоду
+	subtotal := itemsTotal(products, counts)
+	if req.CouponCode != "" {
+		userID, _ := currentUserID(c)
+		coupon, err := evaluateCoupon(req.CouponCode, userID, "", products, counts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		subtotal -= coupon.Discount
+	}
+
+	methods, err := getActiveShippingMethods()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch shipping methods"})
+	}
+
+	weight := orderWeight(products, counts)
+	quotes := []models.ShippingQuote{}
+	for i := range methods {
+		if quote, ok := quoteShippingMethod(&methods[i], subtotal, weight, req.Region); ok {
+			quotes = append(quotes, quote)
+		}
+	}
+
+	return c.JSON(models.ShippingQuoteResponse{
+		Subtotal: subtotal,
+		Weight:   weight,
+		Methods:  quotes,
+	})
+}
+
+// orderWeight - суммарный вес товаров в граммах
+func orderWeight(products []models.Product, counts map[int]int) int {
+	weight := 0
+	for _, p := range products {
+		weight += p.Weight * counts[p.ID]
+	}
+	return weight
+}
+
+// quoteShippingMethod считает стоимость доставки; ok == false, если способ не подходит заказу
+func quoteShippingMethod(method *models.ShippingMethod, subtotal models.Money, weight int, region string) (models.ShippingQuote, bool) {
+	if subtotal < method.MinOrderTotal {
+		return models.ShippingQuote{}, false
+	}
+	if method.MaxWeight > 0 && weight > method.MaxWeight {
+		return models.ShippingQuote{}, false
+	}
+	if len(method.Regions) > 0 && !containsRegion(method.Regions, region) {
+		return models.ShippingQuote{}, false
+	}
+
+	quote := models.ShippingQuote{
+		Method: method.Code,
+		Name:   method.Name,
+		Type:   method.Type,
+	}
+
+	if method.FreeFrom > 0 && subtotal >= method.FreeFrom {
+		quote.Free = true
+		return quote, true
+	}
+
+	// Тариф за каждый начатый килограмм
+	kilograms := (weight + 999) / 1000
+	quote.Cost = method.BaseCost + method.CostPerKg.Mul(kilograms)
+	quote.Free = quote.Cost == 0
+
+	return quote, true
+}
+
+func containsRegion(regions []string, region string) bool {
+	region = strings.TrimSpace(region)
+	for _, r := range regions {
+		if strings.EqualFold(strings.TrimSpace(r), region) {
+			return true
+		}
+	}
+	return false
+}
+
+// shippingForOrder проверяет выбранный при оформлении способ доставки и считает его стоимость.
+// Ошибки валидации возвращаются как *fiber.Error с кодом 400.
+func shippingForOrder(code, region string, products []models.Product, counts map[int]int, subtotal models.Money) (*models.ShippingQuote, error) {
+	method, err := getShippingMethodByCode(code)
+	if err == sql.ErrNoRows || (err == nil && !method.Active) {
+		return nil, fiber.NewError(400, "Unknown shipping method")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	quote, ok := quoteShippingMethod(method, subtotal, orderWeight(products, counts), region)
+	if !ok {
+		return nil, fiber.NewError(400, "Shipping method is not available for this order")
+	}
+
+	return &quote, nil
+}
+
+const shippingMethodColumns = `id, code, name, type, base_cost, cost_per_kg, free_from, min_order_total,
+	       max_weight, COALESCE(regions, '[]'), active, sort_order, created_at`
+
+func scanShippingMethod(row interface{ Scan(...interface{}) error }, m *models.ShippingMethod) error {
+	return row.Scan(&m.ID, &m.Code, &m.Name, &m.Type, &m.BaseCost, &m.CostPerKg, &m.FreeFrom, &m.MinOrderTotal,
+		&m.MaxWeight, &m.Regions, &m.Active, &m.SortOrder, &m.CreatedAt)
+}
+
+func getShippingMethodByCode(code string) (*models.ShippingMethod, error) {
+	var method models.ShippingMethod
+	row := database.DB.QueryRow("SELECT "+shippingMethodColumns+" FROM shipping_methods WHERE code = ?", strings.TrimSpace(code))
+	if err := scanShippingMethod(row, &method); err != nil {
+		return nil, err
+	}
+	return &method, nil
+}
+
+func getActiveShippingMethods() ([]models.ShippingMethod, error) {
+	return queryShippingMethods("WHERE active = 1 ORDER BY sort_order, id")
+}
+
+// queryShippingMethods - способы доставки; clause - условия и сортировка после FROM shipping_methods
+func queryShippingMethods(clause string, args ...interface{}) ([]models.ShippingMethod, error) {
+	rows, err := database.DB.Query("SELECT "+shippingMethodColumns+" FROM shipping_methods "+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	methods := []models.ShippingMethod{}
+	for rows.Next() {
+		var method models.ShippingMethod
+		if err := scanShippingMethod(rows, &method); err != nil {
+			continue
+		}
+		methods = append(methods, method)
+	}
+
+	return methods, nil
+}
+
+// Helper functions for Shipping methods (admin)
+var shippingMethodsAdminList = &adminList{
+	from: "shipping_methods",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"code":            {"code", fieldText},
+		"name":            {"name", fieldText},
+		"type":            {"type", fieldText},
+		"base_cost":       {"base_cost", fieldMoney},
+		"cost_per_kg":     {"cost_per_kg", fieldMoney},
+		"free_from":       {"free_from", fieldMoney},
+		"min_order_total": {"min_order_total", fieldMoney},
+		"max_weight":      {"max_weight", fieldInt},
+		"active":          {"active", fieldBool},
+		"sort_order":      {"sort_order", fieldInt},
+		"created_at":      {"created_at", fieldTime},
+	},
+	search: []string{"code", "name"},
+	sort:   "sort_order,id",
+}
+
+func getShippingMethodsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	methods, err := queryShippingMethods(q.clause(), q.queryArgs()...)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	for _, m := range methods {
+		items = append(items, map[string]interface{}{
+			"id":              m.ID,
+			"code":            m.Code,
+			"name":            m.Name,
+			"type":            m.Type,
+			"base_cost":       m.BaseCost,
+			"cost_per_kg":     m.CostPerKg,
+			"free_from":       m.FreeFrom,
+			"min_order_total": m.MinOrderTotal,
+			"max_weight":      m.MaxWeight,
+			"regions":         m.Regions,
+			"active":          m.Active,
+			"sort_order":      m.SortOrder,
+			"created_at":      m.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+// shippingMethodFromMap переносит в m поля способа доставки из тела админского запроса и проверяет результат.
+// Поля, которых нет в теле, остаются как в m: при обновлении - текущие значения способа.
+func shippingMethodFromMap(m *models.ShippingMethod, data map[string]interface{}) (*models.ShippingMethod, error) {
+	has := func(key string) bool {
+		_, ok := data[key]
+		return ok
+	}
+	if has("code") {
+		m.Code = strings.TrimSpace(toString(data["code"]))
+	}
+	if has("name") {
+		m.Name = toString(data["name"])
+	}
+	if has("type") {
+		m.Type = toString(data["type"])
+	}
+	if has("base_cost") {
+		m.BaseCost = toMoney(data["base_cost"])
+	}
+	if has("cost_per_kg") {
+		m.CostPerKg = toMoney(data["cost_per_kg"])
+	}
+	if has("free_from") {
+		m.FreeFrom = toMoney(data["free_from"])
+	}
+	if has("min_order_total") {
+		m.MinOrderTotal = toMoney(data["min_order_total"])
+	}
+	if has("max_weight") {
+		m.MaxWeight = toInt(data["max_weight"])
+	}
+	if has("regions") {
+		m.Regions = toStringArray(data["regions"])
+	}
+	if has("active") {
+		m.Active = toBool(data["active"], true)
+	}
+	if has("sort_order") {
+		m.SortOrder = toInt(data["sort_order"])
+	}
+
+	if m.Code == "" || m.Name == "" {
+		return nil, fiber.NewError(400, "code and name are required")
+	}
+	switch m.Type {
+	case models.ShippingTypeCourier, models.ShippingTypePickup, models.ShippingTypePost:
+	default:
+		return nil, fiber.NewError(400, "type must be courier, pickup or post")
+	}
+	if m.BaseCost < 0 || m.CostPerKg < 0 || m.FreeFrom < 0 || m.MinOrderTotal < 0 || m.MaxWeight < 0 {
+		return nil, fiber.NewError(400, "costs and limits must not be negative")
+	}
+
+	return m, nil
+}
+
+func createShippingMethod(data map[string]interface{}) (int64, error) {
+	m, err := shippingMethodFromMap(&models.ShippingMethod{Regions: models.StringArray{}, Active: true}, data)
+	if err != nil {
+		return 0, err
+	}
+
+	regionsJSON, _ := json.Marshal(m.Regions)
+	result, err := database.DB.Exec(`
+		INSERT INTO shipping_methods (code, name, type, base_cost, cost_per_kg, free_from, min_order_total, max_weight, regions, active, sort_order, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, m.Code, m.Name, m.Type, m.BaseCost, m.CostPerKg, m.FreeFrom, m.MinOrderTotal, m.MaxWeight, string(regionsJSON), m.Active, m.SortOrder, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func updateShippingMethod(id int, data map[string]interface{}) error {
+	var current models.ShippingMethod
+	row := database.DB.QueryRow("SELECT "+shippingMethodColumns+" FROM shipping_methods WHERE id = ?", id)
+	if err := scanShippingMethod(row, &current); err == sql.ErrNoRows {
+		return fiber.NewError(404, "Shipping method not found")
+	} else if err != nil {
+		return err
+	}
+
+	m, err := shippingMethodFromMap(&current, data)
+	if err != nil {
+		return err
+	}
+
+	regionsJSON, _ := json.Marshal(m.Regions)
+	_, err = database.DB.Exec(`
+		UPDATE shipping_methods
+		SET code = ?, name = ?, type = ?, base_cost = ?, cost_per_kg = ?, free_from = ?, min_order_total = ?,
+		    max_weight = ?, regions = ?, active = ?, sort_order = ?
+		WHERE id = ?
+	`, m.Code, m.Name, m.Type, m.BaseCost, m.CostPerKg, m.FreeFrom, m.MinOrderTotal, m.MaxWeight, string(regionsJSON), m.Active, m.SortOrder, id)
+
+	return err
+}
+
+func deleteShippingMethod(id int) error {
+	_, err := database.DB.Exec("DELETE FROM shipping_methods WHERE id = ?", id)
+	return err
+}
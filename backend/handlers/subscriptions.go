@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"myAPI/alerts"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/notify"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SubscribeToProduct - подписка на поступление товара или снижение цены: {"kind": "back_in_stock" | "price_drop"}.
+// Повторная подписка того же вида возобновляет её: цена для сравнения берётся текущая.
+func SubscribeToProduct(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	productID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var req models.CreateSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	req.Kind = strings.TrimSpace(req.Kind)
+	if req.Kind != models.SubscriptionBackInStock && req.Kind != models.SubscriptionPriceDrop {
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be back_in_stock or price_drop"})
+	}
+
+	products, err := getProductsByIDs(models.IntArray{productID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if len(products) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+	product := products[0]
+
+	if req.Kind == models.SubscriptionBackInStock && inStock(product) {
+		return c.Status(400).JSON(fiber.Map{"error": "Product is in stock"})
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO product_subscriptions (user_id, product_id, kind, price, notified_at, created_at)
+		VALUES (?, ?, ?, ?, NULL, ?)
+		ON CONFLICT(user_id, product_id, kind) DO UPDATE SET price = excluded.price, notified_at = NULL, created_at = excluded.created_at
+	`, userID, productID, req.Kind, product.Price.ApplyDiscount(product.Discount), time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to subscribe"})
+	}
+
+	var sub models.ProductSubscription
+	err = scanSubscription(database.DB.QueryRow(
+		"SELECT "+subscriptionColumns+" FROM product_subscriptions s JOIN products p ON p.id = s.product_id WHERE s.user_id = ? AND s.product_id = ? AND s.kind = ?",
+		userID, productID, req.Kind,
+	), &sub)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.Status(201).JSON(sub)
+}
+
+// GetSubscriptions - подписки пользователя на товары
+func GetSubscriptions(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+subscriptionColumns+" FROM product_subscriptions s JOIN products p ON p.id = s.product_id WHERE s.user_id = ? ORDER BY s.id DESC",
+		userID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	subscriptions := []models.ProductSubscription{}
+	for rows.Next() {
+		var sub models.ProductSubscription
+		if err := scanSubscription(rows, &sub); err != nil {
+			continue
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return c.JSON(subscriptions)
+}
+
+// DeleteSubscription - отписка от уведомлений по товару
+func DeleteSubscription(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid subscription ID"})
+	}
+
+	result, err := database.DB.Exec("DELETE FROM product_subscriptions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete subscription"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Subscription not found"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+const subscriptionColumns = "s.id, s.user_id, s.product_id, p.name, s.kind, s.price, s.notified_at, s.created_at"
+
+func scanSubscription(row interface{ Scan(...interface{}) error }, sub *models.ProductSubscription) error {
+	var notifiedAt sql.NullTime
+	err := row.Scan(&sub.ID, &sub.UserID, &sub.ProductID, &sub.ProductName, &sub.Kind, &sub.Price, &notifiedAt, &sub.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if notifiedAt.Valid {
+		sub.NotifiedAt = &notifiedAt.Time
+	}
+	return nil
+}
+
+// inStock - товар можно купить: остаток не отслеживается или больше нуля
+func inStock(p models.Product) bool {
+	return p.Stock == nil || *p.Stock > 0
+}
+
+// pendingAlert - подписка, по которой нужно отправить уведомление
+type pendingAlert struct {
+	id    int
+	alert alerts.Alert
+}
+
+// dispatchProductAlerts рассылает уведомления подписчикам товаров после изменения остатка, цены или скидки.
+// Вызывается после фиксации транзакции. Наборы, в которые входят товары, проверяются тоже: их остаток
+// и цена зависят от компонентов. Поступление уведомляется один раз, снижение цены - каждый раз,
+// когда цена опускается ниже последней сообщённой. Если канал не смог отправить, подписка не меняется
+// и уведомление повторится при следующем изменении.
+func dispatchProductAlerts(productIDs ...int) {
+	ids, err := withParentBundles(productIDs)
+	if err != nil {
+		log.Printf("Failed to load bundles for alerts: %v", err)
+		return
+	}
+	products, err := getProductsByIDs(ids)
+	if err != nil {
+		log.Printf("Failed to load products for alerts: %v", err)
+		return
+	}
+
+	channel := alerts.Current()
+	for _, p := range products {
+		pending, err := dueAlerts(p)
+		if err != nil {
+			log.Printf("Failed to load subscriptions for product %d: %v", p.ID, err)
+			continue
+		}
+
+		for _, a := range pending {
+			if err := channel.Send(a.alert); err != nil {
+				log.Printf("Failed to send %s alert %d via %s: %v", a.alert.Kind, a.id, channel.Name(), err)
+				continue
+			}
+			if _, err := database.DB.Exec(
+				"UPDATE product_subscriptions SET notified_at = ?, price = ? WHERE id = ?",
+				time.Now(), a.alert.Price, a.id,
+			); err != nil {
+				log.Printf("Failed to mark alert %d as sent: %v", a.id, err)
+			}
+		}
+	}
+}
+
+// dueAlerts - уведомления, которые нужно отправить подписчикам товара в его текущем состоянии
+func dueAlerts(p models.Product) ([]pendingAlert, error) {
+	price := p.Price.ApplyDiscount(p.Discount)
+	available := inStock(p)
+
+	rows, err := database.DB.Query(`
+		SELECT s.id, s.kind, s.price, s.notified_at, u.email, COALESCE(u.name, ''), COALESCE(u.language, '')
+		FROM product_subscriptions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.product_id = ?
+		ORDER BY s.id
+	`, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []pendingAlert
+	for rows.Next() {
+		var id int
+		var kind, email, name, lang string
+		var baseline models.Money
+		var notifiedAt sql.NullTime
+		if err := rows.Scan(&id, &kind, &baseline, &notifiedAt, &email, &name, &lang); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case kind == models.SubscriptionBackInStock && available && !notifiedAt.Valid:
+		case kind == models.SubscriptionPriceDrop && price < baseline:
+		default:
+			continue
+		}
+
+		pending = append(pending, pendingAlert{id: id, alert: alerts.Alert{
+			Kind:        kind,
+			Email:       email,
+			Name:        name,
+			Language:    lang,
+			ProductID:   p.ID,
+			ProductName: p.Name,
+			Price:       price,
+			OldPrice:    baseline,
+			URL:         productURL(p.ID),
+		}})
+	}
+	return pending, rows.Err()
+}
+
+// orderItemProductIDs - товары позиций заказа вместе с компонентами наборов: их остатки меняются при отмене и возврате
+func orderItemProductIDs(items []models.OrderItem) []int {
+	var ids []int
+	for _, item := range items {
+		ids = append(ids, item.ProductID)
+		for _, c := range item.Components {
+			ids = append(ids, c.ProductID)
+		}
+	}
+	return ids
+}
+
+// withParentBundles дополняет список товаров наборами, в которые они входят
+func withParentBundles(productIDs []int) (models.IntArray, error) {
+	seen := map[int]bool{}
+	var ids models.IntArray
+	for _, id := range productIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range productIDs {
+		rows, err := database.DB.Query("SELECT bundle_id FROM bundle_items WHERE product_id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var bundleID int
+			if err := rows.Scan(&bundleID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if !seen[bundleID] {
+				seen[bundleID] = true
+				ids = append(ids, bundleID)
+			}
+		}
+		rows.Close()
+	}
+	return ids, nil
+}
+
+func productURL(productID int) string {
+	return notify.SiteURL() + "/products/" + strconv.Itoa(productID)
+}
+
+// EmailAlertChannel отправляет уведомления подписчикам письмами через общую очередь
+type EmailAlertChannel struct{}
+
+func (EmailAlertChannel) Name() string { return "email" }
+
+func (EmailAlertChannel) Send(a alerts.Alert) error {
+	queueEmail(a.Email, a.Language, notify.TemplateProductAlert, emailData{Name: a.Name, Alert: &a})
+	return nil
+}
+
+// Helper functions for Product subscriptions (admin)
+var productSubscriptionsAdminList = &adminList{
+	from: "product_subscriptions s JOIN products p ON p.id = s.product_id JOIN users u ON u.id = s.user_id",
+	fields: map[string]adminField{
+		"id":           {"s.id", fieldInt},
+		"user_id":      {"s.user_id", fieldInt},
+		"email":        {"u.email", fieldText},
+		"product_id":   {"s.product_id", fieldInt},
+		"product_name": {"p.name", fieldText},
+		"kind":         {"s.kind", fieldText},
+		"price":        {"s.price", fieldMoney},
+		"notified_at":  {"s.notified_at", fieldTime},
+		"created_at":   {"s.created_at", fieldTime},
+	},
+	search: []string{"email", "product_name"},
+	sort:   "-id",
+}
+
+func getProductSubscriptionsForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(subscriptionColumns + ", u.email")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var sub models.ProductSubscription
+		var notifiedAt sql.NullTime
+		var email string
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.ProductID, &sub.ProductName, &sub.Kind, &sub.Price,
+			&notifiedAt, &sub.CreatedAt, &email); err != nil {
+			continue
+		}
+
+		items = append(items, map[string]interface{}{
+			"id":           sub.ID,
+			"user_id":      sub.UserID,
+			"email":        email,
+			"product_id":   sub.ProductID,
+			"product_name": sub.ProductName,
+			"kind":         sub.Kind,
+			"price":        sub.Price,
+			"notified_at":  nullTimeToString(notifiedAt),
+			"created_at":   sub.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+func deleteProductSubscription(id int) error {
+	_, err := database.DB.Exec("DELETE FROM product_subscriptions WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/tax"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// orderTax - налог заказа по позициям и доставке
+type orderTax struct {
+	Config       tax.Config
+	Rates        map[int]int          // ставка по товару
+	Lines        map[int]models.Money // налог по позиции (все единицы товара)
+	ShippingRate int
+	Shipping     models.Money
+	Total        models.Money
+}
+
+// line - ставка и налог позиции; для заказа без расчёта налога - нули
+func (t *orderTax) line(productID int) (int, models.Money) {
+	if t == nil {
+		return 0, 0
+	}
+	return t.Rates[productID], t.Lines[productID]
+}
+
+// categoryTaxRates - ставки категорий, для которых задана своя ставка
+func categoryTaxRates() (map[int]int, error) {
+	rows, err := database.DB.Query("SELECT id, tax_rate FROM categories WHERE tax_rate IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := map[int]int{}
+	for rows.Next() {
+		var id, rate int
+		if err := rows.Scan(&id, &rate); err != nil {
+			return nil, err
+		}
+		rates[id] = rate
+	}
+	return rates, nil
+}
+
+// calculateOrderTax считает налог по каждой позиции и по доставке.
+// Скидки уровня заказа (промокод и баллы) распределяются по позициям пропорционально их сумме,
+// поэтому налог считается с фактически оплачиваемой суммы. Подарочные сертификаты налогом не облагаются:
+// налог возникает при покупке товаров, оплаченных картой.
+func calculateOrderTax(products []models.Product, counts map[int]int, coupon *couponResult, loyaltyDiscount, shippingCost models.Money) (*orderTax, error) {
+	categoryRates, err := categoryTaxRates()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := tax.Current()
+	t := &orderTax{
+		Config:       cfg,
+		Rates:        map[int]int{},
+		Lines:        map[int]models.Money{},
+		ShippingRate: cfg.ShippingRate,
+	}
+
+	bases := map[int]models.Money{}
+	var all, eligible, loyaltyEligible []int
+	for _, p := range products {
+		bases[p.ID] = discountedPrice(p).Mul(counts[p.ID])
+		all = append(all, p.ID)
+		if !p.GiftCard {
+			loyaltyEligible = append(loyaltyEligible, p.ID)
+		}
+		if coupon != nil && couponAppliesTo(&coupon.Coupon, p) {
+			eligible = append(eligible, p.ID)
+		}
+
+		rate, ok := categoryRates[p.CategoryID]
+		if !ok {
+			rate = cfg.DefaultRate
+		}
+		if p.GiftCard {
+			rate = 0
+		}
+		t.Rates[p.ID] = rate
+	}
+
+	if coupon != nil {
+		allocateDiscount(bases, eligible, coupon.Discount)
+	}
+	allocateDiscount(bases, loyaltyEligible, loyaltyDiscount)
+
+	for _, id := range all {
+		t.Lines[id] = cfg.Amount(bases[id], t.Rates[id])
+		t.Total += t.Lines[id]
+	}
+	t.Shipping = cfg.Amount(shippingCost, t.ShippingRate)
+	t.Total += t.Shipping
+
+	return t, nil
+}
+
+// allocateDiscount уменьшает суммы позиций ids на amount пропорционально им;
+// остаток от округления достаётся последней позиции
+func allocateDiscount(bases map[int]models.Money, ids []int, amount models.Money) {
+	var total models.Money
+	for _, id := range ids {
+		total += bases[id]
+	}
+	if amount <= 0 || total <= 0 {
+		return
+	}
+	amount = min(amount, total)
+
+	rest := amount
+	for i, id := range ids {
+		share := rest
+		if i < len(ids)-1 {
+			share = models.Money(int64(amount) * int64(bases[id]) / int64(total))
+		}
+		share = min(share, bases[id])
+		bases[id] -= share
+		rest -= share
+	}
+}
+
+// orderTaxLines группирует налог позиций и доставки по ставкам, старшая ставка первой
+func orderTaxLines(order *models.Order) []models.TaxLine {
+	if order.TaxMode == "" {
+		return nil
+	}
+
+	amounts := map[int]models.Money{}
+	for _, item := range order.Items {
+		amounts[item.TaxRate] += item.TaxAmount
+	}
+	amounts[order.ShippingTaxRate] += order.ShippingTax
+
+	var lines []models.TaxLine
+	for rate, amount := range amounts {
+		if amount > 0 {
+			lines = append(lines, models.TaxLine{Rate: rate, Amount: amount})
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Rate > lines[j].Rate })
+	return lines
+}
+
+// validateTaxRate проверяет ставку категории из админки; пустое значение - ставка по умолчанию
+func validateTaxRate(data map[string]interface{}) error {
+	rate := toNullInt(data["tax_rate"])
+	if rate.Valid && !tax.ValidRate(int(rate.Int64)) {
+		return fiber.NewError(400, "tax_rate must be between 0 and 100")
+	}
+	return nil
+}
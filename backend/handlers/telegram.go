@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/notify"
+	"strings"
+	"time"
+)
+
+// telegramSendInterval - пауза между сообщениями, чтобы не упираться в лимит Bot API (~30 сообщений в секунду)
+const telegramSendInterval = 50 * time.Millisecond
+
+var telegramWake = make(chan struct{}, 1)
+
+// StartTelegramWorker запускает фоновую отправку сообщений сотрудникам в Telegram
+func StartTelegramWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := deliverPendingTelegramMessages(); err != nil {
+				log.Printf("Telegram worker error: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-telegramWake:
+			}
+		}
+	}()
+}
+
+func wakeTelegramWorker() {
+	select {
+	case telegramWake <- struct{}{}:
+	default:
+	}
+}
+
+type queuedTelegramMessage struct {
+	ID       int
+	ChatID   string
+	Text     string
+	Attempts int
+}
+
+func deliverPendingTelegramMessages() error {
+	bot, _, ok := notify.Telegram()
+	if !ok {
+		return nil
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, chat_id, text, attempts FROM telegram_messages
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY id LIMIT 50
+	`, QueueStatusPending, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var messages []queuedTelegramMessage
+	for rows.Next() {
+		var m queuedTelegramMessage
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Text, &m.Attempts); err != nil {
+			continue
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+
+	// Чаты, для которых Bot API попросил подождать: остальные их сообщения откладываем до следующего прохода
+	limited := map[string]time.Time{}
+	for i, m := range messages {
+		if until, ok := limited[m.ChatID]; ok {
+			database.DB.Exec("UPDATE telegram_messages SET next_attempt_at = ? WHERE id = ?", until, m.ID)
+			continue
+		}
+		if i > 0 {
+			time.Sleep(telegramSendInterval)
+		}
+
+		err := bot.SendMessage(m.ChatID, m.Text)
+		if err == nil {
+			database.DB.Exec("UPDATE telegram_messages SET status = ?, attempts = ?, last_error = NULL, sent_at = ? WHERE id = ?",
+				QueueStatusSent, m.Attempts+1, time.Now(), m.ID)
+			continue
+		}
+
+		// Ограничение частоты - не ошибка доставки: попытку не считаем, ждём сколько попросили
+		var rateLimit *notify.RateLimitError
+		if errors.As(err, &rateLimit) {
+			until := time.Now().Add(rateLimit.RetryAfter)
+			limited[m.ChatID] = until
+			database.DB.Exec("UPDATE telegram_messages SET last_error = ?, next_attempt_at = ? WHERE id = ?", err.Error(), until, m.ID)
+			time.AfterFunc(rateLimit.RetryAfter, wakeTelegramWorker)
+			continue
+		}
+
+		log.Printf("Failed to send Telegram message %d to chat %s: %v", m.ID, m.ChatID, err)
+		attempts := m.Attempts + 1
+		status := QueueStatusPending
+		if attempts >= maxDeliveryAttempts {
+			status = QueueStatusFailed
+		}
+		database.DB.Exec("UPDATE telegram_messages SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+			status, attempts, err.Error(), time.Now().Add(retryDelay(attempts)), m.ID)
+	}
+
+	return nil
+}
+
+// queueStaffMessage ставит сообщение в очередь для каждого чата сотрудников
+func queueStaffMessage(text string) {
+	_, chats, ok := notify.Telegram()
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	for _, chatID := range chats {
+		_, err := database.DB.Exec(`
+			INSERT INTO telegram_messages (chat_id, text, status, attempts, next_attempt_at, created_at)
+			VALUES (?, ?, ?, 0, ?, ?)
+		`, chatID, text, QueueStatusPending, now, now)
+		if err != nil {
+			log.Printf("Failed to queue Telegram message to chat %s: %v", chatID, err)
+		}
+	}
+
+	wakeTelegramWorker()
+}
+
+// notifyStaffOrderCreated - сообщение сотрудникам о новом заказе
+func notifyStaffOrderCreated(orderID int) {
+	notifyStaff(orderID, "🛒 Новый заказ №%d")
+}
+
+// notifyStaffOrderPaid - сообщение сотрудникам об оплате заказа
+func notifyStaffOrderPaid(orderID int) {
+	notifyStaff(orderID, "✅ Заказ №%d оплачен")
+}
+
+func notifyStaff(orderID int, title string) {
+	if _, _, ok := notify.Telegram(); !ok {
+		return
+	}
+
+	order, err := getOrderWithProducts(orderID)
+	if err != nil {
+		log.Printf("Failed to load order %d for Telegram: %v", orderID, err)
+		return
+	}
+
+	queueStaffMessage(staffOrderSummary(order, fmt.Sprintf(title, order.ID)))
+}
+
+// staffOrderSummary - краткая сводка заказа для сотрудников со ссылкой в админку
+func staffOrderSummary(order *models.Order, title string) string {
+	var b strings.Builder
+	b.WriteString(title + "\n\n")
+
+	label, fields := "Покупатель", []string{order.GuestName, order.GuestPhone, order.GuestEmail}
+	if order.User != nil {
+		fields = []string{order.User.Name, order.User.Phone, order.User.Email}
+	} else {
+		label = "Покупатель (без регистрации)"
+	}
+	contacts := []string{}
+	for _, v := range fields {
+		if v != "" {
+			contacts = append(contacts, v)
+		}
+	}
+	if len(contacts) > 0 {
+		b.WriteString(label + ": " + strings.Join(contacts, ", ") + "\n")
+	}
+	if order.Address != nil {
+		b.WriteString("Адрес: " + order.Address.String() + "\n")
+	}
+
+	b.WriteString("\n")
+	for _, item := range order.Items {
+		fmt.Fprintf(&b, "• %s × %d — %s ₽\n", item.Name, item.Quantity, item.Price.Mul(item.Quantity))
+	}
+	if order.CouponCode != "" {
+		fmt.Fprintf(&b, "Промокод %s: −%s ₽\n", order.CouponCode, order.CouponDiscount)
+	}
+	if order.LoyaltyPoints > 0 {
+		fmt.Fprintf(&b, "Баллы (%d): −%s ₽\n", order.LoyaltyPoints, order.LoyaltyDiscount)
+	}
+	if order.ShippingMethod != "" {
+		name := order.ShippingMethod
+		if method, err := getShippingMethodByCode(order.ShippingMethod); err == nil {
+			name = method.Name
+		}
+		fmt.Fprintf(&b, "Доставка (%s): %s ₽\n", name, order.ShippingCost)
+	}
+	if order.GiftCardAmount > 0 {
+		fmt.Fprintf(&b, "Подарочная карта: −%s ₽\n", order.GiftCardAmount)
+	}
+	fmt.Fprintf(&b, "Итого: %s ₽\n", order.Price)
+
+	if adminURL := notify.AdminURL(); adminURL != "" {
+		fmt.Fprintf(&b, "\n%s/orders/%d", adminURL, order.ID)
+	}
+
+	return b.String()
+}
+
+// Helper functions for Telegram messages (admin)
+var telegramMessagesAdminList = &adminList{
+	from: "telegram_messages",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"chat_id":         {"chat_id", fieldText},
+		"text":            {"text", fieldText},
+		"status":          {"status", fieldText},
+		"attempts":        {"attempts", fieldInt},
+		"next_attempt_at": {"next_attempt_at", fieldTime},
+		"sent_at":         {"sent_at", fieldTime},
+		"created_at":      {"created_at", fieldTime},
+	},
+	search: []string{"text", "chat_id"},
+	sort:   "-id",
+}
+
+func getTelegramMessagesForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, chat_id, text, status, attempts, COALESCE(last_error, ''), next_attempt_at, sent_at, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, attempts int
+		var chatID, text, status, lastError string
+		var nextAttemptAt, createdAt time.Time
+		var sentAt sql.NullTime
+
+		if err := rows.Scan(&id, &chatID, &text, &status, &attempts, &lastError, &nextAttemptAt, &sentAt, &createdAt); err != nil {
+			continue
+		}
+
+		items = append(items, map[string]interface{}{
+			"id":              id,
+			"chat_id":         chatID,
+			"text":            text,
+			"status":          status,
+			"attempts":        attempts,
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt.Format(time.RFC3339),
+			"sent_at":         nullTimeToString(sentAt),
+			"created_at":      createdAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+func deleteTelegramMessage(id int) error {
+	_, err := database.DB.Exec("DELETE FROM telegram_messages WHERE id = ?", id)
+	return err
+}
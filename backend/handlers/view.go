@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"myAPI/database"
+	"myAPI/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// viewCountWindow - повторные просмотры товара одним пользователем или посетителем в пределах окна
+// не увеличивают счётчик просмотров (обновление страницы не накручивает популярность)
+const viewCountWindow = 30 * time.Minute
+
+// visitorID возвращает идентификатор анонимного посетителя из заголовка или query
+func visitorID(c *fiber.Ctx) string {
+	if v := c.Get("X-Visitor-ID"); v != "" {
+		return v
+	}
+	return c.Query("visitor_id")
+}
+
+// RecordProductView - фиксирует просмотр товара авторизованным пользователем или анонимным посетителем
+func RecordProductView(c *fiber.Ctx) error {
+	productID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var body struct {
+		VisitorID string `json:"visitor_id"`
+	}
+	// Тело необязательно: visitor_id можно передать заголовком X-Visitor-ID
+	_ = c.BodyParser(&body)
+
+	visitor := body.VisitorID
+	if visitor == "" {
+		visitor = visitorID(c)
+	}
+
+	var userID sql.NullInt64
+	if id, ok := currentUserID(c); ok {
+		userID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	if !userID.Valid && visitor == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Authorization or visitor_id is required"})
+	}
+
+	var exists int
+	err = database.DB.QueryRow("SELECT id FROM products WHERE id = ?", productID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	// Недавний просмотр того же товара тем же пользователем (или посетителем без авторизации)
+	viewer, viewerArg := "visitor_id = ?", interface{}(visitor)
+	if userID.Valid {
+		viewer, viewerArg = "user_id = ?", userID
+	}
+	var recent int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM product_views WHERE product_id = ? AND "+viewer+" AND julianday(created_at) > julianday(?)",
+		productID, viewerArg, time.Now().Add(-viewCountWindow),
+	).Scan(&recent)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record view"})
+	}
+
+	// Строка просмотра пишется всегда: по ней упорядочены недавно просмотренные товары
+	if _, err := tx.Exec(
+		"INSERT INTO product_views (product_id, user_id, visitor_id, created_at) VALUES (?, ?, ?, ?)",
+		productID, userID, visitor, time.Now(),
+	); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record view"})
+	}
+
+	if recent == 0 {
+		if _, err := tx.Exec("UPDATE products SET view_count = COALESCE(view_count, 0) + 1 WHERE id = ?", productID); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to record view"})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record view"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// GetRecentlyViewed - последние просмотренные товары (без повторов) с актуальными ценами (поддерживает ?currency=)
+func GetRecentlyViewed(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 10)
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	query := `
+		SELECT product_id
+		FROM product_views
+		WHERE %s
+		GROUP BY product_id
+		ORDER BY MAX(id) DESC
+		LIMIT ?
+	`
+
+	var rows *sql.Rows
+	if userID, ok := currentUserID(c); ok {
+		rows, err = database.DB.Query(fmt.Sprintf(query, "user_id = ?"), userID, limit)
+	} else if visitor := visitorID(c); visitor != "" {
+		rows, err = database.DB.Query(fmt.Sprintf(query, "visitor_id = ?"), visitor, limit)
+	} else {
+		return c.Status(400).JSON(fiber.Map{"error": "Authorization or visitor_id is required"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch recently viewed"})
+	}
+	defer rows.Close()
+
+	var ids models.IntArray
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	products, err := getProductsByIDs(ids)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch products"})
+	}
+	convertProducts(products, cur)
+
+	// getProductsByIDs не сохраняет порядок, восстанавливаем порядок просмотров
+	byID := make(map[int]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	result := make([]models.Product, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			result = append(result, p)
+		}
+	}
+
+	return c.JSON(fiber.Map{"products": result, "currency": currencyCode(cur)})
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/webhooks"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxWebhookAttempts - после стольких неудачных попыток доставка помечается как failed
+// (с экспоненциальной задержкой это около четырёх часов)
+const maxWebhookAttempts = 8
+
+var (
+	webhookClient = webhooks.NewClient()
+	webhookWake   = make(chan struct{}, 1)
+)
+
+// StartWebhookWorker запускает фоновую доставку вебхуков
+func StartWebhookWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := deliverPendingWebhooks(); err != nil {
+				log.Printf("Webhook worker error: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-webhookWake:
+			}
+		}
+	}()
+}
+
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+type queuedWebhookDelivery struct {
+	ID       int
+	Event    string
+	Payload  string
+	Attempts int
+	URL      string
+	Secret   string
+	Active   bool
+}
+
+func deliverPendingWebhooks() error {
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.event, d.payload, d.attempts, COALESCE(w.url, ''), COALESCE(w.secret, ''), COALESCE(w.active, 0)
+		FROM webhook_deliveries d
+		LEFT JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.id LIMIT 50
+	`, QueueStatusPending, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var deliveries []queuedWebhookDelivery
+	for rows.Next() {
+		var d queuedWebhookDelivery
+		if err := rows.Scan(&d.ID, &d.Event, &d.Payload, &d.Attempts, &d.URL, &d.Secret, &d.Active); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+
+	for _, d := range deliveries {
+		// Подписку удалили или выключили - доставку не повторяем
+		if d.URL == "" || !d.Active {
+			database.DB.Exec("UPDATE webhook_deliveries SET status = ?, last_error = ? WHERE id = ?",
+				QueueStatusFailed, "webhook is disabled", d.ID)
+			continue
+		}
+
+		attempts := d.Attempts + 1
+		resp, err := webhookClient.Deliver(d.URL, d.Secret, d.Event, d.ID, []byte(d.Payload))
+		if err == nil && resp.OK() {
+			database.DB.Exec(`
+				UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, response_body = ?, last_error = NULL, delivered_at = ?
+				WHERE id = ?
+			`, QueueStatusSent, attempts, resp.StatusCode, resp.Body, time.Now(), d.ID)
+			continue
+		}
+
+		var code sql.NullInt64
+		var body sql.NullString
+		if err == nil {
+			code = sql.NullInt64{Int64: int64(resp.StatusCode), Valid: true}
+			body = sql.NullString{String: resp.Body, Valid: true}
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+
+		log.Printf("Failed to deliver webhook %d (%s) to %s: %v", d.ID, d.Event, d.URL, err)
+		status := QueueStatusPending
+		if attempts >= maxWebhookAttempts {
+			status = QueueStatusFailed
+		}
+		database.DB.Exec(`
+			UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, response_body = ?, last_error = ?, next_attempt_at = ?
+			WHERE id = ?
+		`, status, attempts, code, body, err.Error(), time.Now().Add(retryDelay(attempts)), d.ID)
+	}
+
+	return nil
+}
+
+// emitEvent ставит событие в очередь доставки для всех активных подписок на него.
+// Как и уведомления, ошибки только логируются и не ломают основную операцию.
+func emitEvent(event string, data interface{}) {
+	rows, err := database.DB.Query("SELECT id, events FROM webhooks WHERE active = 1")
+	if err != nil {
+		log.Printf("Failed to load webhooks for %s: %v", event, err)
+		return
+	}
+
+	var webhookIDs []int
+	for rows.Next() {
+		var id int
+		var eventsJSON string
+		if err := rows.Scan(&id, &eventsJSON); err != nil {
+			continue
+		}
+		var events []string
+		json.Unmarshal([]byte(eventsJSON), &events)
+		if webhookSubscribed(events, event) {
+			webhookIDs = append(webhookIDs, id)
+		}
+	}
+	rows.Close()
+
+	if len(webhookIDs) == 0 {
+		return
+	}
+
+	eventID, err := randomHex(16)
+	if err != nil {
+		log.Printf("Failed to generate event ID: %v", err)
+		return
+	}
+	now := time.Now()
+	payload, err := json.Marshal(models.WebhookPayload{ID: eventID, Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		log.Printf("Failed to encode %s payload: %v", event, err)
+		return
+	}
+
+	for _, id := range webhookIDs {
+		_, err := database.DB.Exec(`
+			INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, 0, ?, ?)
+		`, id, event, string(payload), QueueStatusPending, now, now)
+		if err != nil {
+			log.Printf("Failed to queue webhook %d for %s: %v", id, event, err)
+		}
+	}
+
+	wakeWebhookWorker()
+}
+
+func webhookSubscribed(events []string, event string) bool {
+	for _, e := range events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func emitOrderEvent(event string, orderID int) {
+	order, err := getOrderWithProducts(orderID)
+	if err != nil {
+		log.Printf("Failed to load order %d for webhook: %v", orderID, err)
+		return
+	}
+	emitEvent(event, order)
+}
+
+func emitProductEvent(event string, productID int) {
+	products, err := getProductsByIDs(models.IntArray{productID})
+	if err != nil || len(products) == 0 {
+		log.Printf("Failed to load product %d for webhook: %v", productID, err)
+		return
+	}
+	emitEvent(event, products[0])
+}
+
+func emitUserEvent(event string, userID int) {
+	var user models.User
+	err := database.DB.QueryRow(`
+		SELECT id, email, COALESCE(role, 'user'), COALESCE(name, ''), COALESCE(phone, ''), COALESCE(delivery_address, ''), created_at, updated_at
+		FROM users WHERE id = ?
+	`, userID).Scan(&user.ID, &user.Email, &user.Role, &user.Name, &user.Phone, &user.DeliveryAddress, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		log.Printf("Failed to load user %d for webhook: %v", userID, err)
+		return
+	}
+	emitEvent(event, user)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AdminRedeliverWebhook - повторная отправка доставки: создаётся новая доставка с тем же телом
+func AdminRedeliverWebhook(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid delivery ID"})
+	}
+
+	now := time.Now()
+	result, err := database.DB.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, next_attempt_at, created_at)
+		SELECT webhook_id, event, payload, ?, 0, ?, ? FROM webhook_deliveries WHERE id = ?
+	`, QueueStatusPending, now, now, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Delivery not found"})
+	}
+
+	deliveryID, _ := result.LastInsertId()
+	wakeWebhookWorker()
+	return c.Status(201).JSON(fiber.Map{"id": deliveryID})
+}
+
+// Helper functions for Webhooks (admin)
+var webhooksAdminList = &adminList{
+	from: "webhooks",
+	fields: map[string]adminField{
+		"id":          {"id", fieldInt},
+		"url":         {"url", fieldText},
+		"events":      {"events", fieldText},
+		"description": {"description", fieldText},
+		"active":      {"active", fieldBool},
+		"created_at":  {"created_at", fieldTime},
+		"updated_at":  {"updated_at", fieldTime},
+	},
+	search: []string{"url", "description"},
+	sort:   "id",
+}
+
+func getWebhooksForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, url, secret, events, COALESCE(description, ''), active, created_at, updated_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id int
+		var webhookURL, secret, eventsJSON, description string
+		var active bool
+		var createdAt, updatedAt time.Time
+
+		if err := rows.Scan(&id, &webhookURL, &secret, &eventsJSON, &description, &active, &createdAt, &updatedAt); err != nil {
+			continue
+		}
+
+		events := []string{}
+		json.Unmarshal([]byte(eventsJSON), &events)
+
+		items = append(items, map[string]interface{}{
+			"id":          id,
+			"url":         webhookURL,
+			"secret":      secret,
+			"events":      events,
+			"description": description,
+			"active":      active,
+			"created_at":  createdAt.Format(time.RFC3339),
+			"updated_at":  updatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+// webhookFromMap разбирает и проверяет адрес и события подписки из тела админского запроса
+func webhookFromMap(data map[string]interface{}) (string, []string, error) {
+	webhookURL := strings.TrimSpace(toString(data["url"]))
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", nil, fiber.NewError(400, "url must be an absolute http(s) URL")
+	}
+
+	events := toStringArray(data["events"])
+	if len(events) == 0 {
+		return "", nil, fiber.NewError(400, "at least one event is required")
+	}
+	for _, e := range events {
+		if e != "*" && !isWebhookEvent(e) {
+			return "", nil, fiber.NewError(400, fmt.Sprintf("unknown event %q", e))
+		}
+	}
+
+	return webhookURL, events, nil
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range models.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// createWebhook - без секрета в запросе он генерируется и возвращается в ответе
+func createWebhook(data map[string]interface{}) (int64, error) {
+	webhookURL, events, err := webhookFromMap(data)
+	if err != nil {
+		return 0, err
+	}
+
+	secret := strings.TrimSpace(toString(data["secret"]))
+	if secret == "" {
+		if secret, err = randomHex(32); err != nil {
+			return 0, err
+		}
+		data["secret"] = secret
+	}
+
+	eventsJSON, _ := json.Marshal(events)
+	result, err := database.DB.Exec(`
+		INSERT INTO webhooks (url, secret, events, description, active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, webhookURL, secret, string(eventsJSON), toString(data["description"]), toBool(data["active"], true), time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// updateWebhook - пустой секрет оставляет прежний
+func updateWebhook(id int, data map[string]interface{}) error {
+	webhookURL, events, err := webhookFromMap(data)
+	if err != nil {
+		return err
+	}
+
+	eventsJSON, _ := json.Marshal(events)
+	_, err = database.DB.Exec(`
+		UPDATE webhooks
+		SET url = ?, secret = COALESCE(NULLIF(?, ''), secret), events = ?, description = ?, active = ?, updated_at = ?
+		WHERE id = ?
+	`, webhookURL, strings.TrimSpace(toString(data["secret"])), string(eventsJSON), toString(data["description"]), toBool(data["active"], true), time.Now(), id)
+
+	return err
+}
+
+func deleteWebhook(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Helper functions for Webhook deliveries (admin)
+var webhookDeliveriesAdminList = &adminList{
+	from: "webhook_deliveries",
+	fields: map[string]adminField{
+		"id":              {"id", fieldInt},
+		"webhook_id":      {"webhook_id", fieldInt},
+		"event":           {"event", fieldText},
+		"status":          {"status", fieldText},
+		"attempts":        {"attempts", fieldInt},
+		"response_code":   {"response_code", fieldInt},
+		"last_error":      {"last_error", fieldText},
+		"next_attempt_at": {"next_attempt_at", fieldTime},
+		"delivered_at":    {"delivered_at", fieldTime},
+		"created_at":      {"created_at", fieldTime},
+	},
+	search: []string{"event", "last_error"},
+	sort:   "-id",
+}
+
+func getWebhookDeliveriesForAdmin(q *adminListQuery) ([]map[string]interface{}, error) {
+	rows, err := q.query(`id, webhook_id, event, payload, status, attempts, response_code, COALESCE(response_body, ''), COALESCE(last_error, ''),
+		next_attempt_at, delivered_at, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, webhookID, attempts int
+		var event, payload, status, responseBody, lastError string
+		var responseCode sql.NullInt64
+		var nextAttemptAt, createdAt time.Time
+		var deliveredAt sql.NullTime
+
+		if err := rows.Scan(&id, &webhookID, &event, &payload, &status, &attempts, &responseCode, &responseBody, &lastError,
+			&nextAttemptAt, &deliveredAt, &createdAt); err != nil {
+			continue
+		}
+
+		var code interface{}
+		if responseCode.Valid {
+			code = responseCode.Int64
+		}
+
+		items = append(items, map[string]interface{}{
+			"id":              id,
+			"webhook_id":      webhookID,
+			"event":           event,
+			"payload":         json.RawMessage(payload),
+			"status":          status,
+			"attempts":        attempts,
+			"response_code":   code,
+			"response_body":   responseBody,
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt.Format(time.RFC3339),
+			"delivered_at":    nullTimeToString(deliveredAt),
+			"created_at":      createdAt.Format(time.RFC3339),
+		})
+	}
+
+	return items, nil
+}
+
+func deleteWebhookDelivery(id int) error {
+	_, err := database.DB.Exec("DELETE FROM webhook_deliveries WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"database/sql"
+	"myAPI/database"
+	"myAPI/models"
+	"myAPI/notify"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Ограничения списков желаний
+const (
+	maxWishlistNameLength = 100
+	maxWishlistNoteLength = 500
+)
+
+// GetWishlists - списки желаний пользователя с количеством товаров
+func GetWishlists(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+wishlistColumns+`
+		FROM wishlists w WHERE w.user_id = ? ORDER BY w.id
+	`, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	wishlists := []models.Wishlist{}
+	for rows.Next() {
+		var w models.Wishlist
+		if err := scanWishlist(rows, &w); err != nil {
+			continue
+		}
+		wishlists = append(wishlists, w)
+	}
+
+	return c.JSON(wishlists)
+}
+
+// CreateWishlist - новый список желаний: {"name": "День рождения"}
+func CreateWishlist(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var req models.WishlistRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	name, err := wishlistName(req.Name)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	now := time.Now()
+	result, err := database.DB.Exec(
+		"INSERT INTO wishlists (user_id, name, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		userID, name, now, now,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create wishlist"})
+	}
+	id, _ := result.LastInsertId()
+
+	wishlist, err := getUserWishlist(userID, int(id))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.Status(201).JSON(wishlist)
+}
+
+// GetWishlist - список желаний пользователя с товарами (поддерживает ?currency=)
+func GetWishlist(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid wishlist ID"})
+	}
+
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	wishlist, err := getUserWishlist(userID, id)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := loadWishlistItems(wishlist, cur); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch wishlist items"})
+	}
+
+	return c.JSON(fiber.Map{"wishlist": wishlist, "currency": currencyCode(cur)})
+}
+
+// UpdateWishlist - переименование списка
+func UpdateWishlist(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid wishlist ID"})
+	}
+
+	var req models.WishlistRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	name, err := wishlistName(req.Name)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE wishlists SET name = ?, updated_at = ? WHERE id = ? AND user_id = ?",
+		name, time.Now(), id, userID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update wishlist"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	}
+
+	wishlist, err := getUserWishlist(userID, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(wishlist)
+}
+
+// DeleteWishlist удаляет список вместе с товарами в нём; публичная ссылка перестаёт работать
+func DeleteWishlist(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid wishlist ID"})
+	}
+
+	result, err := database.DB.Exec("DELETE FROM wishlists WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete wishlist"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// AddWishlistItem добавляет товар в список: {"product_id": 1, "note": "размер 17"}.
+// Если товар уже в списке, меняется только заметка (когда она передана).
+func AddWishlistItem(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid wishlist ID"})
+	}
+
+	var req models.WishlistItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.ProductID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "product_id is required"})
+	}
+	var note sql.NullString
+	if req.Note != nil {
+		note.String, note.Valid = strings.TrimSpace(*req.Note), true
+		if utf8.RuneCountInString(note.String) > maxWishlistNoteLength {
+			return c.Status(400).JSON(fiber.Map{"error": "Note is too long"})
+		}
+	}
+
+	if _, err := getUserWishlist(userID, id); err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	var exists int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM products WHERE id = ?", req.ProductID).Scan(&exists); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if exists == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO wishlist_items (wishlist_id, product_id, note, added_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(wishlist_id, product_id) DO UPDATE SET note = COALESCE(excluded.note, wishlist_items.note)
+	`, id, req.ProductID, note, now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add item"})
+	}
+	if err := touchWishlist(tx, id, now); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add item"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add item"})
+	}
+
+	var item models.WishlistItem
+	err = database.DB.QueryRow(
+		"SELECT product_id, COALESCE(note, ''), added_at FROM wishlist_items WHERE wishlist_id = ? AND product_id = ?",
+		id, req.ProductID,
+	).Scan(&item.ProductID, &item.Note, &item.AddedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.Status(201).JSON(item)
+}
+
+// RemoveWishlistItem убирает товар из списка
+func RemoveWishlistItem(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid wishlist ID"})
+	}
+	productID, err := strconv.Atoi(c.Params("productId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	if _, err := getUserWishlist(userID, id); err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM wishlist_items WHERE wishlist_id = ? AND product_id = ?", id, productID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove item"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+	}
+	if err := touchWishlist(tx, id, time.Now()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove item"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove item"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// ShareWishlist публикует список и возвращает ссылку на него; повторный вызов отдаёт ту же ссылку
+func ShareWishlist(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid wishlist ID"})
+	}
+
+	token, err := randomHex(16)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to share wishlist"})
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE wishlists SET share_token = COALESCE(share_token, ?), updated_at = ? WHERE id = ? AND user_id = ?",
+		token, time.Now(), id, userID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to share wishlist"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	}
+
+	wishlist, err := getUserWishlist(userID, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(wishlist)
+}
+
+// UnshareWishlist закрывает доступ по ссылке; при следующей публикации ссылка будет новой
+func UnshareWishlist(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid wishlist ID"})
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE wishlists SET share_token = NULL, updated_at = ? WHERE id = ? AND user_id = ?",
+		time.Now(), id, userID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to unshare wishlist"})
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// GetSharedWishlist - опубликованный список по токену из ссылки, только для чтения и без входа.
+// Владелец списка не раскрывается.
+func GetSharedWishlist(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if token == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	}
+
+	cur, err := requestCurrency(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var wishlist models.Wishlist
+	err = scanWishlist(database.DB.QueryRow(
+		"SELECT "+wishlistColumns+" FROM wishlists w WHERE w.share_token = ?", token,
+	), &wishlist)
+	if err == sql.ErrNoRows {
+		return c.Status(404).JSON(fiber.Map{"error": "Wishlist not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := loadWishlistItems(&wishlist, cur); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch wishlist items"})
+	}
+
+	return c.JSON(fiber.Map{"wishlist": wishlist, "currency": currencyCode(cur)})
+}
+
+const wishlistColumns = `w.id, w.name, COALESCE(w.share_token, ''),
+	(SELECT COUNT(*) FROM wishlist_items i WHERE i.wishlist_id = w.id), w.created_at, w.updated_at`
+
+func scanWishlist(row interface{ Scan(...interface{}) error }, w *models.Wishlist) error {
+	var token string
+	if err := row.Scan(&w.ID, &w.Name, &token, &w.ItemsCount, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return err
+	}
+	if token != "" {
+		w.ShareURL = sharedWishlistURL(token)
+	}
+	return nil
+}
+
+// getUserWishlist - список пользователя без товаров; sql.ErrNoRows, если списка нет или он чужой
+func getUserWishlist(userID, id int) (*models.Wishlist, error) {
+	var w models.Wishlist
+	err := scanWishlist(database.DB.QueryRow(
+		"SELECT "+wishlistColumns+" FROM wishlists w WHERE w.id = ? AND w.user_id = ?", id, userID,
+	), &w)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// loadWishlistItems дополняет список товарами с актуальными ценами и остатками, последние добавленные - первыми
+func loadWishlistItems(w *models.Wishlist, cur *models.Currency) error {
+	rows, err := database.DB.Query(`
+		SELECT product_id, COALESCE(note, ''), added_at FROM wishlist_items
+		WHERE wishlist_id = ? ORDER BY added_at DESC, product_id
+	`, w.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var items []models.WishlistItem
+	var ids models.IntArray
+	for rows.Next() {
+		var item models.WishlistItem
+		if err := rows.Scan(&item.ProductID, &item.Note, &item.AddedAt); err != nil {
+			return err
+		}
+		items = append(items, item)
+		ids = append(ids, item.ProductID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	products, err := getProductsByIDs(ids)
+	if err != nil {
+		return err
+	}
+	convertProducts(products, cur)
+	byID := make(map[int]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	w.Items = []models.WishlistItem{}
+	for _, item := range items {
+		if p, ok := byID[item.ProductID]; ok {
+			item.Product = &p
+			w.Items = append(w.Items, item)
+		}
+	}
+	w.ItemsCount = len(w.Items)
+	return nil
+}
+
+// wishlistName проверяет название списка; ошибка - *fiber.Error с кодом 400
+func wishlistName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fiber.NewError(400, "Name is required")
+	}
+	if utf8.RuneCountInString(name) > maxWishlistNameLength {
+		return "", fiber.NewError(400, "Name is too long")
+	}
+	return name, nil
+}
+
+func touchWishlist(tx *sql.Tx, id int, now time.Time) error {
+	_, err := tx.Exec("UPDATE wishlists SET updated_at = ? WHERE id = ?", now, id)
+	return err
+}
+
+func sharedWishlistURL(token string) string {
+	return notify.SiteURL() + "/wishlists/shared/" + token
+}
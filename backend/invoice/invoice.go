@@ -0,0 +1,293 @@
+package invoice
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"myAPI/models"
+	"myAPI/tax"
+	"os"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Шрифты DejaVu встроены в бинарник: стандартные шрифты PDF не содержат кириллицы
+var (
+	//go:embed fonts/DejaVuSans.ttf
+	fontRegular []byte
+	//go:embed fonts/DejaVuSans-Bold.ttf
+	fontBold []byte
+)
+
+const fontFamily = "DejaVu"
+
+// Seller - реквизиты магазина в шапке счёта
+type Seller struct {
+	Name    string
+	INN     string
+	Address string
+	Phone   string
+	Email   string
+}
+
+// SellerFromEnv читает реквизиты магазина из переменных окружения STORE_*
+func SellerFromEnv() Seller {
+	return Seller{
+		Name:    envOr("STORE_NAME", "Интернет-магазин"),
+		INN:     os.Getenv("STORE_INN"),
+		Address: os.Getenv("STORE_ADDRESS"),
+		Phone:   os.Getenv("STORE_PHONE"),
+		Email:   os.Getenv("STORE_EMAIL"),
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Customer - данные покупателя
+type Customer struct {
+	Name    string
+	Email   string
+	Phone   string
+	Address string
+}
+
+// Line - позиция счёта: Price - цена за единицу со скидкой товара, ListPrice - без скидки
+type Line struct {
+	Name      string
+	Quantity  int
+	ListPrice models.Money
+	Price     models.Money
+	TaxRate   int
+}
+
+// Document - данные для формирования счёта.
+// Number == 0 означает, что заказ ещё не оплачен и номер счёта не присвоен.
+type Document struct {
+	Number          int
+	IssuedAt        time.Time
+	OrderID         int
+	OrderDate       time.Time
+	Status          string
+	Seller          Seller
+	Customer        Customer
+	Lines           []Line
+	CouponCode      string
+	CouponDiscount  models.Money
+	LoyaltyPoints   int
+	LoyaltyDiscount models.Money
+	GiftCardAmount  models.Money
+	TaxMode         string // пусто - налог по заказу не рассчитывался
+	Taxes           []models.TaxLine
+	ShippingName    string
+	ShippingCost    models.Money
+	Total           models.Money
+	Refunded        models.Money
+}
+
+// FormatNumber форматирует сквозной номер счёта: 42 -> "000042"
+func FormatNumber(number int) string {
+	return fmt.Sprintf("%06d", number)
+}
+
+// Render формирует PDF-счёт и записывает его в w
+func Render(w io.Writer, doc Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(fontFamily, "", fontRegular)
+	pdf.AddUTF8FontFromBytes(fontFamily, "B", fontBold)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetCreator(doc.Seller.Name, true)
+
+	title := "Счёт на оплату заказа № " + fmt.Sprint(doc.OrderID)
+	if doc.Number > 0 {
+		title = "Счёт № " + FormatNumber(doc.Number) + " от " + doc.IssuedAt.Format("02.01.2006")
+	}
+	pdf.SetTitle(title, true)
+	pdf.AddPage()
+
+	// Продавец
+	pdf.SetFont(fontFamily, "B", 14)
+	pdf.CellFormat(0, 7, doc.Seller.Name, "", 1, "L", false, 0, "")
+	pdf.SetFont(fontFamily, "", 9)
+	for _, line := range []string{
+		labeled("ИНН", doc.Seller.INN),
+		doc.Seller.Address,
+		labeled("Тел.", doc.Seller.Phone),
+		labeled("E-mail", doc.Seller.Email),
+	} {
+		if line != "" {
+			pdf.CellFormat(0, 5, line, "", 1, "L", false, 0, "")
+		}
+	}
+	pdf.Ln(6)
+
+	// Заголовок
+	pdf.SetFont(fontFamily, "B", 16)
+	pdf.CellFormat(0, 9, title, "", 1, "L", false, 0, "")
+	pdf.SetFont(fontFamily, "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("Заказ № %d от %s, статус: %s", doc.OrderID, doc.OrderDate.Format("02.01.2006"), doc.Status), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	// Покупатель
+	pdf.SetFont(fontFamily, "B", 11)
+	pdf.CellFormat(0, 6, "Покупатель", "", 1, "L", false, 0, "")
+	pdf.SetFont(fontFamily, "", 10)
+	for _, line := range []string{
+		doc.Customer.Name,
+		labeled("E-mail", doc.Customer.Email),
+		labeled("Тел.", doc.Customer.Phone),
+		labeled("Адрес доставки", doc.Customer.Address),
+	} {
+		if line != "" {
+			pdf.MultiCell(0, 5, line, "", "L", false)
+		}
+	}
+	pdf.Ln(4)
+
+	// Позиции
+	widths := []float64{10, 50, 14, 28, 26, 22, 30}
+	headers := []string{"№", "Товар", "Кол-во", "Цена", "Скидка", "НДС", "Сумма"}
+	pdf.SetFont(fontFamily, "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	for i, h := range headers {
+		pdf.CellFormat(widths[i], 7, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont(fontFamily, "", 9)
+	var subtotal models.Money
+	for i, line := range doc.Lines {
+		sum := line.Price.Mul(line.Quantity)
+		discount := (line.ListPrice - line.Price).Mul(line.Quantity)
+		subtotal += sum
+
+		names := pdf.SplitText(line.Name, widths[1]-2)
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		height := 5 * float64(len(names))
+		if pdf.GetY()+height > 282 {
+			pdf.AddPage()
+		}
+
+		x, y := pdf.GetX(), pdf.GetY()
+		pdf.CellFormat(widths[0], height, fmt.Sprint(i+1), "1", 0, "C", false, 0, "")
+		pdf.Rect(x+widths[0], y, widths[1], height, "D")
+		for j, name := range names {
+			pdf.SetXY(x+widths[0], y+5*float64(j))
+			pdf.CellFormat(widths[1], 5, name, "", 0, "L", false, 0, "")
+		}
+		pdf.SetXY(x+widths[0]+widths[1], y)
+		pdf.CellFormat(widths[2], height, fmt.Sprint(line.Quantity), "1", 0, "C", false, 0, "")
+		pdf.CellFormat(widths[3], height, formatMoney(line.ListPrice), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], height, discountCell(discount), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[5], height, taxRateCell(doc.TaxMode, line.TaxRate), "1", 0, "C", false, 0, "")
+		pdf.CellFormat(widths[6], height, formatMoney(sum), "1", 1, "R", false, 0, "")
+	}
+	pdf.Ln(3)
+
+	// Итоги
+	labelWidth := widths[0] + widths[1] + widths[2] + widths[3] + widths[4]
+	amountWidth := widths[5] + widths[6]
+	total := func(label string, amount models.Money, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont(fontFamily, style, 10)
+		pdf.CellFormat(labelWidth, 6, label, "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountWidth, 6, formatMoney(amount), "", 1, "R", false, 0, "")
+	}
+
+	total("Товары:", subtotal, false)
+	if doc.CouponDiscount > 0 {
+		total(fmt.Sprintf("Скидка по промокоду %s:", doc.CouponCode), -doc.CouponDiscount, false)
+	}
+	if doc.LoyaltyDiscount > 0 {
+		total(fmt.Sprintf("Оплачено баллами (%d):", doc.LoyaltyPoints), -doc.LoyaltyDiscount, false)
+	}
+	if doc.ShippingName != "" || doc.ShippingCost > 0 {
+		label := "Доставка:"
+		if doc.ShippingName != "" {
+			label = fmt.Sprintf("Доставка (%s):", doc.ShippingName)
+		}
+		total(label, doc.ShippingCost, false)
+	}
+	// Налог сверх цен входит в итог отдельными строками, включённый в цены - показывается справочно
+	inclusive := doc.TaxMode != tax.ModeExclusive
+	if !inclusive {
+		for _, t := range doc.Taxes {
+			total(fmt.Sprintf("НДС %d%%:", t.Rate), t.Amount, false)
+		}
+	}
+	if doc.GiftCardAmount > 0 {
+		total("Оплачено подарочной картой:", -doc.GiftCardAmount, false)
+	}
+	total("Итого:", doc.Total, true)
+	if inclusive {
+		for _, t := range doc.Taxes {
+			total(fmt.Sprintf("В т.ч. НДС %d%%:", t.Rate), t.Amount, false)
+		}
+	}
+	if doc.Refunded > 0 {
+		total("Возвращено:", -doc.Refunded, false)
+	}
+
+	pdf.Ln(6)
+	pdf.SetFont(fontFamily, "", 9)
+	if doc.Number > 0 {
+		pdf.CellFormat(0, 5, "Оплачено "+doc.IssuedAt.Format("02.01.2006 15:04")+". Спасибо за покупку!", "", 1, "L", false, 0, "")
+	} else if doc.Status == models.OrderStatusNew {
+		pdf.CellFormat(0, 5, "Заказ ожидает оплаты. Номер счёта будет присвоен после оплаты.", "", 1, "L", false, 0, "")
+	}
+
+	return pdf.Output(w)
+}
+
+func taxRateCell(mode string, rate int) string {
+	if mode == "" {
+		return "—"
+	}
+	if rate == 0 {
+		return "без НДС"
+	}
+	return fmt.Sprintf("%d%%", rate)
+}
+
+func labeled(label, value string) string {
+	if value == "" {
+		return ""
+	}
+	return label + ": " + value
+}
+
+// formatMoney - сумма в рублях с разделителем тысяч: 12 345,50 руб.
+func formatMoney(m models.Money) string {
+	s := m.String()
+	sign := ""
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+
+	rubles, kopecks := s[:len(s)-3], s[len(s)-2:]
+	grouped := ""
+	for len(rubles) > 3 {
+		grouped = " " + rubles[len(rubles)-3:] + grouped
+		rubles = rubles[:len(rubles)-3]
+	}
+
+	return sign + rubles + grouped + "," + kopecks + " руб."
+}
+
+func discountCell(discount models.Money) string {
+	if discount <= 0 {
+		return "—"
+	}
+	return formatMoney(discount)
+}
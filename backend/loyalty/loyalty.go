@@ -0,0 +1,91 @@
+package loyalty
+
+import (
+	"myAPI/models"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PointValue - стоимость одного балла при оплате заказа (1 балл = 1 рубль)
+const PointValue = models.Money(100)
+
+// Типы записей в журнале баллов
+const (
+	TypeEarn         = "earn"          // начисление за оплаченный заказ
+	TypeEarnReversal = "earn_reversal" // списание начисленного при возврате или отмене
+	TypeSpend        = "spend"         // оплата части заказа баллами
+	TypeSpendReturn  = "spend_return"  // возврат потраченных баллов при отмене заказа
+	TypeExpire       = "expire"        // сгорание по сроку
+	TypeAdjust       = "adjust"        // ручная корректировка администратором
+)
+
+// Config - правила программы лояльности
+type Config struct {
+	EarnPercent     int           // процент от оплаченной суммы заказа, начисляемый баллами
+	MaxSpendPercent int           // какую долю суммы товаров можно оплатить баллами
+	TTL             time.Duration // срок жизни начисленных баллов
+}
+
+// DefaultConfig - 5% баллами, оплата баллами до половины заказа, баллы живут год
+var DefaultConfig = Config{EarnPercent: 5, MaxSpendPercent: 50, TTL: 365 * 24 * time.Hour}
+
+var (
+	mu     sync.RWMutex
+	config = DefaultConfig
+)
+
+// ConfigFromEnv читает LOYALTY_EARN_PERCENT, LOYALTY_MAX_SPEND_PERCENT и LOYALTY_TTL_DAYS;
+// незаданные или некорректные значения берутся из DefaultConfig
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig
+	if v, err := strconv.Atoi(os.Getenv("LOYALTY_EARN_PERCENT")); err == nil && v >= 0 && v <= 100 {
+		cfg.EarnPercent = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("LOYALTY_MAX_SPEND_PERCENT")); err == nil && v >= 0 && v <= 100 {
+		cfg.MaxSpendPercent = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("LOYALTY_TTL_DAYS")); err == nil && v > 0 {
+		cfg.TTL = time.Duration(v) * 24 * time.Hour
+	}
+	return cfg
+}
+
+func Configure(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+}
+
+func Current() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return config
+}
+
+// EarnedPoints - баллы за оплаченную сумму, с округлением вниз до целого балла
+func (c Config) EarnedPoints(paid models.Money) int {
+	if paid <= 0 {
+		return 0
+	}
+	return int(int64(paid) * int64(c.EarnPercent) / 100 / int64(PointValue))
+}
+
+// MaxSpendPoints - сколько баллов можно потратить на заказ с суммой товаров total
+func (c Config) MaxSpendPoints(total models.Money) int {
+	if total <= 0 {
+		return 0
+	}
+	return int(int64(total) * int64(c.MaxSpendPercent) / 100 / int64(PointValue))
+}
+
+// Value - скидка в деньгах за указанное число баллов
+func Value(points int) models.Money {
+	return PointValue.Mul(points)
+}
+
+// ExpiresAt - срок сгорания баллов, начисленных в момент now
+func (c Config) ExpiresAt(now time.Time) time.Time {
+	return now.Add(c.TTL)
+}
@@ -2,10 +2,20 @@ package main
 
 import (
 	"log"
+	"myAPI/alerts"
+	"myAPI/carriers"
 	"myAPI/database"
 	"myAPI/handlers"
+	"myAPI/loyalty"
+	"myAPI/notify"
+	"myAPI/payments"
+	"myAPI/tax"
 	"myAPI/utils"
+	"net"
 	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // база часовых поясов для TZ: в alpine-образе её нет
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -28,8 +38,90 @@ func main() {
 	if needSeed {
 		database.SeedData()
 	}
+	// Платёжные провайдеры: локальный тестовый шлюз подключается только явно (PAYMENT_FAKE_ENABLED=true),
+	// его страница позволяет покупателю самому отметить заказ оплаченным
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:3000"
+	}
+	if os.Getenv("PAYMENT_FAKE_ENABLED") == "true" {
+		fakeSecret := os.Getenv("PAYMENT_FAKE_SECRET")
+		if fakeSecret == "" {
+			log.Fatal("PAYMENT_FAKE_SECRET is required when PAYMENT_FAKE_ENABLED=true")
+		}
+		payments.Register(payments.NewFakeProvider(fakeSecret, publicURL))
+		log.Println("Fake payment provider enabled")
+	}
+
+	// Службы доставки: тестовый перевозчик и фоновое обновление статусов отправлений
+	carriers.Register(carriers.NewFakeCarrier())
+	handlers.StartTrackingPoller(5 * time.Minute)
+
+	// Письма покупателям: SMTP при заданном SMTP_HOST, иначе файлы .eml в MAIL_DIR
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "shop@localhost"
+	}
+	siteURL := os.Getenv("SITE_URL")
+	if siteURL == "" {
+		siteURL = publicURL
+	}
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "25"
+		}
+		notify.Configure(notify.NewSMTPSender(net.JoinHostPort(smtpHost, smtpPort), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom), siteURL)
+	} else {
+		mailDir := os.Getenv("MAIL_DIR")
+		if mailDir == "" {
+			mailDir = "mail"
+		}
+		notify.Configure(notify.NewFileSender(mailDir, mailFrom), siteURL)
+	}
+	handlers.StartEmailWorker(time.Minute)
+
+	// Уведомления подписчикам о поступлении товара и снижении цены: в журнал сервера или письмами (ALERTS_CHANNEL=email)
+	if os.Getenv("ALERTS_CHANNEL") == "email" {
+		alerts.Configure(handlers.EmailAlertChannel{})
+	}
+
+	// Уведомления сотрудникам в Telegram о новых и оплаченных заказах (чаты через запятую)
+	if botToken, chats := os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_CHAT_IDS"); botToken != "" && chats != "" {
+		adminURL := os.Getenv("ADMIN_URL")
+		if adminURL == "" {
+			adminURL = siteURL + "/admin"
+		}
+		var chatIDs []string
+		for _, id := range strings.Split(chats, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				chatIDs = append(chatIDs, id)
+			}
+		}
+		notify.ConfigureTelegram(notify.NewTelegramBot(os.Getenv("TELEGRAM_API_URL"), botToken), chatIDs, adminURL)
+	}
+	handlers.StartTelegramWorker(time.Minute)
+
+	// Доставка исходящих вебхуков (подписки настраиваются в админке)
+	handlers.StartWebhookWorker(time.Minute)
+
+	// Фоновое применение запланированных цен и скидок
+	handlers.StartPriceScheduler(time.Minute)
+
+	// Налоги: режим цен и ставка по умолчанию из TAX_*, ставки категорий - в админке
+	tax.Configure(tax.ConfigFromEnv())
+
+	// Программа лояльности: правила из LOYALTY_* и фоновое сгорание просроченных баллов
+	loyalty.Configure(loyalty.ConfigFromEnv())
+	handlers.StartLoyaltyWorker(time.Hour)
+
 	// Создание Fiber приложения
 	app := fiber.New(fiber.Config{
+		// API работает за nginx: настоящий адрес клиента (для лимитов попыток) - в X-Real-IP,
+		// но только если запрос пришёл от доверенного прокси, иначе заголовок можно подделать
+		ProxyHeader:             "X-Real-IP",
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          utils.TrustedProxies(),
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -44,9 +136,10 @@ func main() {
 	// Middleware
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,HEAD,PUT,DELETE,PATCH",
+		ExposeHeaders: "Idempotent-Replayed",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-Visitor-ID, X-Order-Token, Idempotency-Key",
 	}))
 
 	// Статические файлы для изображений
@@ -59,12 +152,31 @@ func main() {
 	auth := api.Group("/auth")
 	auth.Post("/register", handlers.Register)
 	auth.Post("/login", handlers.Login)
+	auth.Post("/password/forgot", handlers.ForgotPassword)                                      // Письмо со ссылкой для сброса пароля
+	auth.Post("/password/reset", handlers.ResetPassword)                                        // Новый пароль по токену из письма
+	auth.Post("/email/verify", handlers.VerifyEmail)                                            // Подтверждение email и привязка гостевых заказов
+	auth.Post("/email/verify-request", utils.AuthMiddleware, handlers.RequestEmailVerification) // Повторная ссылка для подтверждения
 
 	// Товары
 	products := api.Group("/products")
 	products.Get("/", handlers.GetProducts)
 	products.Get("/:id", handlers.GetProduct)
 	products.Post(":id/reviews", handlers.CreateReview)
+	products.Get("/:id/price-history", handlers.GetPriceHistory)                           // История цены и минимальная цена за 30 дней
+	products.Post("/:id/view", utils.OptionalAuthMiddleware, handlers.RecordProductView)   // Фиксация просмотра товара
+	products.Post("/:id/subscriptions", utils.AuthMiddleware, handlers.SubscribeToProduct) // Подписка на поступление или снижение цены
+
+	// Личный кабинет
+	me := api.Group("/me")
+	me.Get("/recently-viewed", utils.OptionalAuthMiddleware, handlers.GetRecentlyViewed) // Недавно просмотренные товары
+	me.Get("/addresses", utils.AuthMiddleware, handlers.GetAddresses)                    // Адресная книга
+	me.Post("/addresses", utils.AuthMiddleware, handlers.CreateAddress)
+	me.Put("/addresses/:id", utils.AuthMiddleware, handlers.UpdateAddress)
+	me.Delete("/addresses/:id", utils.AuthMiddleware, handlers.DeleteAddress)
+	me.Post("/addresses/:id/default", utils.AuthMiddleware, handlers.MakeDefaultAddress) // Адрес по умолчанию
+	me.Get("/loyalty", utils.AuthMiddleware, handlers.GetLoyalty)                        // Баланс и история баллов
+	me.Get("/subscriptions", utils.AuthMiddleware, handlers.GetSubscriptions)            // Подписки на товары
+	me.Delete("/subscriptions/:id", utils.AuthMiddleware, handlers.DeleteSubscription)
 
 	// Категории
 	categories := api.Group("/categories")
@@ -78,6 +190,9 @@ func main() {
 	news := api.Group("/news")
 	news.Get("/", handlers.GetNews)
 
+	// Валюты для отображения цен
+	api.Get("/currencies", handlers.GetCurrencies)
+
 	// Админ-панель (требует авторизацию и роль admin)
 	admin := api.Group("/admin", utils.AuthMiddleware, utils.AdminMiddleware)
 	admin.Post("/backup", handlers.AdminBackup)
@@ -85,7 +200,17 @@ func main() {
 	admin.Post("/restore", handlers.AdminRestoreBackup)
 	admin.Post("/products", handlers.AdminCreateProduct)
 	admin.Post("/upload/:kind", handlers.AdminUploadFile)
-	
+	admin.Post("/payments/:id/refund", utils.IdempotencyMiddleware, handlers.AdminRefundPayment)
+	admin.Post("/shipments/:id/events", handlers.AdminAddTrackingEvent)             // Ручное событие отслеживания
+	admin.Post("/shipments/:id/fake-advance", handlers.AdminAdvanceFakeShipment)    // Следующий статус у тестового перевозчика
+	admin.Post("/emails/:id/retry", handlers.AdminRetryEmail)                       // Повторная отправка письма из очереди
+	admin.Post("/webhook_deliveries/:id/redeliver", handlers.AdminRedeliverWebhook) // Повторная доставка вебхука
+	admin.Post("/users/:id/loyalty", handlers.AdminAdjustLoyalty)                   // Ручная корректировка баллов
+	admin.Post("/gift_cards", handlers.AdminIssueGiftCard)                          // Выпуск подарочной карты
+	admin.Get("/gift_cards/:id", handlers.AdminGetGiftCard)                         // Карта с историей операций
+	admin.Post("/gift_cards/:id/void", handlers.AdminVoidGiftCard)                  // Аннулирование карты
+	admin.Post("/currencies/import", handlers.AdminImportCurrencyRates)             // Загрузка курсов валют из CSV
+
 	// Generic admin CRUD endpoints for all resources
 	admin.Get("/:resource", handlers.AdminGetResource)           // GET /api/admin/{resource}
 	admin.Post("/:resource", handlers.AdminCreateResource)       // POST /api/admin/{resource}
@@ -94,21 +219,64 @@ func main() {
 
 	// Заказы
 	orders := api.Group("/orders")
-	orders.Post("/", handlers.CreateOrder)                               // Создание заказа с регистрацией
-	orders.Post("/auth", utils.AuthMiddleware, handlers.CreateOrderAuth) // Создание заказа для авторизованного пользователя
-	orders.Get("/", utils.AuthMiddleware, handlers.GetUserOrders)        // Получение заказов пользователя
+	orders.Post("/", utils.IdempotencyMiddleware, handlers.CreateOrder)                                             // Создание заказа с регистрацией или гостевого заказа
+	orders.Post("/auth", utils.AuthMiddleware, utils.IdempotencyMiddleware, handlers.CreateOrderAuth)               // Создание заказа для авторизованного пользователя
+	orders.Get("/lookup", utils.FailedAttemptsLimiter(10, 15*time.Minute), handlers.LookupOrder)                    // Заказ по ссылке или номеру и email без входа
+	orders.Get("/", utils.AuthMiddleware, handlers.GetUserOrders)                                                   // Получение заказов пользователя
+	orders.Post("/:id/pay", utils.OptionalAuthMiddleware, utils.IdempotencyMiddleware, handlers.CreateOrderPayment) // Оплата заказа (гостевого - по токену)
+	orders.Post("/:id/cancel", utils.AuthMiddleware, utils.IdempotencyMiddleware, handlers.CancelOrder)             // Отмена заказа покупателем
+	orders.Post("/:id/returns", utils.AuthMiddleware, utils.IdempotencyMiddleware, handlers.CreateReturn)           // Заявка на возврат
+	orders.Get("/:id/invoice.pdf", utils.OptionalAuthMiddleware, handlers.GetOrderInvoice)                          // PDF-счёт (владелец, администратор или токен гостевого заказа)
+
+	// Возвраты
+	returns := api.Group("/returns", utils.AuthMiddleware)
+	returns.Get("/", handlers.GetUserReturns)           // Заявки на возврат пользователя
+	returns.Post("/photos", handlers.UploadReturnPhoto) // Загрузка фото для заявки
+
+	// Платежи
+	paymentsGroup := api.Group("/payments")
+	paymentsGroup.Post("/webhook/:provider", handlers.PaymentWebhook) // Уведомления платёжных провайдеров
+	paymentsGroup.Get("/fake/:id", handlers.FakePaymentPage)          // Страница тестового шлюза
+	paymentsGroup.Post("/fake/:id", handlers.FakePaymentConfirm)
+
+	// Доставка
+	shipping := api.Group("/shipping")
+	shipping.Get("/methods", handlers.GetShippingMethods)                         // Способы доставки
+	shipping.Post("/quote", utils.OptionalAuthMiddleware, handlers.QuoteShipping) // Расчёт стоимости доставки
+
+	// Подарочные карты
+	giftCards := api.Group("/gift-cards")
+	// Сначала лимит на клиента: его отказы не расходуют общий лимит, который сдерживает перебор с многих адресов
+	giftCards.Get("/:code",
+		utils.FailedAttemptsLimiter(10, 15*time.Minute),
+		utils.GlobalFailedAttemptsLimiter(200, 15*time.Minute),
+		handlers.CheckGiftCard) // Баланс карты по коду
 
 	// Корзина
 	cart := api.Group("/cart")
-	cart.Post("/", handlers.AddToCart)           // Добавить товар в корзину
-	cart.Get("/", handlers.GetCart)              // Получить корзину пользователя
-	cart.Delete("/", handlers.RemoveFromCart)    // Удалить товар из корзины
+	cart.Post("/", handlers.AddToCart)                                             // Добавить товар в корзину
+	cart.Get("/", handlers.GetCart)                                                // Получить корзину пользователя
+	cart.Delete("/", handlers.RemoveFromCart)                                      // Удалить товар из корзины
+	cart.Post("/apply-coupon", utils.OptionalAuthMiddleware, handlers.ApplyCoupon) // Предпросмотр скидки по промокоду
 
 	// Избранное (favorites)
 	favorites := api.Group("/favorites")
 	favorites.Post("/", handlers.SaveFavorites)
 	favorites.Get("/", handlers.GetFavorites)
 
+	// Списки желаний
+	wishlists := api.Group("/wishlists")
+	wishlists.Get("/shared/:token", handlers.GetSharedWishlist) // Опубликованный список по ссылке, без входа
+	wishlists.Get("/", utils.AuthMiddleware, handlers.GetWishlists)
+	wishlists.Post("/", utils.AuthMiddleware, handlers.CreateWishlist)
+	wishlists.Get("/:id", utils.AuthMiddleware, handlers.GetWishlist)
+	wishlists.Put("/:id", utils.AuthMiddleware, handlers.UpdateWishlist)
+	wishlists.Delete("/:id", utils.AuthMiddleware, handlers.DeleteWishlist)
+	wishlists.Post("/:id/items", utils.AuthMiddleware, handlers.AddWishlistItem) // Добавить товар или изменить заметку
+	wishlists.Delete("/:id/items/:productId", utils.AuthMiddleware, handlers.RemoveWishlistItem)
+	wishlists.Post("/:id/share", utils.AuthMiddleware, handlers.ShareWishlist) // Публичная ссылка
+	wishlists.Delete("/:id/share", utils.AuthMiddleware, handlers.UnshareWishlist)
+
 	// Запуск сервера
 	log.Println("Server starting on :3000")
 	log.Fatal(app.Listen(":3000"))
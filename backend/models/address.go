@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// AddressFields - поля адреса доставки. В заказе хранится их снимок (JSON),
+// который не меняется при редактировании адресной книги.
+type AddressFields struct {
+	Recipient string `json:"recipient" db:"recipient"`
+	Phone     string `json:"phone" db:"phone"`
+	City      string `json:"city" db:"city"`
+	Street    string `json:"street" db:"street"`
+	Building  string `json:"building" db:"building"`
+	Apartment string `json:"apartment,omitempty" db:"apartment"`
+	Postcode  string `json:"postcode,omitempty" db:"postcode"`
+	Comment   string `json:"comment,omitempty" db:"comment"`
+}
+
+func (a *AddressFields) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	default:
+		return errors.New("cannot scan into AddressFields")
+	}
+}
+
+func (a AddressFields) Value() (driver.Value, error) {
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+// String - адрес одной строкой: "123456, Москва, Тверская, д. 1, кв. 2"
+func (a AddressFields) String() string {
+	var parts []string
+	for _, p := range []string{a.Postcode, a.City, a.Street} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if b := strings.TrimSpace(a.Building); b != "" {
+		parts = append(parts, "д. "+b)
+	}
+	if ap := strings.TrimSpace(a.Apartment); ap != "" {
+		parts = append(parts, "кв. "+ap)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type Address struct {
+	ID     int `json:"id" db:"id"`
+	UserID int `json:"user_id" db:"user_id"`
+	AddressFields
+	IsDefault bool      `json:"is_default" db:"is_default"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type AddressRequest struct {
+	AddressFields
+	IsDefault bool `json:"is_default"`
+}
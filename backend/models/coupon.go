@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Типы купонов
+const (
+	CouponTypePercent = "percent" // скидка в процентах от суммы подходящих товаров
+	CouponTypeFixed   = "fixed"   // фиксированная сумма скидки
+)
+
+type Coupon struct {
+	ID            int        `json:"id" db:"id"`
+	Code          string     `json:"code" db:"code"`
+	Type          string     `json:"type" db:"type"`
+	Value         int64      `json:"value" db:"value"` // проценты для percent, копейки для fixed
+	MinOrderTotal Money      `json:"min_order_total" db:"min_order_total"`
+	CategoryIDs   IntArray   `json:"category_ids" db:"category_ids"`
+	ProductIDs    IntArray   `json:"product_ids" db:"product_ids"`
+	StartsAt      *time.Time `json:"starts_at,omitempty" db:"starts_at"`
+	EndsAt        *time.Time `json:"ends_at,omitempty" db:"ends_at"`
+	UsageLimit    int        `json:"usage_limit" db:"usage_limit"`       // 0 - без ограничений
+	PerUserLimit  int        `json:"per_user_limit" db:"per_user_limit"` // 0 - без ограничений
+	Stackable     bool       `json:"stackable" db:"stackable"`           // применяется ли к товарам со скидкой
+	Active        bool       `json:"active" db:"active"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+type ApplyCouponRequest struct {
+	Code       string `json:"code" validate:"required"`
+	ProductIDs []int  `json:"product_ids"`
+}
+
+type CouponPreview struct {
+	Code     string `json:"code"`
+	Subtotal Money  `json:"subtotal"`
+	Discount Money  `json:"discount"`
+	Total    Money  `json:"total"`
+}
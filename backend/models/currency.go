@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Currency - валюта для отображения цен и её курс к рублю
+type Currency struct {
+	ID        int       `json:"id" db:"id"`
+	Code      string    `json:"code" db:"code"` // ISO 4217
+	Name      string    `json:"name" db:"name"`
+	Rate      float64   `json:"rate" db:"rate"`         // сколько рублей стоит единица валюты
+	Decimals  int       `json:"decimals" db:"decimals"` // знаков после запятой при округлении: 0 - до целых
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
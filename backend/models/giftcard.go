@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Статусы подарочной карты. "expired" не хранится, а вычисляется по expires_at
+const (
+	GiftCardStatusActive  = "active"
+	GiftCardStatusVoid    = "void"
+	GiftCardStatusExpired = "expired"
+)
+
+// Типы операций по подарочной карте
+const (
+	GiftCardTxIssue        = "issue"         // выпуск карты
+	GiftCardTxRedeem       = "redeem"        // оплата заказа картой
+	GiftCardTxRedeemReturn = "redeem_return" // возврат на карту при отмене заказа
+	GiftCardTxVoid         = "void"          // аннулирование остатка
+)
+
+type GiftCard struct {
+	ID             int                   `json:"id" db:"id"`
+	Code           string                `json:"code" db:"code"`
+	InitialBalance Money                 `json:"initial_balance" db:"initial_balance"`
+	Balance        Money                 `json:"balance" db:"balance"`
+	Status         string                `json:"status" db:"status"`
+	ExpiresAt      time.Time             `json:"expires_at" db:"expires_at"`
+	OrderID        int                   `json:"order_id,omitempty" db:"order_id"` // заказ, которым карта куплена
+	ProductID      int                   `json:"product_id,omitempty" db:"product_id"`
+	RecipientEmail string                `json:"recipient_email,omitempty" db:"recipient_email"`
+	Note           string                `json:"note,omitempty" db:"note"`
+	IssuedBy       int                   `json:"issued_by,omitempty" db:"issued_by"` // администратор, выпустивший карту вручную
+	VoidedAt       *time.Time            `json:"voided_at,omitempty" db:"voided_at"`
+	VoidReason     string                `json:"void_reason,omitempty" db:"void_reason"`
+	CreatedAt      time.Time             `json:"created_at" db:"created_at"`
+	Transactions   []GiftCardTransaction `json:"transactions,omitempty"`
+}
+
+type GiftCardTransaction struct {
+	ID           int       `json:"id" db:"id"`
+	GiftCardID   int       `json:"gift_card_id" db:"gift_card_id"`
+	OrderID      int       `json:"order_id,omitempty" db:"order_id"`
+	Type         string    `json:"type" db:"type"`
+	Amount       Money     `json:"amount" db:"amount"` // положительная - пополнение, отрицательная - списание
+	BalanceAfter Money     `json:"balance_after" db:"balance_after"`
+	Reason       string    `json:"reason,omitempty" db:"reason"`
+	AdminID      int       `json:"admin_id,omitempty" db:"admin_id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// GiftCardBalance - публичная проверка баланса карты по коду
+type GiftCardBalance struct {
+	Code      string    `json:"code"`
+	Balance   Money     `json:"balance"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type IssueGiftCardRequest struct {
+	Amount         Money      `json:"amount"`
+	ExpiresAt      *time.Time `json:"expires_at"` // по умолчанию - через год
+	RecipientEmail string     `json:"recipient_email"`
+	Language       string     `json:"language"` // язык письма получателю
+	Note           string     `json:"note"`
+}
+
+type VoidGiftCardRequest struct {
+	Reason string `json:"reason"`
+}
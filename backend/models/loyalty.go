@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// LoyaltyTransaction - запись журнала баллов лояльности
+type LoyaltyTransaction struct {
+	ID           int        `json:"id" db:"id"`
+	UserID       int        `json:"user_id" db:"user_id"`
+	OrderID      int        `json:"order_id,omitempty" db:"order_id"`
+	Type         string     `json:"type" db:"type"`
+	Points       int        `json:"points" db:"points"`                 // положительные - начисления, отрицательные - списания
+	Remaining    int        `json:"remaining,omitempty" db:"remaining"` // несгоревший и непотраченный остаток начисления
+	BalanceAfter int        `json:"balance_after" db:"balance_after"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	Reason       string     `json:"reason,omitempty" db:"reason"`
+	AdminID      int        `json:"admin_id,omitempty" db:"admin_id"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// LoyaltyExpiration - сколько баллов сгорит и когда
+type LoyaltyExpiration struct {
+	Points    int       `json:"points"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LoyaltyAccount - баланс, ближайшие сгорания и история баллов пользователя
+type LoyaltyAccount struct {
+	Balance     int                  `json:"balance"`
+	Value       Money                `json:"value"` // сколько можно сэкономить баллами
+	EarnPercent int                  `json:"earn_percent"`
+	Expiring    []LoyaltyExpiration  `json:"expiring"`
+	History     []LoyaltyTransaction `json:"history"`
+}
+
+type LoyaltyAdjustRequest struct {
+	Points int    `json:"points" validate:"required"` // положительное - начислить, отрицательное - списать
+	Reason string `json:"reason" validate:"required"`
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money - денежная сумма в копейках (минимальных единицах валюты).
+// В БД хранится как INTEGER, в JSON передаётся числом в рублях с двумя знаками ("1540.50"),
+// чтобы формат API не менялся для клиентов.
+//
+// Правило округления везде одно: до целой копейки, половина округляется от нуля (half-up).
+type Money int64
+
+// MoneyFromFloat переводит сумму в рублях в копейки с округлением half-up
+func MoneyFromFloat(rubles float64) Money {
+	return Money(math.Round(rubles * 100))
+}
+
+// ParseMoney разбирает десятичную строку в рублях ("1540", "1540.5", "1540,50") без потерь точности
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(strings.Replace(s, ",", ".", 1))
+	if s == "" {
+		return 0, errors.New("empty money value")
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	// Знак допустим только один и только перед числом, поэтому проверяем цифры сами, а не через ParseInt;
+	// хотя бы одна цифра обязательна ("-", "." - не суммы)
+	if !isDigits(whole) || !isDigits(frac) || whole+frac == "" {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	rubles, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+
+	// Третий и последующие знаки после запятой округляем half-up
+	padded := frac + "00"
+	kopecks, _ := strconv.ParseInt(padded[:2], 10, 64)
+	if len(frac) > 2 && frac[2] >= '5' {
+		kopecks++
+	}
+
+	m := Money(rubles*100 + kopecks)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Float возвращает сумму в рублях - только для отображения и внешних API
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// String форматирует сумму как "1540.50"
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Mul умножает сумму на количество
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percent возвращает percent процентов от суммы, округляя half-up
+func (m Money) Percent(percent int64) Money {
+	return Money(divRound(int64(m)*percent, 100))
+}
+
+// ApplyDiscount возвращает сумму после скидки в процентах, округляя half-up
+func (m Money) ApplyDiscount(percent int) Money {
+	return Money(divRound(int64(m)*int64(100-percent), 100))
+}
+
+// divRound делит с округлением half-up (от нуля)
+func divRound(a, b int64) int64 {
+	if (a < 0) != (b < 0) {
+		return (a - b/2) / b
+	}
+	return (a + b/2) / b
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*m = 0
+		return nil
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = Money(math.Round(v))
+	case []byte:
+		i, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = Money(i)
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = Money(i)
+	default:
+		return errors.New("cannot scan into Money")
+	}
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
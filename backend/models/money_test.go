@@ -0,0 +1,204 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"1540", 154000},
+		{"1540.5", 154050},
+		{"1540,50", 154050},
+		{" 12.34 ", 1234},
+		{".5", 50},
+		{"5.", 500},
+		{"-.5", -50},
+		{"0.004", 0},
+		{"0.005", 1},
+		{"0.994", 99},
+		{"0.995", 100},
+		{"1.999", 200},
+		{"-0.005", -1},
+		{"-1540.50", -154050},
+		{"-0.994", -99},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if err != nil {
+			t.Errorf("ParseMoney(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMoneyInvalid(t *testing.T) {
+	for _, in := range []string{"", "  ", "abc", "1.2x", "1..2", "--5", "-+5", "1,2,3", "-", ".", "-.", ",", " - "} {
+		if got, err := ParseMoney(in); err == nil {
+			t.Errorf("ParseMoney(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{1540, 154000},
+		{0.01, 1},
+		{0.125, 13},
+		{-0.125, -13},
+		{19.99, 1999},
+	}
+	for _, tt := range tests {
+		if got := MoneyFromFloat(tt.in); got != tt.want {
+			t.Errorf("MoneyFromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{154050, "1540.50"},
+		{-1, "-0.01"},
+		{-154000, "-1540.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		m       Money
+		percent int64
+		want    Money
+	}{
+		{1000, 10, 100},
+		{5, 10, 1},  // 0.5 копейки -> 1
+		{4, 10, 0},  // 0.4 копейки -> 0
+		{15, 10, 2}, // 1.5 -> 2
+		{-5, 10, -1},
+		{-15, 10, -2},
+		{-4, 10, 0},
+		{154000, 0, 0},
+		{154000, 100, 154000},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Percent(tt.percent); got != tt.want {
+			t.Errorf("Money(%d).Percent(%d) = %d, want %d", tt.m, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyApplyDiscount(t *testing.T) {
+	tests := []struct {
+		m       Money
+		percent int
+		want    Money
+	}{
+		{154000, 0, 154000},
+		{154000, 10, 138600},
+		{154000, 100, 0},
+		{999, 15, 849},  // 849.15 -> 849
+		{1001, 50, 501}, // 500.5 -> 501
+		{-1001, 50, -501},
+	}
+	for _, tt := range tests {
+		if got := tt.m.ApplyDiscount(tt.percent); got != tt.want {
+			t.Errorf("Money(%d).ApplyDiscount(%d) = %d, want %d", tt.m, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	for _, m := range []Money{0, 1, 99, 154050, -1, -154050} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%d): %v", m, err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if got != m {
+			t.Errorf("round-trip %d -> %s -> %d", m, data, got)
+		}
+	}
+
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`1540.5`, 154050},
+		{`"1540,50"`, 154050},
+		{`null`, 0},
+		{`""`, 0},
+		{`0.005`, 1},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"abc"`), &m); err == nil {
+		t.Error("Unmarshal(\"abc\") succeeded, want error")
+	}
+}
+
+func TestMoneyScanValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want Money
+	}{
+		{nil, 0},
+		{int64(154050), 154050},
+		{int64(-1), -1},
+		{float64(154049.6), 154050},
+		{[]byte("154050"), 154050},
+		{"-154050", -154050},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := got.Scan(tt.in); err != nil {
+			t.Errorf("Scan(%v): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+		v, err := got.Value()
+		if err != nil || v != int64(tt.want) {
+			t.Errorf("Value() = %v, %v, want %d", v, err, tt.want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Error("Scan(bool) succeeded, want error")
+	}
+	if err := m.Scan("1.5"); err == nil {
+		t.Error("Scan(\"1.5\") succeeded, want error")
+	}
+}
@@ -33,34 +33,106 @@ func (ia IntArray) Value() (driver.Value, error) {
 	return json.Marshal(ia)
 }
 
+// Статусы заказа
+const (
+	OrderStatusNew       = "новый"
+	OrderStatusPaid      = "оплачен"
+	OrderStatusShipped   = "отправлен"
+	OrderStatusDelivered = "доставлен"
+	OrderStatusCancelled = "отменен"
+	OrderStatusRefunded  = "возвращен"
+)
+
 type Order struct {
-	ID         int       `json:"id" db:"id"`
-	UserID     int       `json:"user_id" db:"user_id"`
-	ProductIDs IntArray  `json:"product_ids" db:"product_ids"`
-	Status     string    `json:"status" db:"status"`
-	Price      float64   `json:"price" db:"price"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	User       *User     `json:"user,omitempty"`
-	Products   []Product `json:"products,omitempty"`
+	ID              int            `json:"id" db:"id"`
+	UserID          int            `json:"user_id" db:"user_id"`
+	ProductIDs      IntArray       `json:"product_ids" db:"product_ids"`
+	Status          string         `json:"status" db:"status"`
+	Price           Money          `json:"price" db:"price"`
+	CouponCode      string         `json:"coupon_code,omitempty" db:"coupon_code"`
+	CouponDiscount  Money          `json:"coupon_discount" db:"coupon_discount"`
+	RefundedAmount  Money          `json:"refunded_amount" db:"refunded_amount"`
+	ShippingMethod  string         `json:"shipping_method,omitempty" db:"shipping_method"`
+	ShippingCost    Money          `json:"shipping_cost" db:"shipping_cost"`
+	ShippingRegion  string         `json:"shipping_region,omitempty" db:"shipping_region"`
+	Address         *AddressFields `json:"delivery_address,omitempty" db:"delivery_address"`
+	InvoiceNumber   int            `json:"invoice_number,omitempty" db:"invoice_number"`
+	LoyaltyPoints   int            `json:"loyalty_points,omitempty" db:"loyalty_points"` // баллы, которыми оплачена часть заказа
+	LoyaltyDiscount Money          `json:"loyalty_discount" db:"loyalty_discount"`
+	GiftCardCode    string         `json:"gift_card_code,omitempty"` // подарочная карта, которой оплачена часть заказа
+	GiftCardAmount  Money          `json:"gift_card_amount" db:"gift_card_amount"`
+	TaxMode         string         `json:"tax_mode,omitempty" db:"tax_mode"` // inclusive - налог в цене, exclusive - начислен сверху
+	TaxAmount       Money          `json:"tax_amount" db:"tax_amount"`
+	ShippingTaxRate int            `json:"shipping_tax_rate,omitempty" db:"shipping_tax_rate"`
+	ShippingTax     Money          `json:"shipping_tax" db:"shipping_tax"`
+	TaxLines        []TaxLine      `json:"tax_lines,omitempty"`
+	Currency        string         `json:"currency" db:"currency"`                 // валюта, выбранная при оформлении; суммы заказа хранятся в рублях
+	ExchangeRate    float64        `json:"exchange_rate" db:"exchange_rate"`       // курс этой валюты на момент заказа
+	GuestEmail      string         `json:"guest_email,omitempty" db:"guest_email"` // контакты покупателя гостевого заказа (без аккаунта)
+	GuestName       string         `json:"guest_name,omitempty" db:"guest_name"`
+	GuestPhone      string         `json:"guest_phone,omitempty" db:"guest_phone"`
+	GuestLanguage   string         `json:"-" db:"guest_language"`
+	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
+	User            *User          `json:"user,omitempty"`
+	Products        []Product      `json:"products,omitempty"`
+	Items           []OrderItem    `json:"items,omitempty"`
+	Shipments       []Shipment     `json:"shipments,omitempty"`
+}
+
+// OrderItem - позиция заказа с ценой за единицу на момент покупки (с учётом скидки товара)
+// и ценой без скидки
+type OrderItem struct {
+	ProductID int    `json:"product_id" db:"product_id"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity" db:"quantity"`
+	Price     Money  `json:"price" db:"price"`
+	ListPrice Money  `json:"list_price" db:"list_price"`
+	TaxRate   int    `json:"tax_rate" db:"tax_rate"`
+	TaxAmount Money  `json:"tax_amount" db:"tax_amount"` // налог по позиции с учётом скидок заказа
+	// Состав набора на момент заказа (для комплектации): количество - на всю позицию, цена не указывается
+	Components []OrderItem `json:"components,omitempty"`
+}
+
+// TaxLine - сумма налога заказа по одной ставке (товары и доставка)
+type TaxLine struct {
+	Rate   int   `json:"rate"`
+	Amount Money `json:"amount"`
 }
 
 type CreateOrderRequest struct {
-	ProductIDs      []int  `json:"product_ids" validate:"required,min=1"`
-	Email           string `json:"email" validate:"required,email"`
-	Password        string `json:"password" validate:"required,min=6"`
-	Name            string `json:"name" validate:"required"`
-	Phone           string `json:"phone" validate:"required"`
-	DeliveryAddress string `json:"delivery_address" validate:"required"`
+	ProductIDs      []int          `json:"product_ids" validate:"required,min=1"`
+	Email           string         `json:"email" validate:"required,email"`
+	Password        string         `json:"password" validate:"omitempty,min=6"` // без пароля - гостевой заказ без аккаунта
+	Name            string         `json:"name" validate:"required"`
+	Phone           string         `json:"phone" validate:"required"`
+	DeliveryAddress string         `json:"delivery_address" validate:"required"`
+	CouponCode      string         `json:"coupon_code"`
+	ShippingMethod  string         `json:"shipping_method"`
+	Region          string         `json:"region"`
+	AddressID       int            `json:"address_id"`
+	Address         *AddressFields `json:"address"`
+	Language        string         `json:"language"`
+	GiftCardCode    string         `json:"gift_card_code"`
+	Currency        string         `json:"currency"` // валюта отображения; оплата всё равно в рублях
 }
 
 type CreateOrderAuthRequest struct {
-	ProductIDs      []int  `json:"product_ids" validate:"required,min=1"`
-	Name            string `json:"name" validate:"required"`
-	Phone           string `json:"phone" validate:"required"`
-	DeliveryAddress string `json:"delivery_address" validate:"required"`
+	ProductIDs      []int          `json:"product_ids" validate:"required,min=1"`
+	Name            string         `json:"name" validate:"required"`
+	Phone           string         `json:"phone" validate:"required"`
+	DeliveryAddress string         `json:"delivery_address" validate:"required"`
+	CouponCode      string         `json:"coupon_code"`
+	ShippingMethod  string         `json:"shipping_method"`
+	Region          string         `json:"region"`
+	AddressID       int            `json:"address_id"`
+	Address         *AddressFields `json:"address"`
+	LoyaltyPoints   int            `json:"loyalty_points"` // сколько баллов потратить на оплату заказа
+	GiftCardCode    string         `json:"gift_card_code"`
+	Currency        string         `json:"currency"`
 }
 
 type OrderResponse struct {
-	Order Order  `json:"order"`
-	Token string `json:"token,omitempty"`
+	Order       Order  `json:"order"`
+	Token       string `json:"token,omitempty"`
+	LookupToken string `json:"lookup_token,omitempty"` // доступ к гостевому заказу без авторизации
 }
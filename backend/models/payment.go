@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type Payment struct {
+	ID              int       `json:"id" db:"id"`
+	OrderID         int       `json:"order_id" db:"order_id"`
+	Provider        string    `json:"provider" db:"provider"`
+	ExternalID      string    `json:"external_id" db:"external_id"`
+	Amount          Money     `json:"amount" db:"amount"`
+	RefundedAmount  Money     `json:"refunded_amount" db:"refunded_amount"`
+	Status          string    `json:"status" db:"status"`
+	ConfirmationURL string    `json:"confirmation_url,omitempty" db:"confirmation_url"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type CreatePaymentRequest struct {
+	Provider  string `json:"provider"`
+	ReturnURL string `json:"return_url"`
+}
+
+type RefundRequest struct {
+	Amount Money `json:"amount"` // 0 - вернуть весь остаток
+}
@@ -42,16 +42,40 @@ type Category struct {
 type Product struct {
 	ID               int         `json:"id" db:"id"`
 	Name             string      `json:"name" db:"name"`
-	Price            float64     `json:"price" db:"price"`
+	Price            Money       `json:"price" db:"price"`
 	ShortDescription string      `json:"short_description" db:"short_description"`
 	LongDescription  string      `json:"long_description" db:"long_description"`
 	SKU              string      `json:"sku" db:"sku"`
 	Discount         int         `json:"discount" db:"discount"`
+	Stock            *int        `json:"stock" db:"stock"`         // nil - остаток не отслеживается
+	Weight           int         `json:"weight" db:"weight"`       // граммы, для расчёта доставки
+	GiftCard         bool        `json:"gift_card" db:"gift_card"` // подарочный сертификат на сумму цены товара
 	Images           StringArray `json:"images" db:"images"`
 	CategoryID       int         `json:"category_id" db:"category_id"`
 	Category         *Category   `json:"category,omitempty"`
 	CreatedAt        time.Time   `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time   `json:"updated_at" db:"updated_at"`
+	// Набор: цена - своя или сумма компонентов со скидкой набора, остаток считается по компонентам
+	BundleDiscount *int              `json:"bundle_discount,omitempty" db:"bundle_discount"` // nil - у набора своя цена
+	Components     []BundleComponent `json:"components,omitempty"`
+}
+
+// BundleItem - товар в составе набора и его количество в одном наборе
+type BundleItem struct {
+	ProductID int `json:"product_id" db:"product_id"`
+	Quantity  int `json:"quantity" db:"quantity"`
+}
+
+// BundleComponent - компонент набора с данными товара для карточки и расчёта остатка
+type BundleComponent struct {
+	ProductID int         `json:"product_id"`
+	Name      string      `json:"name"`
+	SKU       string      `json:"sku"`
+	Quantity  int         `json:"quantity"`
+	Price     Money       `json:"price"` // цена за единицу с учётом скидки товара
+	Stock     *int        `json:"stock"`
+	Weight    int         `json:"-"`
+	Images    StringArray `json:"images"`
 }
 
 type Review struct {
@@ -71,6 +95,7 @@ type ProductListRequest struct {
 	PriceTo     *float64 `query:"price_to"`
 	HasDiscount *bool    `query:"has_discount"`
 	Search      string   `query:"search"`
+	Sort        string   `query:"sort"`
 }
 
 type ProductListResponse struct {
@@ -78,4 +103,5 @@ type ProductListResponse struct {
 	Total    int       `json:"total"`
 	Limit    int       `json:"limit"`
 	Offset   int       `json:"offset"`
+	Currency string    `json:"currency"` // валюта цен в ответе
 }
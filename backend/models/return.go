@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Статусы заявки на возврат
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusRefunded  = "refunded"
+)
+
+type ReturnRequest struct {
+	ID           int          `json:"id" db:"id"`
+	OrderID      int          `json:"order_id" db:"order_id"`
+	UserID       int          `json:"user_id" db:"user_id"`
+	Reason       string       `json:"reason" db:"reason"`
+	Photos       StringArray  `json:"photos" db:"photos"`
+	Status       string       `json:"status" db:"status"`
+	RefundAmount Money        `json:"refund_amount" db:"refund_amount"`
+	AdminComment string       `json:"admin_comment,omitempty" db:"admin_comment"`
+	Items        []ReturnItem `json:"items"`
+	CreatedAt    time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+type ReturnItem struct {
+	ProductID int   `json:"product_id" db:"product_id"`
+	Quantity  int   `json:"quantity" db:"quantity"`
+	Price     Money `json:"price" db:"price"`
+}
+
+type CreateReturnRequest struct {
+	Reason string       `json:"reason"`
+	Photos []string     `json:"photos"`
+	Items  []ReturnItem `json:"items"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Shipment - отправление заказа у перевозчика
+type Shipment struct {
+	ID             int             `json:"id" db:"id"`
+	OrderID        int             `json:"order_id" db:"order_id"`
+	Carrier        string          `json:"carrier" db:"carrier"`
+	TrackingNumber string          `json:"tracking_number" db:"tracking_number"`
+	Status         string          `json:"status" db:"status"`
+	ShippedAt      *time.Time      `json:"shipped_at,omitempty" db:"shipped_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	Events         []TrackingEvent `json:"events"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// TrackingEvent - событие в истории отслеживания отправления
+type TrackingEvent struct {
+	ID          int       `json:"id" db:"id"`
+	ShipmentID  int       `json:"shipment_id" db:"shipment_id"`
+	Status      string    `json:"status" db:"status"`
+	Description string    `json:"description" db:"description"`
+	Location    string    `json:"location,omitempty" db:"location"`
+	OccurredAt  time.Time `json:"occurred_at" db:"occurred_at"`
+}
+
+type TrackingEventRequest struct {
+	Status      string     `json:"status"`
+	Description string     `json:"description"`
+	Location    string     `json:"location"`
+	OccurredAt  *time.Time `json:"occurred_at"`
+}
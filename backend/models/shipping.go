@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Типы способов доставки
+const (
+	ShippingTypeCourier = "courier"
+	ShippingTypePickup  = "pickup"
+	ShippingTypePost    = "post"
+)
+
+// ShippingMethod - способ доставки и правила расчёта её стоимости:
+// base_cost + cost_per_kg за каждый начатый килограмм, бесплатно от free_from.
+type ShippingMethod struct {
+	ID            int         `json:"id" db:"id"`
+	Code          string      `json:"code" db:"code"`
+	Name          string      `json:"name" db:"name"`
+	Type          string      `json:"type" db:"type"`
+	BaseCost      Money       `json:"base_cost" db:"base_cost"`
+	CostPerKg     Money       `json:"cost_per_kg" db:"cost_per_kg"`
+	FreeFrom      Money       `json:"free_from" db:"free_from"`             // 0 - без бесплатной доставки
+	MinOrderTotal Money       `json:"min_order_total" db:"min_order_total"` // минимальная сумма заказа
+	MaxWeight     int         `json:"max_weight" db:"max_weight"`           // граммы, 0 - без ограничения
+	Regions       StringArray `json:"regions" db:"regions"`                 // пусто - все регионы
+	Active        bool        `json:"active" db:"active"`
+	SortOrder     int         `json:"sort_order" db:"sort_order"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+}
+
+type ShippingQuoteRequest struct {
+	ProductIDs []int  `json:"product_ids"`
+	Region     string `json:"region"`
+	CouponCode string `json:"coupon_code"`
+}
+
+// ShippingQuote - стоимость доставки заказа выбранным способом
+type ShippingQuote struct {
+	Method string `json:"method"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Cost   Money  `json:"cost"`
+	Free   bool   `json:"free"`
+}
+
+type ShippingQuoteResponse struct {
+	Subtotal Money           `json:"subtotal"`
+	Weight   int             `json:"weight"`
+	Methods  []ShippingQuote `json:"methods"`
+}
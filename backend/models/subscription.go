@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Виды подписок на товар
+const (
+	SubscriptionBackInStock = "back_in_stock" // товар снова в наличии
+	SubscriptionPriceDrop   = "price_drop"    // цена со скидкой стала ниже, чем при подписке
+)
+
+// ProductSubscription - подписка покупателя на уведомление об изменении товара
+type ProductSubscription struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	ProductID   int        `json:"product_id" db:"product_id"`
+	ProductName string     `json:"product_name"`
+	Kind        string     `json:"kind" db:"kind"`
+	Price       Money      `json:"price" db:"price"` // цена на момент подписки или последнего уведомления о снижении
+	NotifiedAt  *time.Time `json:"notified_at,omitempty" db:"notified_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+type CreateSubscriptionRequest struct {
+	Kind string `json:"kind"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// События для исходящих вебхуков
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventProductUpdated     = "product.updated"
+	EventUserRegistered     = "user.registered"
+	EventReviewCreated      = "review.created"
+)
+
+// WebhookEvents - все события, на которые можно подписаться; "*" подписывает на все
+var WebhookEvents = []string{EventOrderCreated, EventOrderStatusChanged, EventProductUpdated, EventUserRegistered, EventReviewCreated}
+
+// WebhookPayload - тело запроса вебхука
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
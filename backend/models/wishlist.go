@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Wishlist - именованный список желаний пользователя. По публичной ссылке его можно посмотреть без входа.
+type Wishlist struct {
+	ID         int            `json:"id" db:"id"`
+	Name       string         `json:"name" db:"name"`
+	ShareURL   string         `json:"share_url,omitempty"` // пусто - список не опубликован
+	ItemsCount int            `json:"items_count"`
+	Items      []WishlistItem `json:"items,omitempty"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// WishlistItem - товар в списке желаний с заметкой пользователя
+type WishlistItem struct {
+	ProductID int       `json:"product_id" db:"product_id"`
+	Note      string    `json:"note" db:"note"`
+	AddedAt   time.Time `json:"added_at" db:"added_at"`
+	Product   *Product  `json:"product,omitempty"`
+}
+
+type WishlistRequest struct {
+	Name string `json:"name"`
+}
+
+type WishlistItemRequest struct {
+	ProductID int     `json:"product_id"`
+	Note      *string `json:"note"` // nil - заметка не меняется
+}
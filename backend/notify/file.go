@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender складывает письма в каталог файлами .eml вместо отправки - для разработки и тестов
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func NewFileSender(dir, from string) *FileSender {
+	return &FileSender{Dir: dir, From: from}
+}
+
+func (s *FileSender) Name() string { return "file" }
+
+func (s *FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	name := time.Now().Format("20060102-150405") + "-" + randomID()[:8] + ".eml"
+	return os.WriteFile(filepath.Join(s.Dir, name), buildMessage(s.From, msg), 0644)
+}
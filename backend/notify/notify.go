@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message - письмо, готовое к отправке
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender - способ доставки писем (SMTP, файлы и т.п.)
+type Sender interface {
+	Name() string
+	Send(msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Sender
+	siteURL string
+)
+
+// Configure задаёт отправителя писем и адрес сайта для ссылок в письмах
+func Configure(s Sender, url string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = s
+	siteURL = strings.TrimRight(url, "/")
+}
+
+// Current возвращает настроенного отправителя
+func Current() (Sender, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current, current != nil
+}
+
+// SiteURL - адрес сайта без завершающего слэша
+func SiteURL() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return siteURL
+}
+
+// buildMessage формирует письмо в формате RFC 5322 (text/plain, UTF-8, quoted-printable)
+func buildMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", randomID(), domainOf(from))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+
+	return buf.Bytes()
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domainOf(address string) string {
+	address = strings.TrimSuffix(address, ">")
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
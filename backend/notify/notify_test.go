@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildMessage(t *testing.T) {
+	raw := buildMessage("Магазин <shop@example.com>", Message{
+		To:      "user@example.com",
+		Subject: "Заказ №1 оформлен",
+		Body:    "Строка 1\nСтрока 2 = ок\n",
+	})
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Заказ №1 оформлен" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if to := msg.Header.Get("To"); to != "user@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q, want the sender domain", id)
+	}
+	if ct := msg.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// net/mail не декодирует quoted-printable, поэтому проверяем тело в закодированном виде
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "=D0=A1") || strings.Contains(string(body), "\n\n") {
+		t.Errorf("body is not quoted-printable with CRLF line breaks: %q", body)
+	}
+}
+
+func TestDomainOf(t *testing.T) {
+	tests := map[string]string{
+		"shop@example.com":        "example.com",
+		"Shop <shop@example.com>": "example.com",
+		"localhost":               "localhost",
+	}
+	for in, want := range tests {
+		if got := domainOf(in); got != want {
+			t.Errorf("domainOf(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	s := NewFileSender(dir, "shop@example.com")
+
+	for i := 0; i < 2; i++ {
+		if err := s.Send(Message{To: "user@example.com", Subject: "Hello", Body: "Text"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("From") != "shop@example.com" || msg.Header.Get("To") != "user@example.com" {
+		t.Errorf("headers = %v", msg.Header)
+	}
+}
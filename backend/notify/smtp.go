@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPSender отправляет письма через SMTP-сервер.
+// Без Username письма отправляются без авторизации (удобно для локальных SMTP-заглушек).
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPSender(addr, username, password, from string) *SMTPSender {
+	return &SMTPSender{Addr: addr, Username: username, Password: password, From: from}
+}
+
+func (s *SMTPSender) Name() string { return "smtp" }
+
+func (s *SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// В конверте нужен голый адрес, в заголовке From можно указать имя
+	envelopeFrom := s.From
+	if parsed, err := mail.ParseAddress(s.From); err == nil {
+		envelopeFrom = parsed.Address
+	}
+
+	return smtp.SendMail(s.Addr, auth, envelopeFrom, []string{msg.To}, buildMessage(s.From, msg))
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TelegramAPIURL - адрес Bot API по умолчанию
+const TelegramAPIURL = "https://api.telegram.org"
+
+// TelegramBot отправляет сообщения через Telegram Bot API.
+// BaseURL можно направить на локальную заглушку API.
+type TelegramBot struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// RateLimitError - Bot API ограничил частоту запросов (HTTP 429) и просит подождать RetryAfter
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("telegram rate limit, retry after %s", e.RetryAfter)
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func NewTelegramBot(baseURL, token string) *TelegramBot {
+	if baseURL == "" {
+		baseURL = TelegramAPIURL
+	}
+	return &TelegramBot{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SendMessage отправляет текст в чат. При HTTP 429 возвращает *RateLimitError.
+func (b *TelegramBot) SendMessage(chatID, text string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.Client.Post(b.BaseURL+"/bot"+b.Token+"/sendMessage", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("telegram: invalid response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || result.ErrorCode == http.StatusTooManyRequests {
+		retryAfter := time.Duration(result.Parameters.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+	if resp.StatusCode != http.StatusOK || !result.OK {
+		return fmt.Errorf("telegram: status %d: %s", resp.StatusCode, result.Description)
+	}
+
+	return nil
+}
+
+var (
+	telegramBot   *TelegramBot
+	telegramChats []string
+	adminURL      string
+)
+
+// ConfigureTelegram задаёт бота, чаты сотрудников и адрес админки для ссылок на заказы
+func ConfigureTelegram(bot *TelegramBot, chats []string, admin string) {
+	mu.Lock()
+	defer mu.Unlock()
+	telegramBot = bot
+	telegramChats = chats
+	adminURL = strings.TrimRight(admin, "/")
+}
+
+// Telegram возвращает настроенного бота и чаты; ok == false, если уведомления в Telegram выключены
+func Telegram() (bot *TelegramBot, chats []string, ok bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return telegramBot, telegramChats, telegramBot != nil && len(telegramChats) > 0
+}
+
+// AdminURL - адрес админ-панели без завершающего слэша
+func AdminURL() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return adminURL
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// telegramStub - заглушка Bot API: запоминает запросы и отвечает заданным статусом и телом
+func telegramStub(t *testing.T, status int, response string, got *[]map[string]interface{}) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/sendMessage" {
+			http.NotFound(w, r)
+			return
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		*got = append(*got, payload)
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTelegramSendMessage(t *testing.T) {
+	var got []map[string]interface{}
+	server := telegramStub(t, http.StatusOK, `{"ok":true,"result":{}}`, &got)
+
+	bot := NewTelegramBot(server.URL+"/", "TOKEN")
+	if err := bot.SendMessage("-100", "Новый заказ №1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0]["chat_id"] != "-100" || got[0]["text"] != "Новый заказ №1" {
+		t.Errorf("requests = %v", got)
+	}
+}
+
+func TestTelegramRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     time.Duration
+	}{
+		{"retry_after", `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":7}}`, 7 * time.Second},
+		{"no retry_after", `{"ok":false,"error_code":429}`, time.Second},
+		{"no body", ``, time.Second},
+	}
+	for _, tt := range tests {
+		var got []map[string]interface{}
+		server := telegramStub(t, http.StatusTooManyRequests, tt.response, &got)
+
+		err := NewTelegramBot(server.URL, "TOKEN").SendMessage("1", "text")
+		var rateLimit *RateLimitError
+		if !errors.As(err, &rateLimit) {
+			t.Errorf("%s: err = %v, want *RateLimitError", tt.name, err)
+			continue
+		}
+		if rateLimit.RetryAfter != tt.want {
+			t.Errorf("%s: RetryAfter = %s, want %s", tt.name, rateLimit.RetryAfter, tt.want)
+		}
+	}
+}
+
+func TestTelegramErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+	}{
+		{"chat not found", http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`},
+		{"not ok", http.StatusOK, `{"ok":false}`},
+		{"invalid json", http.StatusOK, `not json`},
+	}
+	for _, tt := range tests {
+		var got []map[string]interface{}
+		server := telegramStub(t, tt.status, tt.response, &got)
+
+		err := NewTelegramBot(server.URL, "TOKEN").SendMessage("1", "text")
+		var rateLimit *RateLimitError
+		if err == nil || errors.As(err, &rateLimit) {
+			t.Errorf("%s: err = %v, want a non rate-limit error", tt.name, err)
+		}
+	}
+}
+
+func TestTelegramConfigure(t *testing.T) {
+	defer ConfigureTelegram(nil, nil, "")
+
+	if bot := NewTelegramBot("", "TOKEN"); bot.BaseURL != TelegramAPIURL {
+		t.Errorf("default BaseURL = %q", bot.BaseURL)
+	}
+
+	ConfigureTelegram(NewTelegramBot("", "TOKEN"), nil, "http://admin.local/")
+	if _, _, ok := Telegram(); ok {
+		t.Error("Telegram enabled without chats")
+	}
+	if AdminURL() != "http://admin.local" {
+		t.Errorf("AdminURL = %q", AdminURL())
+	}
+
+	ConfigureTelegram(NewTelegramBot("", "TOKEN"), []string{"-100"}, "")
+	if _, chats, ok := Telegram(); !ok || len(chats) != 1 {
+		t.Errorf("Telegram() = %v, %v", chats, ok)
+	}
+}
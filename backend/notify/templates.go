@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"myAPI/models"
+	"strings"
+	"text/template"
+)
+
+// Шаблоны писем
+const (
+	TemplateRegistration  = "registration"
+	TemplateOrderPlaced   = "order_placed"
+	TemplateStatusChanged = "status_changed"
+	TemplateShipped       = "shipped"
+	TemplatePasswordReset = "password_reset"
+	TemplateVerifyEmail   = "verify_email"
+	TemplateGiftCard      = "gift_card"
+	TemplateProductAlert  = "product_alert"
+)
+
+// Языки писем; язык по умолчанию - русский
+const (
+	LanguageRU = "ru"
+	LanguageEN = "en"
+)
+
+// Каждый шаблон templates/<язык>/<имя>.tmpl определяет блоки "subject" и "body"
+//
+//go:embed templates
+var templateFS embed.FS
+
+var templates = map[string]*template.Template{}
+
+func init() {
+	for _, lang := range []string{LanguageRU, LanguageEN} {
+		for _, name := range []string{TemplateRegistration, TemplateOrderPlaced, TemplateStatusChanged, TemplateShipped, TemplatePasswordReset, TemplateVerifyEmail, TemplateGiftCard, TemplateProductAlert} {
+			path := "templates/" + lang + "/" + name + ".tmpl"
+			t := template.New(name + ".tmpl").Funcs(template.FuncMap{"status": statusLabel(lang)})
+			templates[lang+"/"+name] = template.Must(t.ParseFS(templateFS, path))
+		}
+	}
+}
+
+// Статусы заказа хранятся по-русски, для английских писем их нужно перевести
+var statusesEN = map[string]string{
+	models.OrderStatusNew:       "new",
+	models.OrderStatusPaid:      "paid",
+	models.OrderStatusShipped:   "shipped",
+	models.OrderStatusDelivered: "delivered",
+	models.OrderStatusCancelled: "cancelled",
+	models.OrderStatusRefunded:  "refunded",
+}
+
+func statusLabel(lang string) func(string) string {
+	return func(status string) string {
+		if lang == LanguageEN {
+			if label, ok := statusesEN[status]; ok {
+				return label
+			}
+		}
+		return status
+	}
+}
+
+// NormalizeLanguage приводит код языка ("en-US", "EN") к поддерживаемому; неизвестные - к русскому
+func NormalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if strings.HasPrefix(lang, LanguageEN) {
+		return LanguageEN
+	}
+	return LanguageRU
+}
+
+// Render подставляет данные в шаблон и возвращает тему и текст письма
+func Render(lang, name string, data interface{}) (subject, body string, err error) {
+	t, ok := templates[NormalizeLanguage(lang)+"/"+name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown email template %q", name)
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := t.ExecuteTemplate(&buf, "body", data); err != nil {
+		return "", "", err
+	}
+	body = strings.TrimSpace(buf.String()) + "\n"
+
+	return subject, body, nil
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"myAPI/alerts"
+	"myAPI/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEmailData повторяет поля данных писем из handlers
+type testEmailData struct {
+	SiteURL   string
+	Name      string
+	Email     string
+	Order     *models.Order
+	ResetURL  string
+	VerifyURL string
+	LookupURL string
+	GiftCards []models.GiftCard
+	Alert     *alerts.Alert
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":      LanguageRU,
+		"ru":    LanguageRU,
+		"en":    LanguageEN,
+		"EN":    LanguageEN,
+		"en-US": LanguageEN,
+		" en ":  LanguageEN,
+		"de":    LanguageRU,
+	}
+	for in, want := range tests {
+		if got := NormalizeLanguage(in); got != want {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenderAllTemplates(t *testing.T) {
+	data := testEmailData{
+		SiteURL: "http://shop.local",
+		Name:    "Анна",
+		Email:   "anna@example.com",
+		Order: &models.Order{
+			ID:     42,
+			Status: models.OrderStatusPaid,
+			Price:  154000,
+			Items:  []models.OrderItem{{Name: "Товар", Quantity: 2, Price: 77000}},
+		},
+		ResetURL:  "http://shop.local/reset?token=t",
+		VerifyURL: "http://shop.local/verify?token=t",
+		GiftCards: []models.GiftCard{{Code: "GC-1", InitialBalance: 100000, ExpiresAt: time.Now()}},
+		Alert:     &alerts.Alert{Kind: models.SubscriptionPriceDrop, ProductName: "Товар", Price: 900, OldPrice: 1000},
+	}
+
+	names := []string{TemplateRegistration, TemplateOrderPlaced, TemplateStatusChanged, TemplateShipped,
+		TemplatePasswordReset, TemplateVerifyEmail, TemplateGiftCard, TemplateProductAlert}
+	for _, lang := range []string{LanguageRU, LanguageEN} {
+		for _, name := range names {
+			subject, body, err := Render(lang, name, data)
+			if err != nil {
+				t.Errorf("%s/%s: %v", lang, name, err)
+				continue
+			}
+			if subject == "" || strings.Contains(subject, "\n") {
+				t.Errorf("%s/%s: subject %q", lang, name, subject)
+			}
+			if !strings.HasSuffix(body, "\n") || strings.HasSuffix(body, "\n\n") {
+				t.Errorf("%s/%s: body must end with a single newline", lang, name)
+			}
+			if strings.Contains(body, "<no value>") {
+				t.Errorf("%s/%s: body has missing fields:\n%s", lang, name, body)
+			}
+		}
+	}
+}
+
+func TestRenderStatusLabel(t *testing.T) {
+	data := testEmailData{Order: &models.Order{ID: 7, Status: models.OrderStatusShipped}}
+
+	subject, _, err := Render("ru", TemplateStatusChanged, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(subject, models.OrderStatusShipped) {
+		t.Errorf("ru subject %q, want status %q", subject, models.OrderStatusShipped)
+	}
+
+	subject, _, err = Render("en-GB", TemplateStatusChanged, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Order #7: shipped" {
+		t.Errorf("en subject %q, want %q", subject, "Order #7: shipped")
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, _, err := Render("ru", "missing", nil); err == nil {
+		t.Error("Render of an unknown template succeeded, want error")
+	}
+}
@@ -0,0 +1,146 @@
+package payments
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"myAPI/models"
+	"net/http"
+	"time"
+)
+
+// FakeSignatureHeader - заголовок с HMAC-SHA256 подписью тела уведомления
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// FakeProvider - локальный платёжный шлюз для разработки и тестов без сети.
+// Платёж подтверждается на странице /api/payments/fake/:id, после чего шлюз
+// отправляет подписанный webhook на BaseURL + /api/payments/webhook/fake.
+type FakeProvider struct {
+	Secret  string
+	BaseURL string
+	Client  *http.Client
+}
+
+type fakeCallback struct {
+	PaymentID string `json:"payment_id"`
+	Status    string `json:"status"`
+}
+
+func NewFakeProvider(secret, baseURL string) *FakeProvider {
+	return &FakeProvider{
+		Secret:  secret,
+		BaseURL: baseURL,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) CreatePayment(req PaymentRequest) (*PaymentSession, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	id := "fake_" + hex.EncodeToString(buf)
+
+	return &PaymentSession{
+		ExternalID:      id,
+		ConfirmationURL: f.BaseURL + "/api/payments/fake/" + id,
+	}, nil
+}
+
+func (f *FakeProvider) HandleCallback(body []byte, header func(key string) string) (*CallbackEvent, error) {
+	expected := f.sign(body)
+	if !hmac.Equal([]byte(expected), []byte(header(FakeSignatureHeader))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var cb fakeCallback
+	if err := json.Unmarshal(body, &cb); err != nil {
+		return nil, err
+	}
+	if cb.Status != StatusSucceeded && cb.Status != StatusFailed {
+		return nil, fmt.Errorf("unknown payment status %q", cb.Status)
+	}
+
+	return &CallbackEvent{ExternalID: cb.PaymentID, Status: cb.Status}, nil
+}
+
+// Refund у фейкового шлюза всегда успешен
+func (f *FakeProvider) Refund(externalID string, amount models.Money) error {
+	if amount <= 0 {
+		return fmt.Errorf("refund amount must be positive")
+	}
+	return nil
+}
+
+// Complete имитирует решение покупателя на странице шлюза и отправляет подписанный webhook
+func (f *FakeProvider) Complete(externalID string, succeeded bool) error {
+	status := StatusFailed
+	if succeeded {
+		status = StatusSucceeded
+	}
+
+	body, err := json.Marshal(fakeCallback{PaymentID: externalID, Status: status})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.BaseURL+"/api/payments/webhook/fake", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FakeSignatureHeader, f.sign(body))
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (f *FakeProvider) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(f.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var fakePageTemplate = template.Must(template.New("fake").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Тестовая оплата</title></head>
+<body style="font-family: sans-serif; max-width: 420px; margin: 60px auto;">
+	<h2>Тестовый платёжный шлюз</h2>
+	<p>Платёж: <code>{{.ID}}</code></p>
+	<p>Сумма: <b>{{.Amount}} ₽</b></p>
+	{{if .Done}}<p>Статус: <b>{{.Status}}</b></p>{{else}}
+	<form method="post">
+		<button name="action" value="pay">Оплатить</button>
+		<button name="action" value="fail">Отклонить</button>
+	</form>{{end}}
+</body>
+</html>`))
+
+// RenderPage выводит локальную страницу подтверждения платежа
+func (f *FakeProvider) RenderPage(w io.Writer, externalID string, amount models.Money, status string) error {
+	return fakePageTemplate.Execute(w, map[string]interface{}{
+		"ID":     externalID,
+		"Amount": amount.String(),
+		"Status": status,
+		"Done":   status != StatusPending,
+	})
+}
@@ -0,0 +1,136 @@
+package payments
+
+import (
+	"errors"
+	"io"
+	"myAPI/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func signedHeader(signature string) func(string) string {
+	return func(key string) string {
+		if key == FakeSignatureHeader {
+			return signature
+		}
+		return ""
+	}
+}
+
+func TestFakeCreatePayment(t *testing.T) {
+	f := NewFakeProvider("secret", "http://shop.local")
+
+	a, err := f.CreatePayment(PaymentRequest{OrderID: 1, Amount: 154000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.CreatePayment(PaymentRequest{OrderID: 1, Amount: 154000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(a.ExternalID, "fake_") || a.ExternalID == b.ExternalID {
+		t.Errorf("external IDs %q, %q: want unique fake_ IDs", a.ExternalID, b.ExternalID)
+	}
+	if want := "http://shop.local/api/payments/fake/" + a.ExternalID; a.ConfirmationURL != want {
+		t.Errorf("ConfirmationURL = %q, want %q", a.ConfirmationURL, want)
+	}
+}
+
+func TestFakeHandleCallback(t *testing.T) {
+	f := NewFakeProvider("secret", "")
+	body := `{"payment_id":"fake_1","status":"succeeded"}`
+
+	event, err := f.HandleCallback([]byte(body), signedHeader(f.sign([]byte(body))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ExternalID != "fake_1" || event.Status != StatusSucceeded {
+		t.Errorf("event = %+v, want succeeded fake_1", event)
+	}
+
+	unknownStatus := `{"payment_id":"fake_1","status":"refunded"}`
+	invalidJSON := `{"payment_id":`
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		badSig    bool
+	}{
+		{"no signature", body, "", true},
+		{"tampered body", `{"payment_id":"fake_2","status":"succeeded"}`, f.sign([]byte(body)), true},
+		{"other secret", body, NewFakeProvider("other", "").sign([]byte(body)), true},
+		{"unknown status", unknownStatus, f.sign([]byte(unknownStatus)), false},
+		{"invalid json", invalidJSON, f.sign([]byte(invalidJSON)), false},
+	}
+	for _, tt := range tests {
+		_, err := f.HandleCallback([]byte(tt.body), signedHeader(tt.signature))
+		if err == nil {
+			t.Errorf("%s: want error", tt.name)
+			continue
+		}
+		if errors.Is(err, ErrInvalidSignature) != tt.badSig {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestFakeComplete(t *testing.T) {
+	receiver := NewFakeProvider("secret", "")
+	var got *CallbackEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/payments/webhook/fake" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		event, err := receiver.HandleCallback(body, r.Header.Get)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		got = event
+	}))
+	defer server.Close()
+
+	if err := NewFakeProvider("secret", server.URL).Complete("fake_1", false); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ExternalID != "fake_1" || got.Status != StatusFailed {
+		t.Errorf("webhook event = %+v, want failed fake_1", got)
+	}
+
+	// Приёмник отклонил уведомление - Complete возвращает ошибку
+	if err := NewFakeProvider("other", server.URL).Complete("fake_1", true); err == nil {
+		t.Error("Complete with a wrong secret succeeded, want error")
+	}
+}
+
+func TestFakeRefund(t *testing.T) {
+	f := NewFakeProvider("secret", "")
+	if err := f.Refund("fake_1", 100); err != nil {
+		t.Errorf("Refund: %v", err)
+	}
+	for _, amount := range []models.Money{0, -100} {
+		if err := f.Refund("fake_1", amount); err == nil {
+			t.Errorf("Refund(%d) succeeded, want error", amount)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if _, ok := Get("fake"); ok {
+		t.Fatal("fake provider is registered before Register")
+	}
+
+	f := NewFakeProvider("secret", "")
+	Register(f)
+	if p, ok := Get("fake"); !ok || p != f {
+		t.Errorf("Get(\"fake\") = %v, %v", p, ok)
+	}
+	if _, ok := Get(""); ok {
+		t.Error("Get(\"\") found a provider: there must be no default")
+	}
+}
@@ -0,0 +1,67 @@
+package payments
+
+import (
+	"errors"
+	"myAPI/models"
+	"sync"
+)
+
+// Статусы платежа
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusRefunded  = "refunded"
+)
+
+// ErrInvalidSignature - подпись уведомления от провайдера не прошла проверку
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// PaymentRequest - данные для создания платежа у провайдера
+type PaymentRequest struct {
+	OrderID     int
+	Amount      models.Money
+	Description string
+	ReturnURL   string
+}
+
+// PaymentSession - созданный у провайдера платёж
+type PaymentSession struct {
+	ExternalID      string
+	ConfirmationURL string
+}
+
+// CallbackEvent - результат разбора уведомления (webhook) провайдера
+type CallbackEvent struct {
+	ExternalID string
+	Status     string
+}
+
+// PaymentProvider - платёжный провайдер.
+// HandleCallback получает тело запроса и функцию чтения заголовков и обязан проверить подпись.
+type PaymentProvider interface {
+	Name() string
+	CreatePayment(req PaymentRequest) (*PaymentSession, error)
+	HandleCallback(body []byte, header func(key string) string) (*CallbackEvent, error)
+	Refund(externalID string, amount models.Money) error
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]PaymentProvider{}
+)
+
+// Register добавляет провайдера. Провайдера по умолчанию нет: покупатель выбирает его явно.
+func Register(p PaymentProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+// Get возвращает провайдера по имени
+func Get(name string) (PaymentProvider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
@@ -0,0 +1,82 @@
+package tax
+
+import (
+	"myAPI/models"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Режимы цен: в цены товаров налог уже включён или начисляется сверху
+const (
+	ModeInclusive = "inclusive"
+	ModeExclusive = "exclusive"
+)
+
+// Config - налоговые настройки магазина
+type Config struct {
+	Mode         string // ModeInclusive или ModeExclusive
+	DefaultRate  int    // ставка в процентах для категорий без своей ставки
+	ShippingRate int    // ставка для доставки
+}
+
+// DefaultConfig - цены с НДС 20%, как принято в рознице
+var DefaultConfig = Config{Mode: ModeInclusive, DefaultRate: 20, ShippingRate: 20}
+
+var (
+	mu     sync.RWMutex
+	config = DefaultConfig
+)
+
+// ConfigFromEnv читает TAX_MODE (inclusive/exclusive), TAX_DEFAULT_RATE и TAX_SHIPPING_RATE;
+// незаданные или некорректные значения берутся из DefaultConfig
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv("TAX_MODE"))); mode == ModeInclusive || mode == ModeExclusive {
+		cfg.Mode = mode
+	}
+	if v, err := strconv.Atoi(os.Getenv("TAX_DEFAULT_RATE")); err == nil && ValidRate(v) {
+		cfg.DefaultRate = v
+	}
+	cfg.ShippingRate = cfg.DefaultRate
+	if v, err := strconv.Atoi(os.Getenv("TAX_SHIPPING_RATE")); err == nil && ValidRate(v) {
+		cfg.ShippingRate = v
+	}
+	return cfg
+}
+
+func Configure(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+}
+
+func Current() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return config
+}
+
+// ValidRate - ставка в процентах от 0 до 100
+func ValidRate(rate int) bool {
+	return rate >= 0 && rate <= 100
+}
+
+// Inclusive - налог входит в цены товаров и доставки
+func (c Config) Inclusive() bool {
+	return c.Mode != ModeExclusive
+}
+
+// Amount - налог с суммы base по ставке rate с округлением до копейки:
+// для цен с налогом выделяется из суммы, иначе начисляется сверху
+func (c Config) Amount(base models.Money, rate int) models.Money {
+	if base <= 0 || rate <= 0 {
+		return 0
+	}
+	divisor := int64(100)
+	if c.Inclusive() {
+		divisor += int64(rate)
+	}
+	return models.Money((int64(base)*int64(rate) + divisor/2) / divisor)
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"myAPI/database"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IdempotencyRetention - сколько хранится сохранённый ответ для повторов
+const IdempotencyRetention = 24 * time.Hour
+
+// IdempotencyMiddleware обрабатывает заголовок Idempotency-Key:
+// первый запрос выполняется и его ответ сохраняется, повтор с тем же ключом и телом
+// получает сохранённый ответ, повтор с другим телом - 422.
+// Ключ действует в рамках пользователя и пути запроса. У анонимного запроса (гостевой заказ,
+// оплата по токену заказа) пользователя нет, поэтому ключ привязывается к клиенту - токену заказа
+// X-Order-Token или идентификатору посетителя X-Visitor-ID; без них ключ не принимается.
+// Тело в область ключа не входит, чтобы повтор с другим телом получил 422, а не выполнился заново.
+func IdempotencyMiddleware(c *fiber.Ctx) error {
+	key := strings.TrimSpace(c.Get("Idempotency-Key"))
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > 255 {
+		return c.Status(400).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+	}
+
+	hash := sha256.Sum256(append([]byte(c.Method()+" "+c.Path()+"?"+string(c.Request().URI().QueryString())+"\n"), c.Body()...))
+	requestHash := hex.EncodeToString(hash[:])
+
+	owner := fmt.Sprint(c.Locals("userID"))
+	if c.Locals("userID") == nil {
+		client := c.Get("X-Order-Token")
+		if client == "" {
+			client = c.Get("X-Visitor-ID")
+		}
+		if client == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Idempotency-Key without authorization requires X-Order-Token or X-Visitor-ID"})
+		}
+		// Храним хэш, а не сам токен заказа
+		anon := sha256.Sum256([]byte(client))
+		owner = "anon:" + hex.EncodeToString(anon[:])
+	}
+	scope := fmt.Sprintf("%s|%s|%s", owner, c.Path(), key)
+
+	now := time.Now().UTC()
+	database.DB.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", now.Add(-IdempotencyRetention))
+
+	// Резервируем ключ до выполнения запроса, чтобы одновременный повтор не создал дубль
+	_, err := database.DB.Exec(
+		"INSERT INTO idempotency_keys (scope, request_hash, created_at) VALUES (?, ?, ?)",
+		scope, requestHash, now,
+	)
+	if err != nil {
+		return replayIdempotent(c, scope, requestHash)
+	}
+
+	if err := c.Next(); err != nil {
+		database.DB.Exec("DELETE FROM idempotency_keys WHERE scope = ?", scope)
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	// Ошибки сервера не сохраняем, чтобы клиент мог повторить запрос
+	if status >= 500 {
+		database.DB.Exec("DELETE FROM idempotency_keys WHERE scope = ?", scope)
+		return nil
+	}
+
+	database.DB.Exec(
+		"UPDATE idempotency_keys SET status_code = ?, content_type = ?, response_body = ? WHERE scope = ?",
+		status, string(c.Response().Header.ContentType()), c.Response().Body(), scope,
+	)
+
+	return nil
+}
+
+func replayIdempotent(c *fiber.Ctx, scope, requestHash string) error {
+	var storedHash, contentType sql.NullString
+	var status sql.NullInt64
+	var body []byte
+
+	err := database.DB.QueryRow(
+		"SELECT request_hash, status_code, content_type, response_body FROM idempotency_keys WHERE scope = ?",
+		scope,
+	).Scan(&storedHash, &status, &contentType, &body)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check idempotency key"})
+	}
+
+	if storedHash.String != requestHash {
+		return c.Status(422).JSON(fiber.Map{"error": "Idempotency-Key was already used with a different request"})
+	}
+
+	if !status.Valid {
+		return c.Status(409).JSON(fiber.Map{"error": "A request with this Idempotency-Key is still in progress"})
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	if contentType.Valid && contentType.String != "" {
+		c.Set(fiber.HeaderContentType, contentType.String)
+	}
+	return c.Status(int(status.Int64)).Send(body)
+}
@@ -49,3 +49,23 @@ func AdminMiddleware(c *fiber.Ctx) error {
 	}
 	return c.Next()
 }
+
+// OptionalAuthMiddleware сохраняет данные пользователя в контексте, если передан валидный токен,
+// но пропускает анонимные запросы дальше
+func OptionalAuthMiddleware(c *fiber.Ctx) error {
+	parts := strings.Split(c.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return c.Next()
+	}
+
+	claims, err := ValidateToken(parts[1])
+	if err != nil {
+		return c.Next()
+	}
+
+	c.Locals("userID", claims.UserID)
+	c.Locals("userEmail", claims.Email)
+	c.Locals("role", claims.Role)
+
+	return c.Next()
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// defaultTrustedProxies - адреса, с которых приходит nginx: loopback и частные сети (в том числе сети Docker)
+var defaultTrustedProxies = []string{"127.0.0.1", "::1", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// TrustedProxies - адреса прокси из TRUSTED_PROXIES (через запятую, допускаются подсети),
+// которым можно верить в заголовке X-Real-IP. По умолчанию - loopback и частные сети.
+func TrustedProxies() []string {
+	env := os.Getenv("TRUSTED_PROXIES")
+	if env == "" {
+		return defaultTrustedProxies
+	}
+	var proxies []string
+	for _, p := range strings.Split(env, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// FailedAttemptsLimiter ограничивает число неудачных (4xx/5xx) запросов с одного IP за окно window.
+// Успешные запросы не учитываются: лимит защищает от перебора, а не от обычного использования.
+// IP клиента - c.IP(): за доверенным прокси он берётся из X-Real-IP (см. ProxyHeader в настройках приложения).
+func FailedAttemptsLimiter(max int, window time.Duration) fiber.Handler {
+	return failedAttemptsLimiter(max, window, func(c *fiber.Ctx) string {
+		return c.IP()
+	})
+}
+
+// GlobalFailedAttemptsLimiter - общий для всех клиентов лимит неудачных запросов за окно window.
+// Сдерживает перебор с многих адресов сразу; порог должен быть намного выше, чем у FailedAttemptsLimiter,
+// чтобы обычные ошибки покупателей его не исчерпывали.
+func GlobalFailedAttemptsLimiter(max int, window time.Duration) fiber.Handler {
+	return failedAttemptsLimiter(max, window, func(c *fiber.Ctx) string {
+		return "global"
+	})
+}
+
+func failedAttemptsLimiter(max int, window time.Duration, key func(c *fiber.Ctx) string) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:                    max,
+		Expiration:             window,
+		KeyGenerator:           key,
+		SkipSuccessfulRequests: true,
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many attempts, try again later",
+			})
+		},
+	})
+}
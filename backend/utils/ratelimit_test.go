@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// limitedApp - приложение с тем же доверием к прокси, что и в main.go: запросы из app.Test
+// приходят с адреса 0.0.0.0, его и считаем прокси, если trusted == true
+func limitedApp(trusted bool, handlers ...fiber.Handler) *fiber.App {
+	proxies := []string{"10.0.0.1"}
+	if trusted {
+		proxies = []string{"0.0.0.0"}
+	}
+	app := fiber.New(fiber.Config{
+		ProxyHeader:             "X-Real-IP",
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          proxies,
+	})
+	handlers = append(handlers, func(c *fiber.Ctx) error {
+		if c.Query("ok") == "1" {
+			return c.SendStatus(200)
+		}
+		return c.SendStatus(404)
+	})
+	app.Get("/lookup", handlers...)
+	return app
+}
+
+func status(t *testing.T, app *fiber.App, clientIP, query string) int {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/lookup"+query, nil)
+	req.Header.Set("X-Real-IP", clientIP)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestFailedAttemptsLimiterPerClient(t *testing.T) {
+	app := limitedApp(true, FailedAttemptsLimiter(3, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		if code := status(t, app, "203.0.113.1", ""); code != 404 {
+			t.Fatalf("attempt %d: status %d, want 404", i+1, code)
+		}
+	}
+	if code := status(t, app, "203.0.113.1", ""); code != 429 {
+		t.Errorf("first client after the limit: status %d, want 429", code)
+	}
+
+	// Другой клиент за тем же прокси не заблокирован
+	if code := status(t, app, "203.0.113.2", "?ok=1"); code != 200 {
+		t.Errorf("second client: status %d, want 200", code)
+	}
+	if code := status(t, app, "203.0.113.2", ""); code != 404 {
+		t.Errorf("second client failure: status %d, want 404", code)
+	}
+}
+
+func TestFailedAttemptsLimiterSkipsSuccess(t *testing.T) {
+	app := limitedApp(true, FailedAttemptsLimiter(2, time.Minute))
+
+	for i := 0; i < 5; i++ {
+		if code := status(t, app, "203.0.113.1", "?ok=1"); code != 200 {
+			t.Fatalf("successful request %d: status %d, want 200", i+1, code)
+		}
+	}
+}
+
+func TestFailedAttemptsLimiterUntrustedProxy(t *testing.T) {
+	// X-Real-IP от недоверенного адреса игнорируется: подменой заголовка лимит не обойти
+	app := limitedApp(false, FailedAttemptsLimiter(2, time.Minute))
+
+	status(t, app, "203.0.113.1", "")
+	status(t, app, "203.0.113.2", "")
+	if code := status(t, app, "203.0.113.3", ""); code != 429 {
+		t.Errorf("spoofed X-Real-IP: status %d, want 429", code)
+	}
+}
+
+func TestGlobalFailedAttemptsLimiter(t *testing.T) {
+	app := limitedApp(true, FailedAttemptsLimiter(2, time.Minute), GlobalFailedAttemptsLimiter(3, time.Minute))
+
+	// Отказы лимита на клиента не расходуют общий лимит
+	for i := 0; i < 5; i++ {
+		status(t, app, "203.0.113.1", "")
+	}
+	if code := status(t, app, "203.0.113.2", ""); code != 404 {
+		t.Fatalf("second client: status %d, want 404", code)
+	}
+
+	if code := status(t, app, "203.0.113.3", ""); code != 429 {
+		t.Errorf("third client after the global limit: status %d, want 429", code)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	if got := TrustedProxies(); len(got) != len(defaultTrustedProxies) {
+		t.Errorf("default proxies = %v", got)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", " 172.18.0.0/16, ,10.1.2.3")
+	got := TrustedProxies()
+	if len(got) != 2 || got[0] != "172.18.0.0/16" || got[1] != "10.1.2.3" {
+		t.Errorf("TrustedProxies() = %v", got)
+	}
+}
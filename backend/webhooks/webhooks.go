@@ -0,0 +1,77 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Заголовки запроса вебхука
+const (
+	SignatureHeader = "X-Webhook-Signature" // "sha256=" + HMAC-SHA256 тела с секретом подписки
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// maxResponseBody - сколько байт ответа получателя сохраняется в журнале доставок
+const maxResponseBody = 2048
+
+// Response - ответ получателя вебхука
+type Response struct {
+	StatusCode int
+	Body       string
+}
+
+// OK - получатель принял вебхук (код 2xx)
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Sign возвращает подпись тела для заголовка X-Webhook-Signature
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись - для получателей и тестов
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Client отправляет подписанные вебхуки
+type Client struct {
+	HTTP *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{HTTP: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Deliver отправляет JSON-тело на url. Ошибка возвращается только при сбое соединения;
+// ответ с любым кодом возвращается в Response.
+func (c *Client) Deliver(url, secret, event string, deliveryID int, body []byte) (*Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "myAPI-Webhooks/1.0")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(deliveryID))
+	req.Header.Set(SignatureHeader, Sign(secret, body))
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return &Response{StatusCode: resp.StatusCode, Body: string(respBody)}, nil
+}